@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsLog "github.com/Motmedel/dns_utils/pkg/log"
+	dnsUtilsClient "github.com/Motmedel/dns_utils/pkg/types/client"
+	dnsUtilsClientConfig "github.com/Motmedel/dns_utils/pkg/types/client/config"
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	altshiftLog "github.com/altshiftab/utils_go/pkg/log"
+	motmedelErrorLogger "github.com/altshiftab/utils_go/pkg/log/error_logger"
+	motmedelLogHandler "github.com/altshiftab/utils_go/pkg/log/handler"
+	"github.com/miekg/dns"
+	"golang.org/x/sync/semaphore"
+)
+
+// recordTypes are the types of the apex RRsets whose signatures are checked.
+var recordTypes = []uint16{dns.TypeSOA, dns.TypeDNSKEY, dns.TypeNS, dns.TypeA, dns.TypeMX}
+
+const (
+	// exitThresholdCrossed is the exit status when a signature expires within
+	// the threshold, or has expired.
+	exitThresholdCrossed = 1
+	// exitCheckFailed is the exit status when the signatures of a domain could
+	// not be obtained, and none of those that could expires within the
+	// threshold.
+	exitCheckFailed = 2
+)
+
+func main() {
+	logger := &motmedelErrorLogger.Logger{
+		Logger: slog.New(
+			&altshiftLog.ContextHandler{
+				Next: motmedelLogHandler.New(slog.NewJSONHandler(os.Stderr, nil)),
+				Extractors: []altshiftLog.ContextExtractor{
+					dnsUtilsLog.DnsContextExtractor,
+					&altshiftLog.ErrorContextExtractor{SkipStackTrace: true},
+				},
+			},
+		),
+	}
+	slog.SetDefault(logger.Logger)
+
+	var inPath string
+	flag.StringVar(&inPath, "in", "", "The path of the input file.")
+
+	var numConcurrent int
+	flag.IntVar(&numConcurrent, "num", 50, "The number of concurrent requests.")
+
+	var dnsServerAddress string
+	flag.StringVar(&dnsServerAddress, "dns-server", "", "The DNS server to use.")
+
+	var thresholdDays int
+	flag.IntVar(
+		&thresholdDays,
+		"days",
+		7,
+		"The number of days within which a signature expiring makes the exit status 1. A domain whose signatures cannot be obtained makes it 2.",
+	)
+
+	flag.Parse()
+
+	var input *os.File
+	if inPath == "" {
+		input = os.Stdin
+	} else {
+		var err error
+		input, err = os.Open(inPath)
+		if err != nil {
+			logger.FatalWithExitingMessage(
+				"An error occurred when opening the input file.",
+				altshiftErrors.New(fmt.Errorf("os open (input file): %w", err), inPath),
+			)
+		}
+	}
+
+	var dnsClient *dnsUtilsClient.Client
+	if dnsServerAddress == "" {
+		// All the servers of resolv.conf are used, moving on to the next
+		// when one fails.
+		var err error
+		dnsClient, err = dnsUtilsClient.NewFromResolvConf(context.Background())
+		if err != nil {
+			logger.FatalWithExitingMessage(
+				"An error occurred when creating a DNS client from resolv.conf.",
+				fmt.Errorf("new from resolv conf: %w", err),
+			)
+		}
+	} else {
+		dnsClient = dnsUtilsClient.New(dnsUtilsClientConfig.WithAddress(dnsServerAddress))
+	}
+
+	threshold := time.Duration(thresholdDays) * 24 * time.Hour
+
+	weightedSemaphore := semaphore.NewWeighted(int64(numConcurrent))
+	var waitGroup sync.WaitGroup
+	var printLock sync.Mutex
+	var thresholdCrossed atomic.Bool
+	var checkFailed atomic.Bool
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		domain := strings.TrimSpace(scanner.Text())
+		if domain == "" {
+			continue
+		}
+
+		var acquireWeight int64 = 1
+		if err := weightedSemaphore.Acquire(context.Background(), acquireWeight); err != nil {
+			logger.FatalWithExitingMessage(
+				"An error occurred when acquiring the weighted semaphore.",
+				altshiftErrors.New(fmt.Errorf("semaphore acquire: %w", err), acquireWeight),
+			)
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			ctx := dnsUtilsContext.WithDnsContext(context.Background())
+			signatures, err := dnsClient.GetDnssecSignatures(ctx, domain, recordTypes...)
+			weightedSemaphore.Release(acquireWeight)
+			if err != nil {
+				checkFailed.Store(true)
+				logger.WarnContext(
+					altshiftContext.WithError(
+						ctx,
+						altshiftErrors.New(
+							fmt.Errorf("get dnssec signatures: %w", err),
+							domain,
+						),
+					),
+					"An error occurred when getting the DNSSEC signatures. Skipping.",
+				)
+				return
+			}
+
+			if len(signatures) == 0 {
+				printLock.Lock()
+				fmt.Printf("%s:unsigned\n", domain)
+				printLock.Unlock()
+				return
+			}
+
+			earliestExpiration := signatures[0].Expiration
+			for _, signature := range signatures[1:] {
+				if signature.Expiration.Before(earliestExpiration) {
+					earliestExpiration = signature.Expiration
+				}
+			}
+
+			remaining := time.Until(earliestExpiration)
+			if remaining < threshold {
+				thresholdCrossed.Store(true)
+			}
+
+			printLock.Lock()
+			if remaining <= 0 {
+				fmt.Printf("%s:expired:%s\n", domain, earliestExpiration.Format(time.RFC3339))
+			} else {
+				fmt.Printf(
+					"%s:%d:%s\n",
+					domain,
+					int(remaining/(24*time.Hour)),
+					earliestExpiration.Format(time.RFC3339),
+				)
+			}
+			printLock.Unlock()
+		}()
+	}
+
+	waitGroup.Wait()
+
+	if err := scanner.Err(); err != nil {
+		logger.FatalWithExitingMessage("An error occurred when scanning.", fmt.Errorf("scanner: %w", err))
+	}
+
+	switch {
+	case thresholdCrossed.Load():
+		os.Exit(exitThresholdCrossed)
+	case checkFailed.Load():
+		os.Exit(exitCheckFailed)
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/Motmedel/dns_utils/cmd/dnssec_expiry
+
+go 1.26
+
+require (
+	github.com/Motmedel/dns_utils v0.0.58
+	github.com/altshiftab/utils_go v1.26.0
+	github.com/miekg/dns v1.1.72
+	golang.org/x/sync v0.20.0
+)
+
+require (
+	golang.org/x/mod v0.34.0 // indirect
+	golang.org/x/net v0.52.0 // indirect
+	golang.org/x/sys v0.43.0 // indirect
+	golang.org/x/tools v0.43.0 // indirect
+)
+
+replace github.com/Motmedel/dns_utils => ../..
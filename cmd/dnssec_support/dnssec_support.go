@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -47,6 +48,9 @@ func main() {
 	var dnsServerAddress string
 	flag.StringVar(&dnsServerAddress, "dns-server", "", "The DNS server to use.")
 
+	var printJson bool
+	flag.BoolVar(&printJson, "json", false, "Print a JSON report of how each zone is signed, one per line.")
+
 	flag.Parse()
 
 	var input *os.File
@@ -104,6 +108,38 @@ func main() {
 			defer waitGroup.Done()
 
 			ctx := dnsUtilsContext.WithDnsContext(context.Background())
+
+			if printJson {
+				report, err := dnsClient.GetDnssecReport(ctx, domain)
+				weightedSemaphore.Release(acquireWeight)
+				if err != nil {
+					logger.WarnContext(
+						altshiftContext.WithError(
+							ctx,
+							altshiftErrors.New(fmt.Errorf("get dnssec report: %w", err), domain),
+						),
+						"An error occurred when getting the DNSSEC report. Skipping.",
+					)
+					return
+				}
+
+				reportData, err := json.Marshal(report)
+				if err != nil {
+					logger.WarnContext(
+						altshiftContext.WithError(
+							ctx,
+							altshiftErrors.New(fmt.Errorf("json marshal (report): %w", err), domain),
+						),
+						"An error occurred when marshalling the DNSSEC report. Skipping.",
+					)
+					return
+				}
+				printLock.Lock()
+				fmt.Println(string(reportData))
+				printLock.Unlock()
+				return
+			}
+
 			ok, err := dnsClient.SupportsDnssec(ctx, domain)
 			weightedSemaphore.Release(acquireWeight)
 			if err != nil {
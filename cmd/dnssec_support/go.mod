@@ -15,3 +15,5 @@ require (
 	golang.org/x/sys v0.43.0 // indirect
 	golang.org/x/tools v0.43.0 // indirect
 )
+
+replace github.com/Motmedel/dns_utils => ../..
@@ -52,6 +52,14 @@ func main() {
 	var dnsServerAddress string
 	flag.StringVar(&dnsServerAddress, "dns-server", "", "The DNS server to use.")
 
+	var validateDnssec bool
+	flag.BoolVar(
+		&validateDnssec,
+		"dnssec",
+		false,
+		"Verify the DNSSEC proof of non-existent domains, and print whether it is proven or only claimed.",
+	)
+
 	flag.Parse()
 
 	var input *os.File
@@ -83,7 +91,11 @@ func main() {
 		dnsServerAddress = net.JoinHostPort(dnsServers[0], "53")
 	}
 
-	dnsClient := dnsUtilsClient.New(dnsUtilsClientConfig.WithAddress(dnsServerAddress))
+	clientOptions := []dnsUtilsClientConfig.Option{dnsUtilsClientConfig.WithAddress(dnsServerAddress)}
+	if validateDnssec {
+		clientOptions = append(clientOptions, dnsUtilsClientConfig.WithDnssecValidation())
+	}
+	dnsClient := dnsUtilsClient.New(clientOptions...)
 
 	weightedSemaphore := semaphore.NewWeighted(int64(numConcurrent))
 	var waitGroup sync.WaitGroup
@@ -109,14 +121,14 @@ func main() {
 			defer waitGroup.Done()
 
 			ctx := dnsUtilsContext.WithDnsContext(context.Background())
-			ok, err := dnsClient.DomainExists(ctx, domain)
+			ok, denial, err := dnsClient.DomainExistsWithDenial(ctx, domain)
 			weightedSemaphore.Release(acquireWeight)
 			if err != nil {
 				logger.WarnContext(
 					altshiftContext.WithError(
 						ctx,
 						altshiftErrors.New(
-							fmt.Errorf("supports dnssec: %w", err),
+							fmt.Errorf("domain exists with denial: %w", err),
 							domain,
 						),
 					),
@@ -125,7 +137,14 @@ func main() {
 				return
 			}
 			printLock.Lock()
-			fmt.Printf("%s:%t\n", domain, ok)
+			switch {
+			case !validateDnssec || ok:
+				fmt.Printf("%s:%t\n", domain, ok)
+			case denial != nil && denial.Proven:
+				fmt.Printf("%s:%t:proven\n", domain, ok)
+			default:
+				fmt.Printf("%s:%t:claimed\n", domain, ok)
+			}
 			printLock.Unlock()
 		}()
 	}
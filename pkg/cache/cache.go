@@ -0,0 +1,384 @@
+package cache
+
+import (
+	"container/list"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	"github.com/miekg/dns"
+)
+
+const (
+	DefaultCapacity = 10000
+	// DefaultMaxNegativeTtl caps how long a negative response is cached; RFC
+	// 2308 section 5 suggests one to three hours.
+	DefaultMaxNegativeTtl = 3 * time.Hour
+	// StaleTtl is the TTL with which a stale response is served (RFC 8767
+	// section 4).
+	StaleTtl = 30 * time.Second
+)
+
+// prefetchDivisor sets how early a response is prefetched: once less than
+// 1/prefetchDivisor of its TTL remains.
+const prefetchDivisor = 10
+
+// Key identifies the responses that can answer a query: those to a question of
+// the same name, type and class, with the same DO and CD bits and the same
+// EDNS Client Subnet.
+type Key struct {
+	// Name is the lower-cased, fully qualified name.
+	Name  string
+	Type  uint16
+	Class uint16
+	Do    bool
+	Cd    bool
+	// ClientSubnet is the source prefix of the EDNS Client Subnet option, if
+	// any. Responses are not shared between subnets, whatever their scope.
+	ClientSubnet netip.Prefix
+}
+
+// KeyFromMessage returns the key of the message, which must have exactly one
+// question.
+func KeyFromMessage(message *dns.Msg) (Key, bool) {
+	if message == nil || len(message.Question) != 1 {
+		return Key{}, false
+	}
+
+	question := message.Question[0]
+
+	var do bool
+	if opt := message.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+
+	var clientSubnet netip.Prefix
+	if subnet := dns_utils.GetClientSubnet(message); subnet != nil {
+		if address, ok := netip.AddrFromSlice(subnet.Address); ok {
+			clientSubnet, _ = address.Unmap().Prefix(int(subnet.SourceNetmask))
+		}
+	}
+
+	return Key{
+		Name:         strings.ToLower(dns.Fqdn(question.Name)),
+		Type:         question.Qtype,
+		Class:        question.Qclass,
+		Do:           do,
+		Cd:           message.CheckingDisabled,
+		ClientSubnet: clientSubnet,
+	}, true
+}
+
+type entry struct {
+	key      Key
+	message  *dns.Msg
+	storedAt time.Time
+	ttl      time.Duration
+	// hits is the number of times the response has been returned by Get.
+	hits int
+	// prefetching is set once Prefetch has reported the entry, until
+	// EndPrefetch.
+	prefetching bool
+}
+
+// remaining returns how long the entry has left before it expires; it is
+// negative once it has.
+func (e *entry) remaining(now time.Time) time.Duration {
+	return e.ttl - now.Sub(e.storedAt)
+}
+
+type Option func(*Cache)
+
+// Cache is a size-bounded cache of responses that evicts the least recently
+// used entry when full. Negative responses are cached per RFC 2308, for the
+// SOA minimum. A response is returned with its TTLs rewritten to the time that
+// remains. It is safe for concurrent use.
+//
+// With serve-stale enabled, an expired response is kept for a while longer, to
+// be returned by GetStale when no fresh one can be obtained (RFC 8767). With
+// prefetch enabled, Prefetch reports the popular responses that are about to
+// expire, so that they can be refreshed before they do.
+type Cache struct {
+	capacity       int
+	maxTtl         time.Duration
+	maxNegativeTtl time.Duration
+	maxStale       time.Duration
+	prefetchHits   int
+	now            func() time.Time
+
+	mutex    sync.Mutex
+	elements map[Key]*list.Element
+	recency  *list.List
+}
+
+func New(options ...Option) *Cache {
+	cache := &Cache{
+		capacity:       DefaultCapacity,
+		maxNegativeTtl: DefaultMaxNegativeTtl,
+		now:            time.Now,
+		elements:       make(map[Key]*list.Element),
+		recency:        list.New(),
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option(cache)
+		}
+	}
+
+	return cache
+}
+
+// WithCapacity sets the maximum number of entries.
+func WithCapacity(capacity int) Option {
+	return func(cache *Cache) {
+		cache.capacity = capacity
+	}
+}
+
+// WithMaxTtl caps how long any response is cached; zero means no cap.
+func WithMaxTtl(maxTtl time.Duration) Option {
+	return func(cache *Cache) {
+		cache.maxTtl = maxTtl
+	}
+}
+
+// WithMaxNegativeTtl caps how long a negative response is cached.
+func WithMaxNegativeTtl(maxNegativeTtl time.Duration) Option {
+	return func(cache *Cache) {
+		cache.maxNegativeTtl = maxNegativeTtl
+	}
+}
+
+// WithServeStale keeps responses for maxStale after they expire, to be
+// returned by GetStale. RFC 8767 section 5 suggests one to three days.
+func WithServeStale(maxStale time.Duration) Option {
+	return func(cache *Cache) {
+		cache.maxStale = maxStale
+	}
+}
+
+// WithPrefetch makes Prefetch report the responses that Get has returned at
+// least minHits times, once less than a tenth of their TTL remains.
+func WithPrefetch(minHits int) Option {
+	return func(cache *Cache) {
+		cache.prefetchHits = max(minHits, 1)
+	}
+}
+
+// IsNegative reports whether the response says that the name, or data of the
+// type, does not exist: NXDOMAIN or NODATA (RFC 2308 section 2).
+func IsNegative(message *dns.Msg) bool {
+	if message == nil {
+		return false
+	}
+	return message.Rcode == dns.RcodeNameError || (message.Rcode == dns.RcodeSuccess && len(message.Answer) == 0)
+}
+
+func hasSoa(records []dns.RR) bool {
+	for _, record := range records {
+		if _, ok := record.(*dns.SOA); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ttl returns for how long the response may be cached; zero when it may not.
+func (c *Cache) ttl(message *dns.Msg) time.Duration {
+	if message == nil || message.Truncated {
+		return 0
+	}
+
+	if message.Rcode != dns.RcodeSuccess && message.Rcode != dns.RcodeNameError {
+		return 0
+	}
+
+	ttl := dns_utils.EffectiveMessageTtl(message)
+
+	if IsNegative(message) {
+		// Without an SOA record, there is no negative TTL (RFC 2308 section 5).
+		if !hasSoa(message.Ns) {
+			return 0
+		}
+		if c.maxNegativeTtl > 0 {
+			ttl = min(ttl, c.maxNegativeTtl)
+		}
+	}
+
+	if c.maxTtl > 0 {
+		ttl = min(ttl, c.maxTtl)
+	}
+
+	return ttl
+}
+
+// Set caches the response to a query with the key.
+func (c *Cache) Set(key Key, message *dns.Msg) {
+	if c == nil {
+		return
+	}
+
+	ttl := c.ttl(message)
+	if ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	cachedEntry := &entry{key: key, message: message.Copy(), storedAt: c.now(), ttl: ttl}
+
+	if element, ok := c.elements[key]; ok {
+		element.Value = cachedEntry
+		c.recency.MoveToFront(element)
+		return
+	}
+
+	c.elements[key] = c.recency.PushFront(cachedEntry)
+
+	for c.recency.Len() > c.capacity {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.elements, oldest.Value.(*entry).key)
+	}
+}
+
+// Get returns a copy of the cached response for the key, with its TTLs
+// rewritten to the remaining time.
+func (c *Cache) Get(key Key) (*dns.Msg, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return nil, false
+	}
+
+	cachedEntry := element.Value.(*entry)
+
+	remaining := cachedEntry.remaining(c.now())
+	if remaining <= 0 {
+		if -remaining >= c.maxStale {
+			c.recency.Remove(element)
+			delete(c.elements, key)
+		}
+		return nil, false
+	}
+
+	c.recency.MoveToFront(element)
+	cachedEntry.hits++
+
+	message := cachedEntry.message.Copy()
+	// Round up, so that a response is not served with a TTL of zero.
+	dns_utils.ApplyRemainingTtl(message, uint32((remaining+time.Second-1)/time.Second))
+
+	return message, true
+}
+
+// GetStale returns a copy of the expired response for the key, with its TTLs
+// set to StaleTtl, if serve-stale is enabled and the response expired less
+// than the maximum staleness ago.
+func (c *Cache) GetStale(key Key) (*dns.Msg, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return nil, false
+	}
+
+	cachedEntry := element.Value.(*entry)
+
+	remaining := cachedEntry.remaining(c.now())
+	if remaining > 0 {
+		return nil, false
+	}
+	if -remaining >= c.maxStale {
+		c.recency.Remove(element)
+		delete(c.elements, key)
+		return nil, false
+	}
+
+	c.recency.MoveToFront(element)
+
+	message := cachedEntry.message.Copy()
+	dns_utils.ApplyRemainingTtl(message, uint32(StaleTtl/time.Second))
+
+	return message, true
+}
+
+// Prefetch reports whether the response for the key should be refreshed now,
+// which is when prefetch is enabled, the response is popular and it is about
+// to expire. It reports so only once for each response until EndPrefetch; the
+// refreshed response is then to be stored with Set.
+func (c *Cache) Prefetch(key Key) bool {
+	if c == nil || c.prefetchHits <= 0 {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return false
+	}
+
+	cachedEntry := element.Value.(*entry)
+	if cachedEntry.prefetching || cachedEntry.hits < c.prefetchHits {
+		return false
+	}
+
+	remaining := cachedEntry.remaining(c.now())
+	if remaining <= 0 || remaining > cachedEntry.ttl/prefetchDivisor {
+		return false
+	}
+
+	cachedEntry.prefetching = true
+
+	return true
+}
+
+// EndPrefetch is to be called once the refresh of the response for the key has
+// completed or failed. If the response was not replaced, Prefetch may report it
+// again.
+func (c *Cache) EndPrefetch(key Key) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.elements[key]; ok {
+		element.Value.(*entry).prefetching = false
+	}
+}
+
+// Len returns the number of entries, including those that have expired but
+// not yet been removed.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.recency.Len()
+}
@@ -0,0 +1,474 @@
+package cache
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	"github.com/miekg/dns"
+)
+
+// clock is a settable time source.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestCache(t *testing.T, options ...Option) (*Cache, *clock) {
+	t.Helper()
+
+	testClock := &clock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := New(options...)
+	cache.now = testClock.Now
+
+	return cache, testClock
+}
+
+func newQuery(name string, recordType uint16) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), recordType)
+	return query
+}
+
+func newAnswer(t *testing.T, query *dns.Msg, records ...string) *dns.Msg {
+	t.Helper()
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("new rr: %v", err)
+		}
+		response.Answer = append(response.Answer, rr)
+	}
+
+	return response
+}
+
+func newNegative(t *testing.T, query *dns.Msg, rcode int, soa string) *dns.Msg {
+	t.Helper()
+
+	response := new(dns.Msg)
+	response.SetRcode(query, rcode)
+	if soa != "" {
+		rr, err := dns.NewRR(soa)
+		if err != nil {
+			t.Fatalf("new rr: %v", err)
+		}
+		response.Ns = append(response.Ns, rr)
+	}
+
+	return response
+}
+
+func mustKey(t *testing.T, message *dns.Msg) Key {
+	t.Helper()
+
+	key, ok := KeyFromMessage(message)
+	if !ok {
+		t.Fatal("KeyFromMessage: not ok")
+	}
+	return key
+}
+
+func TestKeyFromMessage(t *testing.T) {
+	t.Parallel()
+
+	plain := newQuery("Example.COM", dns.TypeA)
+
+	withDo := newQuery("example.com", dns.TypeA)
+	withDo.SetEdns0(4096, true)
+
+	withCd := newQuery("example.com", dns.TypeA)
+	withCd.CheckingDisabled = true
+
+	withClientSubnet := newQuery("example.com", dns.TypeA)
+	dns_utils.SetClientSubnet(withClientSubnet, netip.MustParsePrefix("198.51.100.7/24"))
+
+	tests := []struct {
+		name    string
+		message *dns.Msg
+		want    Key
+		wantOk  bool
+	}{
+		{name: "nil", message: nil},
+		{name: "no question", message: new(dns.Msg)},
+		{
+			name:    "the name is lower-cased",
+			message: plain,
+			want:    Key{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET},
+			wantOk:  true,
+		},
+		{
+			name:    "do bit",
+			message: withDo,
+			want:    Key{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET, Do: true},
+			wantOk:  true,
+		},
+		{
+			name:    "cd bit",
+			message: withCd,
+			want:    Key{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET, Cd: true},
+			wantOk:  true,
+		},
+		{
+			name:    "client subnet",
+			message: withClientSubnet,
+			want: Key{
+				Name:         "example.com.",
+				Type:         dns.TypeA,
+				Class:        dns.ClassINET,
+				ClientSubnet: netip.MustParsePrefix("198.51.100.0/24"),
+			},
+			wantOk: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := KeyFromMessage(tt.message)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_RewritesTheTtl(t *testing.T) {
+	t.Parallel()
+
+	cache, testClock := newTestCache(t)
+
+	query := newQuery("example.com", dns.TypeA)
+	key := mustKey(t, query)
+	cache.Set(key, newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+
+	testClock.now = testClock.now.Add(100 * time.Second)
+
+	got, ok := cache.Get(key)
+	if !ok {
+		t.Fatal("Get: miss, want hit")
+	}
+	if ttl := got.Answer[0].Header().Ttl; ttl != 200 {
+		t.Errorf("TTL = %d, want 200", ttl)
+	}
+
+	// The copy is the caller's.
+	got.Answer[0].Header().Ttl = 1
+	if again, _ := cache.Get(key); again.Answer[0].Header().Ttl != 200 {
+		t.Error("modifying a returned response changed the cache")
+	}
+
+	testClock.now = testClock.now.Add(200 * time.Second)
+
+	if _, ok := cache.Get(key); ok {
+		t.Error("Get: hit after expiry, want miss")
+	}
+	if got := cache.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0", got)
+	}
+}
+
+func TestCache_Negative(t *testing.T) {
+	t.Parallel()
+
+	const soa = "example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 60"
+
+	tests := []struct {
+		name     string
+		response func(t *testing.T, query *dns.Msg) *dns.Msg
+		options  []Option
+		wantTtl  time.Duration
+	}{
+		{
+			name: "nxdomain uses the soa minimum",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(t, query, dns.RcodeNameError, soa)
+			},
+			wantTtl: 60 * time.Second,
+		},
+		{
+			name: "nodata uses the soa minimum",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(t, query, dns.RcodeSuccess, soa)
+			},
+			wantTtl: 60 * time.Second,
+		},
+		{
+			name: "the soa ttl caps the minimum",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(
+					t,
+					query,
+					dns.RcodeNameError,
+					"example.com. 30 IN SOA ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 60",
+				)
+			},
+			wantTtl: 30 * time.Second,
+		},
+		{
+			name: "the negative ttl is capped",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(t, query, dns.RcodeNameError, soa)
+			},
+			options: []Option{WithMaxNegativeTtl(10 * time.Second)},
+			wantTtl: 10 * time.Second,
+		},
+		{
+			name: "no soa, no caching",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(t, query, dns.RcodeNameError, "")
+			},
+		},
+		{
+			name: "servfail is not cached",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				return newNegative(t, query, dns.RcodeServerFailure, soa)
+			},
+		},
+		{
+			name: "a truncated response is not cached",
+			response: func(t *testing.T, query *dns.Msg) *dns.Msg {
+				response := newAnswer(t, query, "missing.example.com. 300 IN A 192.0.2.1")
+				response.Truncated = true
+				return response
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, testClock := newTestCache(t, tt.options...)
+
+			query := newQuery("missing.example.com", dns.TypeA)
+			key := mustKey(t, query)
+			cache.Set(key, tt.response(t, query))
+
+			if tt.wantTtl == 0 {
+				if _, ok := cache.Get(key); ok {
+					t.Error("Get: hit, want miss")
+				}
+				return
+			}
+
+			testClock.now = testClock.now.Add(tt.wantTtl - time.Second)
+			if _, ok := cache.Get(key); !ok {
+				t.Fatal("Get: miss before expiry, want hit")
+			}
+
+			testClock.now = testClock.now.Add(time.Second)
+			if _, ok := cache.Get(key); ok {
+				t.Error("Get: hit at expiry, want miss")
+			}
+		})
+	}
+}
+
+func TestCache_KeysAreDistinct(t *testing.T) {
+	t.Parallel()
+
+	cache, _ := newTestCache(t)
+
+	query := newQuery("example.com", dns.TypeA)
+	cache.Set(mustKey(t, query), newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+
+	dnssecQuery := newQuery("example.com", dns.TypeA)
+	dnssecQuery.SetEdns0(4096, true)
+	if _, ok := cache.Get(mustKey(t, dnssecQuery)); ok {
+		t.Error("Get with DO: hit, want miss")
+	}
+
+	if _, ok := cache.Get(mustKey(t, newQuery("EXAMPLE.com", dns.TypeA))); !ok {
+		t.Error("Get with another case: miss, want hit")
+	}
+}
+
+func TestCache_EvictsTheLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	cache, _ := newTestCache(t, WithCapacity(2))
+
+	set := func(name string) Key {
+		query := newQuery(name, dns.TypeA)
+		key := mustKey(t, query)
+		cache.Set(key, newAnswer(t, query, name+". 300 IN A 192.0.2.1"))
+		return key
+	}
+
+	first := set("first.example")
+	second := set("second.example")
+
+	// Using the first makes the second the least recently used.
+	if _, ok := cache.Get(first); !ok {
+		t.Fatal("Get(first): miss, want hit")
+	}
+
+	third := set("third.example")
+
+	if got := cache.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	if _, ok := cache.Get(second); ok {
+		t.Error("Get(second): hit, want miss")
+	}
+	if _, ok := cache.Get(first); !ok {
+		t.Error("Get(first): miss, want hit")
+	}
+	if _, ok := cache.Get(third); !ok {
+		t.Error("Get(third): miss, want hit")
+	}
+}
+
+func TestCache_Nil(t *testing.T) {
+	t.Parallel()
+
+	var cache *Cache
+	cache.Set(Key{}, new(dns.Msg))
+
+	if _, ok := cache.Get(Key{}); ok {
+		t.Error("Get: hit, want miss")
+	}
+	if got := cache.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0", got)
+	}
+}
+
+func TestCache_GetStale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options []Option
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "disabled", elapsed: 301 * time.Second},
+		{name: "fresh", options: []Option{WithServeStale(time.Hour)}, elapsed: 100 * time.Second},
+		{name: "stale", options: []Option{WithServeStale(time.Hour)}, elapsed: 301 * time.Second, want: true},
+		{name: "too stale", options: []Option{WithServeStale(time.Hour)}, elapsed: 300*time.Second + time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, testClock := newTestCache(t, tt.options...)
+
+			query := newQuery("example.com", dns.TypeA)
+			key := mustKey(t, query)
+			cache.Set(key, newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+
+			testClock.now = testClock.now.Add(tt.elapsed)
+
+			// An expired response is not fresh, even when it can be served stale.
+			if _, ok := cache.Get(key); ok != (tt.elapsed < 300*time.Second) {
+				t.Errorf("Get: ok = %v", ok)
+			}
+
+			got, ok := cache.GetStale(key)
+			if ok != tt.want {
+				t.Fatalf("GetStale: ok = %v, want %v", ok, tt.want)
+			}
+			if !ok {
+				return
+			}
+			if ttl := got.Answer[0].Header().Ttl; ttl != uint32(StaleTtl/time.Second) {
+				t.Errorf("TTL = %d, want %d", ttl, StaleTtl/time.Second)
+			}
+		})
+	}
+}
+
+func TestCache_Prefetch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options []Option
+		hits    int
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "disabled", hits: 5, elapsed: 295 * time.Second},
+		{name: "not popular", options: []Option{WithPrefetch(3)}, hits: 2, elapsed: 295 * time.Second},
+		{name: "not about to expire", options: []Option{WithPrefetch(3)}, hits: 3, elapsed: 200 * time.Second},
+		{name: "popular and about to expire", options: []Option{WithPrefetch(3)}, hits: 3, elapsed: 295 * time.Second, want: true},
+		{name: "expired", options: []Option{WithPrefetch(3)}, hits: 3, elapsed: 300 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, testClock := newTestCache(t, tt.options...)
+
+			query := newQuery("example.com", dns.TypeA)
+			key := mustKey(t, query)
+			cache.Set(key, newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+
+			for range tt.hits {
+				cache.Get(key)
+			}
+
+			testClock.now = testClock.now.Add(tt.elapsed)
+
+			if got := cache.Prefetch(key); got != tt.want {
+				t.Fatalf("Prefetch() = %v, want %v", got, tt.want)
+			}
+
+			// A response is reported only once.
+			if got := cache.Prefetch(key); got {
+				t.Error("second Prefetch() = true, want false")
+			}
+
+			if !tt.want {
+				return
+			}
+
+			// The refreshed response can be prefetched in turn.
+			cache.Set(key, newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+			for range tt.hits {
+				cache.Get(key)
+			}
+			testClock.now = testClock.now.Add(tt.elapsed)
+			if got := cache.Prefetch(key); !got {
+				t.Error("Prefetch() after Set = false, want true")
+			}
+		})
+	}
+}
+
+func TestCache_PrefetchAfterFailedRefresh(t *testing.T) {
+	t.Parallel()
+
+	cache, testClock := newTestCache(t, WithPrefetch(1))
+
+	query := newQuery("example.com", dns.TypeA)
+	key := mustKey(t, query)
+	cache.Set(key, newAnswer(t, query, "example.com. 300 IN A 192.0.2.1"))
+	cache.Get(key)
+
+	testClock.now = testClock.now.Add(295 * time.Second)
+
+	if !cache.Prefetch(key) {
+		t.Fatal("Prefetch() = false, want true")
+	}
+
+	// The refresh fails, or its response is not cacheable.
+	cache.Set(key, &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeServerFailure}})
+	cache.EndPrefetch(key)
+
+	if !cache.Prefetch(key) {
+		t.Error("Prefetch() after EndPrefetch = false, want true")
+	}
+}
@@ -0,0 +1,240 @@
+package dns_utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/miekg/dns"
+)
+
+func TestRandomizeCase(t *testing.T) {
+	t.Parallel()
+
+	const name = "www.Example-1.com."
+
+	seen := make(map[string]struct{})
+	for range 32 {
+		randomized := RandomizeCase(name)
+		if !strings.EqualFold(randomized, name) {
+			t.Fatalf("RandomizeCase(%q) = %q, which is another name", name, randomized)
+		}
+		seen[randomized] = struct{}{}
+	}
+
+	if len(seen) < 2 {
+		t.Errorf("RandomizeCase(%q) always returned %q", name, name)
+	}
+}
+
+// invertCase swaps the case of each letter, so that a name never keeps the
+// case it had.
+func invertCase(name string) string {
+	nameBytes := []byte(name)
+	for i, b := range nameBytes {
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') {
+			nameBytes[i] = b ^ 0x20
+		}
+	}
+	return string(nameBytes)
+}
+
+// startUdpAndTcpServer serves the handlers on the same port over UDP and TCP,
+// and returns the address.
+func startUdpAndTcpServer(t *testing.T, udpHandler dns.HandlerFunc, tcpHandler dns.HandlerFunc) string {
+	t.Helper()
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen packet: %v", err)
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		_ = packetConn.Close()
+		t.Fatalf("listen: %v", err)
+	}
+
+	udpServer := &dns.Server{PacketConn: packetConn, Handler: udpHandler}
+	tcpServer := &dns.Server{Listener: listener, Handler: tcpHandler}
+	for _, server := range []*dns.Server{udpServer, tcpServer} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go func() { _ = server.ActivateAndServe() }()
+		<-started
+		t.Cleanup(func() { _ = server.Shutdown() })
+	}
+
+	return packetConn.LocalAddr().String()
+}
+
+func TestExchanger_CaseRandomization(t *testing.T) {
+	t.Parallel()
+
+	answer := func(modify func(response *dns.Msg)) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("192.0.2.1"),
+			})
+			if modify != nil {
+				modify(m)
+			}
+			_ = w.WriteMsg(m)
+		}
+	}
+
+	changesCase := answer(func(response *dns.Msg) {
+		response.Question[0].Name = invertCase(response.Question[0].Name)
+	})
+	truncates := answer(func(response *dns.Msg) {
+		response.Answer = nil
+		response.Truncated = true
+	})
+
+	tests := []struct {
+		name              string
+		caseRandomization CaseRandomization
+		udpHandler        dns.HandlerFunc
+		wantErr           error
+		wantTcp           bool
+	}{
+		{name: "off", caseRandomization: CaseRandomizationOff, udpHandler: changesCase},
+		{name: "preserved", caseRandomization: CaseRandomizationFail, udpHandler: answer(nil)},
+		{name: "retry over tcp", caseRandomization: CaseRandomizationRetryTcp, udpHandler: changesCase, wantTcp: true},
+		{
+			name:              "fail",
+			caseRandomization: CaseRandomizationFail,
+			udpHandler:        changesCase,
+			wantErr:           dnsUtilsErrors.ErrPossibleSpoofing,
+		},
+		{
+			name:              "a truncated response is retried over tcp",
+			caseRandomization: CaseRandomizationFail,
+			udpHandler:        truncates,
+			wantTcp:           true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tcpQueries atomic.Int32
+			address := startUdpAndTcpServer(t, tt.udpHandler, func(w dns.ResponseWriter, r *dns.Msg) {
+				tcpQueries.Add(1)
+				answer(nil)(w, r)
+			})
+
+			message := new(dns.Msg)
+			message.SetQuestion("www.example.com.", dns.TypeA)
+
+			dnsContext := &dnsUtilsTypes.DnsContext{}
+			ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+			exchanger := &Exchanger{Client: &dns.Client{}, CaseRandomization: tt.caseRandomization}
+			response, err := exchanger.Exchange(ctx, message, address)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if _, ok := errors.AsType[*dnsUtilsErrors.SpoofingError](err); !ok {
+					t.Errorf("err = %v, want a *SpoofingError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(response.Answer) != 1 {
+				t.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+			}
+			if (tcpQueries.Load() != 0) != tt.wantTcp {
+				t.Errorf("tcp queries = %d, wantTcp %v", tcpQueries.Load(), tt.wantTcp)
+			}
+			if tt.caseRandomization != CaseRandomizationOff && response.Question[0].Name != message.Question[0].Name {
+				t.Errorf("question name = %q, want %q", response.Question[0].Name, message.Question[0].Name)
+			}
+			if got := dnsContext.QuestionMessage.Question[0].Name; got != message.Question[0].Name {
+				t.Errorf("DnsContext question name = %q, want %q", got, message.Question[0].Name)
+			}
+		})
+	}
+}
+
+func TestExchanger_CaseRandomizationWithoutQuestion(t *testing.T) {
+	t.Parallel()
+
+	// A server failure without a question section.
+	serverFailure := func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		m.Question = nil
+		_ = w.WriteMsg(m)
+	}
+	address := startUdpAndTcpServer(t, serverFailure, serverFailure)
+
+	message := new(dns.Msg)
+	message.SetQuestion("www.example.com.", dns.TypeA)
+
+	exchanger := &Exchanger{Client: &dns.Client{}, CaseRandomization: CaseRandomizationFail}
+	response, err := exchanger.Exchange(context.Background(), message, address)
+
+	if _, ok := errors.AsType[*dnsUtilsErrors.SpoofingError](err); ok {
+		t.Fatalf("err = %v, want no *SpoofingError", err)
+	}
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok {
+		t.Fatalf("err = %v, want a *RcodeError", err)
+	}
+	if rcodeError.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Rcode = %d, want %d", rcodeError.Rcode, dns.RcodeServerFailure)
+	}
+	if response == nil {
+		t.Error("response = nil, want the SERVFAIL response")
+	}
+}
+
+func TestGetDnsAnswers_WithCaseRandomization(t *testing.T) {
+	t.Parallel()
+
+	address := startUdpAndTcpServer(
+		t,
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Question[0].Name = invertCase(m.Question[0].Name)
+			_ = w.WriteMsg(m)
+		},
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			_ = w.WriteMsg(m)
+		},
+	)
+
+	_, err := GetDnsAnswers(
+		context.Background(),
+		"example.com",
+		dns.TypeA,
+		&dns.Client{},
+		address,
+		WithCaseRandomization(CaseRandomizationFail),
+	)
+	if !errors.Is(err, dnsUtilsErrors.ErrPossibleSpoofing) {
+		t.Errorf("err = %v, want ErrPossibleSpoofing", err)
+	}
+
+	if _, err := GetDnsAnswers(context.Background(), "example.com", dns.TypeA, &dns.Client{}, address); err != nil {
+		t.Errorf("without case randomization: unexpected error: %v", err)
+	}
+}
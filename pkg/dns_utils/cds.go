@@ -0,0 +1,483 @@
+package dns_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	"github.com/Motmedel/dns_utils/pkg/dnssec"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	"github.com/altshiftab/utils_go/pkg/errors/types/nil_error"
+	"github.com/miekg/dns"
+)
+
+// CdsServer is what an authoritative server of a zone publishes as its CDS and
+// CDNSKEY records.
+type CdsServer struct {
+	Address string
+	Cds     []*dns.CDS
+	Cdnskey []*dns.CDNSKEY
+	// Err is the error that occurred when querying the server, if any.
+	Err error
+}
+
+// DsMaintenance is the state of the automated maintenance of the DS records of
+// a zone with CDS and CDNSKEY records (RFC 7344, RFC 8078).
+type DsMaintenance struct {
+	Domain string
+	// Ds are the DS records at the parent, and Dnskeys the DNSKEY records of the
+	// zone.
+	Ds      []*dns.DS
+	Dnskeys []*dns.DNSKEY
+	// Cds and Cdnskey are the records published by the first authoritative
+	// server that answered.
+	Cds     []*dns.CDS
+	Cdnskey []*dns.CDNSKEY
+	Servers []*CdsServer
+	// Rollover is set when the CDS or CDNSKEY records ask for other DS records
+	// than those at the parent, which means that a change is in progress.
+	Rollover bool
+	// Delete is set when the CDS or CDNSKEY records ask for the DS records to
+	// be removed (RFC 8078 section 4).
+	Delete bool
+	// Consistent is set when all authoritative servers answered and publish the
+	// same CDS and CDNSKEY records.
+	Consistent bool
+	// Problems are the inconsistencies that were found.
+	Problems []string
+}
+
+// isDeleteCds reports whether the CDS record is a delete request: "0 0 0 00"
+// (RFC 8078 section 4).
+func isDeleteCds(cds *dns.CDS) bool {
+	return cds.Algorithm == 0
+}
+
+// isDeleteCdnskey reports whether the CDNSKEY record is a delete request:
+// "0 3 0 AA==" (RFC 8078 section 4).
+func isDeleteCdnskey(cdnskey *dns.CDNSKEY) bool {
+	return cdnskey.Algorithm == 0
+}
+
+func equalDs(a *dns.DS, b *dns.DS) bool {
+	return a.KeyTag == b.KeyTag &&
+		a.Algorithm == b.Algorithm &&
+		a.DigestType == b.DigestType &&
+		strings.EqualFold(a.Digest, b.Digest)
+}
+
+func equalDnskey(a *dns.DNSKEY, b *dns.DNSKEY) bool {
+	return a.Flags == b.Flags &&
+		a.Protocol == b.Protocol &&
+		a.Algorithm == b.Algorithm &&
+		a.PublicKey == b.PublicKey
+}
+
+// cdsRecordStrings returns the rdata of the CDS and CDNSKEY records, sorted,
+// for comparing what servers publish.
+func cdsRecordStrings(cdsRecords []*dns.CDS, cdnskeyRecords []*dns.CDNSKEY) []string {
+	var recordStrings []string
+	for _, cds := range cdsRecords {
+		recordStrings = append(recordStrings, "CDS "+strings.TrimPrefix(cds.String(), cds.Hdr.String()))
+	}
+	for _, cdnskey := range cdnskeyRecords {
+		recordStrings = append(recordStrings, "CDNSKEY "+strings.TrimPrefix(cdnskey.String(), cdnskey.Hdr.String()))
+	}
+	slices.Sort(recordStrings)
+	return recordStrings
+}
+
+// DsMaintenanceLookup makes the lookups that checking the maintenance of DS
+// records needs: GetDnsAnswers looks up records by way of a recursive resolver,
+// and GetServerDnsAnswersWithMessage asks the authoritative server. *Client of
+// the client package satisfies it.
+type DsMaintenanceLookup interface {
+	GetDnsAnswers(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error)
+	GetServerDnsAnswersWithMessage(ctx context.Context, message *dns.Msg, serverAddress string) ([]dns.RR, error)
+}
+
+// clientLookup makes the lookups with the DNS client, by way of the recursive
+// resolver at the server address.
+type clientLookup struct {
+	client        *dns.Client
+	serverAddress string
+}
+
+func (l clientLookup) GetDnsAnswers(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error) {
+	return GetDnsAnswers(ctx, domain, recordType, l.client, l.serverAddress)
+}
+
+func (l clientLookup) GetServerDnsAnswersWithMessage(
+	ctx context.Context,
+	message *dns.Msg,
+	serverAddress string,
+) ([]dns.RR, error) {
+	return GetDnsAnswersWithMessage(ctx, message, l.client, serverAddress)
+}
+
+// queryCds asks the authoritative server for the CDS and CDNSKEY records of the
+// domain.
+func queryCds(ctx context.Context, domain string, lookup DsMaintenanceLookup, serverAddress string) *CdsServer {
+	server := &CdsServer{Address: serverAddress}
+
+	for _, recordType := range []uint16{dns.TypeCDS, dns.TypeCDNSKEY} {
+		message := NewDnssecQuestionMessage(domain, recordType)
+		message.RecursionDesired = false
+
+		// Each server gets a DNS context of its own.
+		ctxForServer := dnsUtilsContext.WithDnsContextValue(ctx, &dnsUtilsTypes.DnsContext{})
+		answers, err := lookup.GetServerDnsAnswersWithMessage(ctxForServer, message, serverAddress)
+		if err != nil {
+			server.Err = fmt.Errorf("get server dns answers with message (%s): %w", dns.TypeToString[recordType], err)
+			return server
+		}
+
+		for _, answer := range answers {
+			switch typedAnswer := answer.(type) {
+			case *dns.CDS:
+				server.Cds = append(server.Cds, typedAnswer)
+			case *dns.CDNSKEY:
+				server.Cdnskey = append(server.Cdnskey, typedAnswer)
+			}
+		}
+	}
+
+	return server
+}
+
+// GetAuthoritativeServers returns the addresses, with port 53, of the name
+// servers of the domain, per its NS records. The IPv6 addresses of a name
+// server are only used if it has no IPv4 addresses. A name server whose
+// addresses cannot be looked up is skipped; the errors of the lookups are then
+// returned, joined, together with the addresses of the other name servers.
+func GetAuthoritativeServers(
+	ctx context.Context,
+	domain string,
+	client *dns.Client,
+	serverAddress string,
+) ([]string, error) {
+	return GetAuthoritativeServersWithLookup(ctx, domain, clientLookup{client: client, serverAddress: serverAddress})
+}
+
+// GetAuthoritativeServersWithLookup is GetAuthoritativeServers with the
+// records looked up with the lookup.
+func GetAuthoritativeServersWithLookup(
+	ctx context.Context,
+	domain string,
+	lookup DsMaintenanceLookup,
+) ([]string, error) {
+	if lookup == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctx, nil_error.New("lookup"))
+	}
+
+	answers, err := lookup.GetDnsAnswers(ctx, dns.Fqdn(domain), dns.TypeNS)
+	if err != nil {
+		return nil, fmt.Errorf("get dns answers (ns): %w", err)
+	}
+
+	var addresses []string
+	var errs []error
+	for _, answer := range answers {
+		ns, ok := answer.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		var found bool
+		var lookupErrs []error
+		for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			addressAnswers, err := lookup.GetDnsAnswers(ctx, dns.Fqdn(ns.Ns), recordType)
+			if err != nil {
+				lookupErrs = append(
+					lookupErrs,
+					fmt.Errorf("get dns answers (%s %s): %w", ns.Ns, dns.TypeToString[recordType], err),
+				)
+				continue
+			}
+
+			for _, addressAnswer := range addressAnswers {
+				switch typedAnswer := addressAnswer.(type) {
+				case *dns.A:
+					addresses = append(addresses, net.JoinHostPort(typedAnswer.A.String(), "53"))
+					found = true
+				case *dns.AAAA:
+					addresses = append(addresses, net.JoinHostPort(typedAnswer.AAAA.String(), "53"))
+					found = true
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, lookupErrs...)
+		}
+	}
+
+	return addresses, errors.Join(errs...)
+}
+
+// CheckDsMaintenanceWithServers compares the CDS and CDNSKEY records that the
+// authoritative servers publish for the domain with each other, with the
+// DNSKEY records of the domain and with its DS records at the parent, which
+// are obtained from the server. It reports rollovers in progress, delete
+// requests, and records that are inconsistent. The authoritative servers can
+// be obtained with GetAuthoritativeServers. It fails if none of them answers.
+func CheckDsMaintenanceWithServers(
+	ctx context.Context,
+	domain string,
+	client *dns.Client,
+	serverAddress string,
+	authoritativeServers []string,
+) (*DsMaintenance, error) {
+	if domain == "" {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	if dnsContext.ServerAddress == "" {
+		dnsContext.ServerAddress = serverAddress
+	}
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	if client == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("dns client"))
+	}
+
+	if serverAddress == "" {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	return checkDsMaintenance(
+		ctxWithDnsContext,
+		domain,
+		clientLookup{client: client, serverAddress: serverAddress},
+		authoritativeServers,
+	)
+}
+
+// CheckDsMaintenanceWithLookup is CheckDsMaintenanceWithServers with the
+// records looked up, and the authoritative servers found and asked, with the
+// lookup. A name server whose addresses cannot be looked up makes the records
+// inconsistent, as one that cannot be queried does.
+func CheckDsMaintenanceWithLookup(
+	ctx context.Context,
+	domain string,
+	lookup DsMaintenanceLookup,
+) (*DsMaintenance, error) {
+	if domain == "" {
+		return nil, nil
+	}
+
+	if lookup == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctx, nil_error.New("lookup"))
+	}
+
+	authoritativeServers, lookupErr := GetAuthoritativeServersWithLookup(ctx, domain, lookup)
+	if len(authoritativeServers) == 0 && lookupErr != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctx,
+			fmt.Errorf("get authoritative servers with lookup: %w", lookupErr),
+		)
+	}
+
+	maintenance, err := checkDsMaintenance(ctx, domain, lookup, authoritativeServers)
+	if err != nil {
+		return nil, err
+	}
+	if lookupErr != nil {
+		maintenance.Consistent = false
+		maintenance.Problems = append(
+			maintenance.Problems,
+			fmt.Sprintf("name servers could not be looked up: %v", lookupErr),
+		)
+	}
+
+	return maintenance, nil
+}
+
+// checkDsMaintenance looks up the DS and DNSKEY records of the domain, asks the
+// authoritative servers for their CDS and CDNSKEY records and compares them.
+func checkDsMaintenance(
+	ctx context.Context,
+	domain string,
+	lookup DsMaintenanceLookup,
+	authoritativeServers []string,
+) (*DsMaintenance, error) {
+	if len(authoritativeServers) == 0 {
+		return nil, altshiftErrors.NewWithTraceCtx(ctx, empty_error.New("authoritative servers"))
+	}
+
+	maintenance := &DsMaintenance{Domain: dns.Fqdn(domain), Consistent: true}
+
+	dsAnswers, err := lookup.GetDnsAnswers(ctx, maintenance.Domain, dns.TypeDS)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctx, fmt.Errorf("get dns answers (ds): %w", err))
+	}
+	for _, answer := range dsAnswers {
+		if ds, ok := answer.(*dns.DS); ok {
+			maintenance.Ds = append(maintenance.Ds, ds)
+		}
+	}
+
+	dnskeyAnswers, err := lookup.GetDnsAnswers(ctx, maintenance.Domain, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctx, fmt.Errorf("get dns answers (dnskey): %w", err))
+	}
+	for _, answer := range dnskeyAnswers {
+		if dnskey, ok := answer.(*dns.DNSKEY); ok {
+			maintenance.Dnskeys = append(maintenance.Dnskeys, dnskey)
+		}
+	}
+
+	problem := func(format string, arguments ...any) {
+		maintenance.Problems = append(maintenance.Problems, fmt.Sprintf(format, arguments...))
+	}
+
+	var answered *CdsServer
+	for _, authoritativeServer := range authoritativeServers {
+		server := queryCds(ctx, domain, lookup, authoritativeServer)
+		maintenance.Servers = append(maintenance.Servers, server)
+
+		if server.Err != nil {
+			maintenance.Consistent = false
+			problem("the server %s could not be queried: %v", server.Address, server.Err)
+			continue
+		}
+		if answered == nil {
+			answered = server
+			continue
+		}
+		if !slices.Equal(
+			cdsRecordStrings(answered.Cds, answered.Cdnskey),
+			cdsRecordStrings(server.Cds, server.Cdnskey),
+		) {
+			maintenance.Consistent = false
+			problem(
+				"the servers %s and %s publish different CDS or CDNSKEY records",
+				answered.Address,
+				server.Address,
+			)
+		}
+	}
+	if answered == nil {
+		var errs []error
+		for _, server := range maintenance.Servers {
+			errs = append(errs, server.Err)
+		}
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctx,
+			fmt.Errorf("no authoritative server answered: %w", errors.Join(errs...)),
+		)
+	}
+
+	maintenance.Cds = answered.Cds
+	maintenance.Cdnskey = answered.Cdnskey
+	checkCds(maintenance, problem)
+
+	return maintenance, nil
+}
+
+// checkCds compares the CDS and CDNSKEY records with the DNSKEY and DS records,
+// and with each other.
+func checkCds(maintenance *DsMaintenance, problem func(format string, arguments ...any)) {
+	var deleteRecords, otherRecords int
+	for _, cds := range maintenance.Cds {
+		if isDeleteCds(cds) {
+			deleteRecords++
+		} else {
+			otherRecords++
+		}
+	}
+	for _, cdnskey := range maintenance.Cdnskey {
+		if isDeleteCdnskey(cdnskey) {
+			deleteRecords++
+		} else {
+			otherRecords++
+		}
+	}
+
+	if deleteRecords != 0 {
+		maintenance.Delete = true
+		if otherRecords != 0 {
+			problem("a delete request is published together with other CDS or CDNSKEY records")
+		}
+		return
+	}
+	if otherRecords == 0 {
+		return
+	}
+
+	matchesKey := func(ds *dns.DS) bool {
+		for _, dnskey := range maintenance.Dnskeys {
+			if dnssec.MatchesDs(dnskey, ds) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, cds := range maintenance.Cds {
+		if !matchesKey(&cds.DS) {
+			problem("the CDS record %d matches no DNSKEY of the zone", cds.KeyTag)
+		}
+		if !slices.ContainsFunc(maintenance.Ds, func(ds *dns.DS) bool { return equalDs(ds, &cds.DS) }) {
+			maintenance.Rollover = true
+		}
+
+		if len(maintenance.Cdnskey) != 0 && !slices.ContainsFunc(
+			maintenance.Cdnskey,
+			func(cdnskey *dns.CDNSKEY) bool { return dnssec.MatchesDs(&cdnskey.DNSKEY, &cds.DS) },
+		) {
+			problem("the CDS record %d matches no CDNSKEY record", cds.KeyTag)
+		}
+	}
+	if len(maintenance.Cds) != 0 {
+		for _, ds := range maintenance.Ds {
+			if !slices.ContainsFunc(maintenance.Cds, func(cds *dns.CDS) bool { return equalDs(ds, &cds.DS) }) {
+				maintenance.Rollover = true
+			}
+		}
+	}
+
+	for _, cdnskey := range maintenance.Cdnskey {
+		if !slices.ContainsFunc(
+			maintenance.Dnskeys,
+			func(dnskey *dns.DNSKEY) bool { return equalDnskey(dnskey, &cdnskey.DNSKEY) },
+		) {
+			problem("the CDNSKEY record %d is not a DNSKEY of the zone", cdnskey.KeyTag())
+		}
+
+		if len(maintenance.Cds) != 0 && !slices.ContainsFunc(
+			maintenance.Cds,
+			func(cds *dns.CDS) bool { return dnssec.MatchesDs(&cdnskey.DNSKEY, &cds.DS) },
+		) {
+			problem("the CDNSKEY record %d matches no CDS record", cdnskey.KeyTag())
+		}
+	}
+	if len(maintenance.Cds) == 0 {
+		// Without CDS records, the DS records are compared with the keys.
+		for _, cdnskey := range maintenance.Cdnskey {
+			if !slices.ContainsFunc(maintenance.Ds, func(ds *dns.DS) bool { return dnssec.MatchesDs(&cdnskey.DNSKEY, ds) }) {
+				maintenance.Rollover = true
+			}
+		}
+		for _, ds := range maintenance.Ds {
+			if !slices.ContainsFunc(
+				maintenance.Cdnskey,
+				func(cdnskey *dns.CDNSKEY) bool { return dnssec.MatchesDs(&cdnskey.DNSKEY, ds) },
+			) {
+				maintenance.Rollover = true
+			}
+		}
+	}
+}
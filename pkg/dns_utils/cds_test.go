@@ -0,0 +1,308 @@
+package dns_utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+func newTestDnskey(t *testing.T) *dns.DNSKEY {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	return key
+}
+
+func toCds(key *dns.DNSKEY) *dns.CDS {
+	cds := key.ToDS(dns.SHA256).ToCDS()
+	cds.Hdr.Ttl = 3600
+	return cds
+}
+
+// recordsHandler answers queries with the records of their type.
+func recordsHandler(records ...dns.RR) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, record := range records {
+			if record.Header().Rrtype == r.Question[0].Qtype {
+				m.Answer = append(m.Answer, record)
+			}
+		}
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestCheckDsMaintenanceWithServers(t *testing.T) {
+	t.Parallel()
+
+	current := newTestDnskey(t)
+	next := newTestDnskey(t)
+	unknown := newTestDnskey(t)
+
+	ds := current.ToDS(dns.SHA256)
+	ds.Hdr.Ttl = 3600
+	deleteCds := &dns.CDS{
+		DS: dns.DS{
+			Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeCDS, Class: dns.ClassINET, Ttl: 3600},
+			Digest: "00",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		first          []dns.RR
+		second         []dns.RR
+		wantRollover   bool
+		wantDelete     bool
+		wantConsistent bool
+		wantProblems   []string
+	}{
+		{
+			name:           "steady",
+			first:          []dns.RR{toCds(current), current.ToCDNSKEY()},
+			second:         []dns.RR{toCds(current), current.ToCDNSKEY()},
+			wantConsistent: true,
+		},
+		{
+			name:           "nothing published",
+			wantConsistent: true,
+		},
+		{
+			name:           "rollover",
+			first:          []dns.RR{toCds(next), next.ToCDNSKEY()},
+			second:         []dns.RR{toCds(next), next.ToCDNSKEY()},
+			wantRollover:   true,
+			wantConsistent: true,
+		},
+		{
+			name:           "rollover with cdnskey only",
+			first:          []dns.RR{current.ToCDNSKEY(), next.ToCDNSKEY()},
+			second:         []dns.RR{current.ToCDNSKEY(), next.ToCDNSKEY()},
+			wantRollover:   true,
+			wantConsistent: true,
+		},
+		{
+			name:           "delete",
+			first:          []dns.RR{deleteCds},
+			second:         []dns.RR{deleteCds},
+			wantDelete:     true,
+			wantConsistent: true,
+		},
+		{
+			name:           "delete with other records",
+			first:          []dns.RR{deleteCds, toCds(current)},
+			second:         []dns.RR{deleteCds, toCds(current)},
+			wantDelete:     true,
+			wantConsistent: true,
+			wantProblems:   []string{"a delete request is published together"},
+		},
+		{
+			name:         "inconsistent servers",
+			first:        []dns.RR{toCds(current)},
+			second:       []dns.RR{toCds(next)},
+			wantProblems: []string{"publish different CDS or CDNSKEY records"},
+		},
+		{
+			name:           "unknown key",
+			first:          []dns.RR{toCds(unknown), unknown.ToCDNSKEY()},
+			second:         []dns.RR{toCds(unknown), unknown.ToCDNSKEY()},
+			wantRollover:   true,
+			wantConsistent: true,
+			wantProblems: []string{
+				"the CDS record",
+				"the CDNSKEY record",
+			},
+		},
+		{
+			name:           "cds and cdnskey disagree",
+			first:          []dns.RR{toCds(current), next.ToCDNSKEY()},
+			second:         []dns.RR{toCds(current), next.ToCDNSKEY()},
+			wantConsistent: true,
+			wantProblems: []string{
+				"matches no CDNSKEY record",
+				"matches no CDS record",
+			},
+		},
+	}
+
+	resolverAddress := startUdpAndTcpServer(
+		t,
+		recordsHandler(ds, current, next),
+		recordsHandler(ds, current, next),
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			first := startUdpAndTcpServer(t, recordsHandler(tt.first...), recordsHandler(tt.first...))
+			second := startUdpAndTcpServer(t, recordsHandler(tt.second...), recordsHandler(tt.second...))
+
+			maintenance, err := CheckDsMaintenanceWithServers(
+				context.Background(),
+				"example.com",
+				&dns.Client{},
+				resolverAddress,
+				[]string{first, second},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(maintenance.Ds) != 1 || len(maintenance.Dnskeys) != 2 || len(maintenance.Servers) != 2 {
+				t.Errorf(
+					"%d DS records, %d DNSKEYs and %d servers, want 1, 2 and 2",
+					len(maintenance.Ds),
+					len(maintenance.Dnskeys),
+					len(maintenance.Servers),
+				)
+			}
+			if maintenance.Rollover != tt.wantRollover {
+				t.Errorf("Rollover = %v, want %v", maintenance.Rollover, tt.wantRollover)
+			}
+			if maintenance.Delete != tt.wantDelete {
+				t.Errorf("Delete = %v, want %v", maintenance.Delete, tt.wantDelete)
+			}
+			if maintenance.Consistent != tt.wantConsistent {
+				t.Errorf("Consistent = %v, want %v", maintenance.Consistent, tt.wantConsistent)
+			}
+
+			if len(maintenance.Problems) != len(tt.wantProblems) {
+				t.Fatalf("Problems = %q, want %d", maintenance.Problems, len(tt.wantProblems))
+			}
+			for i, want := range tt.wantProblems {
+				if !strings.Contains(maintenance.Problems[i], want) {
+					t.Errorf("Problems[%d] = %q, want it to contain %q", i, maintenance.Problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDsMaintenanceWithServers_UnreachableServer(t *testing.T) {
+	t.Parallel()
+
+	key := newTestDnskey(t)
+	resolverAddress := startUdpAndTcpServer(t, recordsHandler(key), recordsHandler(key))
+	authoritative := startUdpAndTcpServer(
+		t,
+		recordsHandler(toCds(key)),
+		recordsHandler(toCds(key)),
+	)
+	refusing := startUdpAndTcpServer(t, refusedHandler, refusedHandler)
+
+	maintenance, err := CheckDsMaintenanceWithServers(
+		context.Background(),
+		"example.com",
+		&dns.Client{},
+		resolverAddress,
+		[]string{refusing, authoritative},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if maintenance.Servers[0].Err == nil {
+		t.Error("Servers[0].Err = nil, want the error of the refusing server")
+	}
+	if len(maintenance.Cds) != 1 {
+		t.Errorf("len(Cds) = %d, want the record of the server that answered", len(maintenance.Cds))
+	}
+	if maintenance.Consistent || !maintenance.Rollover || len(maintenance.Problems) != 1 {
+		t.Errorf("maintenance = %+v, want an inconsistent rollover with one problem", maintenance)
+	}
+}
+
+func TestCheckDsMaintenanceWithServers_NoServerAnswered(t *testing.T) {
+	t.Parallel()
+
+	key := newTestDnskey(t)
+	resolverAddress := startUdpAndTcpServer(t, recordsHandler(key), recordsHandler(key))
+	refusing := startUdpAndTcpServer(t, refusedHandler, refusedHandler)
+
+	maintenance, err := CheckDsMaintenanceWithServers(
+		context.Background(),
+		"example.com",
+		&dns.Client{},
+		resolverAddress,
+		[]string{refusing},
+	)
+	if err == nil {
+		t.Fatalf("maintenance = %+v, want an error", maintenance)
+	}
+	if !errors.Is(err, dnsUtilsErrors.ErrUnsuccessfulRcode) {
+		t.Errorf("err = %v, want the error of the refusing server", err)
+	}
+}
+
+func TestGetAuthoritativeServers_SkipsFailedLookups(t *testing.T) {
+	t.Parallel()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		question := r.Question[0]
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch {
+		case question.Qtype == dns.TypeNS:
+			for _, host := range []string{"ns1.example.com.", "ns2.example.com."} {
+				m.Answer = append(m.Answer, &dns.NS{
+					Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+					Ns:  host,
+				})
+			}
+		case strings.EqualFold(question.Name, "ns1.example.com."):
+			m.Rcode = dns.RcodeServerFailure
+		case question.Qtype == dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP("192.0.2.2"),
+			})
+		}
+		_ = w.WriteMsg(m)
+	})
+	address := startUdpAndTcpServer(t, handler, handler)
+
+	addresses, err := GetAuthoritativeServers(context.Background(), "example.com", &dns.Client{}, address)
+	if !slices.Equal(addresses, []string{"192.0.2.2:53"}) {
+		t.Errorf("addresses = %v, want that of ns2", addresses)
+	}
+	if err == nil || !strings.Contains(err.Error(), "ns1.example.com.") {
+		t.Errorf("err = %v, want the failed lookups of ns1", err)
+	}
+}
+
+func refusedHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	_ = w.WriteMsg(m)
+}
+
+func TestCheckDsMaintenanceWithServers_NoServers(t *testing.T) {
+	t.Parallel()
+
+	if _, err := CheckDsMaintenanceWithServers(
+		context.Background(),
+		"example.com",
+		&dns.Client{},
+		"127.0.0.1:53",
+		nil,
+	); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,183 @@
+package dns_utils
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/miekg/dns"
+)
+
+func TestSetClientSubnet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		prefix     string
+		wantFamily uint16
+		wantBits   uint8
+		wantIp     string
+	}{
+		{name: "ipv4", prefix: "198.51.100.7/24", wantFamily: 1, wantBits: 24, wantIp: "198.51.100.0"},
+		{name: "ipv6", prefix: "2001:db8:1:2::1/56", wantFamily: 2, wantBits: 56, wantIp: "2001:db8:1::"},
+		{name: "host", prefix: "192.0.2.1/32", wantFamily: 1, wantBits: 32, wantIp: "192.0.2.1"},
+		{name: "zero length", prefix: "0.0.0.0/0", wantFamily: 1, wantBits: 0, wantIp: "0.0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetQuestion("example.com.", dns.TypeA)
+			SetClientSubnet(message, netip.MustParsePrefix(tt.prefix))
+
+			// The option must survive the wire.
+			packed, err := message.Pack()
+			if err != nil {
+				t.Fatalf("pack: %v", err)
+			}
+			unpacked := new(dns.Msg)
+			if err := unpacked.Unpack(packed); err != nil {
+				t.Fatalf("unpack: %v", err)
+			}
+
+			subnet := GetClientSubnet(unpacked)
+			if subnet == nil {
+				t.Fatal("GetClientSubnet = nil")
+			}
+			if subnet.Family != tt.wantFamily {
+				t.Errorf("Family = %d, want %d", subnet.Family, tt.wantFamily)
+			}
+			if subnet.SourceNetmask != tt.wantBits {
+				t.Errorf("SourceNetmask = %d, want %d", subnet.SourceNetmask, tt.wantBits)
+			}
+			if !subnet.Address.Equal(net.ParseIP(tt.wantIp)) {
+				t.Errorf("Address = %v, want %s", subnet.Address, tt.wantIp)
+			}
+		})
+	}
+}
+
+func TestSetClientSubnet_ReplacesTheOption(t *testing.T) {
+	t.Parallel()
+
+	message := NewQuestionMessage("example.com", dns.TypeA, 1232)
+	SetClientSubnet(message, netip.MustParsePrefix("198.51.100.0/24"))
+	SetClientSubnet(message, netip.MustParsePrefix("203.0.113.0/24"))
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		t.Fatal("no OPT record")
+	}
+	if opt.UDPSize() != 1232 {
+		t.Errorf("UDPSize = %d, want the existing 1232", opt.UDPSize())
+	}
+	if len(opt.Option) != 1 {
+		t.Fatalf("len(Option) = %d, want 1", len(opt.Option))
+	}
+	if subnet := GetClientSubnet(message); !subnet.Address.Equal(net.ParseIP("203.0.113.0")) {
+		t.Errorf("Address = %v, want 203.0.113.0", subnet.Address)
+	}
+}
+
+func TestSetClientSubnet_InvalidPrefix(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.SetQuestion("example.com.", dns.TypeA)
+	SetClientSubnet(message, netip.Prefix{})
+
+	if message.IsEdns0() != nil {
+		t.Error("an OPT record was added for an invalid prefix")
+	}
+}
+
+func TestClientSubnetFor(t *testing.T) {
+	t.Parallel()
+
+	prefix4 := netip.MustParsePrefix("198.51.100.0/24")
+	prefix6 := netip.MustParsePrefix("2001:db8::/56")
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		prefix4 netip.Prefix
+		prefix6 netip.Prefix
+		want    netip.Prefix
+	}{
+		{name: "ipv4 for A", qtype: dns.TypeA, prefix4: prefix4, prefix6: prefix6, want: prefix4},
+		{name: "ipv6 for AAAA", qtype: dns.TypeAAAA, prefix4: prefix4, prefix6: prefix6, want: prefix6},
+		{name: "ipv4 for other types", qtype: dns.TypeTXT, prefix4: prefix4, prefix6: prefix6, want: prefix4},
+		{name: "only ipv4", qtype: dns.TypeAAAA, prefix4: prefix4, want: prefix4},
+		{name: "only ipv6", qtype: dns.TypeA, prefix6: prefix6, want: prefix6},
+		{name: "none", qtype: dns.TypeA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetQuestion("example.com.", tt.qtype)
+
+			if got := ClientSubnetFor(message, tt.prefix4, tt.prefix6); got != tt.want {
+				t.Errorf("ClientSubnetFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// scopeHandler echoes the client subnet of queries with the scope set to
+// scope.
+func scopeHandler(scope uint8) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if subnet := GetClientSubnet(r); subnet != nil {
+			m.SetEdns0(dns.DefaultMsgSize, false)
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        subnet.Family,
+				SourceNetmask: subnet.SourceNetmask,
+				SourceScope:   scope,
+				Address:       subnet.Address,
+			})
+		}
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestGetDnsAnswers_WithClientSubnet(t *testing.T) {
+	t.Parallel()
+
+	address := startUdpAndTcpServer(t, scopeHandler(20), scopeHandler(20))
+
+	dnsContext := &dnsUtilsTypes.DnsContext{}
+	ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	_, err := GetDnsAnswers(
+		ctx,
+		"example.com",
+		dns.TypeA,
+		&dns.Client{},
+		address,
+		WithClientSubnet(netip.MustParsePrefix("198.51.100.0/24")),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if subnet := GetClientSubnet(dnsContext.QuestionMessage); subnet == nil || subnet.SourceNetmask != 24 {
+		t.Errorf("question client subnet = %v, want a /24", subnet)
+	}
+	if dnsContext.ClientSubnet == nil {
+		t.Fatal("DnsContext.ClientSubnet = nil")
+	}
+	if dnsContext.ClientSubnet.SourceScope != 20 {
+		t.Errorf("SourceScope = %d, want 20", dnsContext.ClientSubnet.SourceScope)
+	}
+}
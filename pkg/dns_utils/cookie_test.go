@@ -0,0 +1,99 @@
+package dns_utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetCookie(t *testing.T) {
+	t.Parallel()
+
+	clientCookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	tests := []struct {
+		name         string
+		serverCookie []byte
+	}{
+		{name: "client cookie only"},
+		{name: "with a server cookie", serverCookie: bytes.Repeat([]byte{9}, 16)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetQuestion("example.com.", dns.TypeA)
+			SetCookie(message, clientCookie, tt.serverCookie)
+
+			packed, err := message.Pack()
+			if err != nil {
+				t.Fatalf("pack: %v", err)
+			}
+			unpacked := new(dns.Msg)
+			if err := unpacked.Unpack(packed); err != nil {
+				t.Fatalf("unpack: %v", err)
+			}
+
+			gotClient, gotServer, ok := GetCookie(unpacked)
+			if !ok {
+				t.Fatal("GetCookie: not ok")
+			}
+			if !bytes.Equal(gotClient, clientCookie) {
+				t.Errorf("client cookie = %x, want %x", gotClient, clientCookie)
+			}
+			if !bytes.Equal(gotServer, tt.serverCookie) {
+				t.Errorf("server cookie = %x, want %x", gotServer, tt.serverCookie)
+			}
+		})
+	}
+}
+
+func TestGetCookie_Malformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{name: "empty", cookie: ""},
+		{name: "short client cookie", cookie: "01020304"},
+		{name: "short server cookie", cookie: "0102030405060708" + "0102"},
+		{name: "long server cookie", cookie: "0102030405060708" + string(bytes.Repeat([]byte("ab"), 33))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetEdns0(4096, false)
+			message.IsEdns0().Option = append(
+				message.IsEdns0().Option,
+				&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: tt.cookie},
+			)
+
+			if _, _, ok := GetCookie(message); ok {
+				t.Errorf("GetCookie(%q): ok, want not ok", tt.cookie)
+			}
+		})
+	}
+}
+
+func TestNewDnssecQuestionMessage_HasNoEmptyCookie(t *testing.T) {
+	t.Parallel()
+
+	message := NewDnssecQuestionMessage("example.com", dns.TypeDNSKEY)
+
+	opt := message.IsEdns0()
+	if opt == nil || !opt.Do() {
+		t.Fatal("want an OPT record with the DO bit")
+	}
+	for _, option := range opt.Option {
+		if option.Option() == dns.EDNS0COOKIE {
+			t.Errorf("unexpected cookie option %v", option)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package dns_utils
 
 import (
-	"bufio"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,8 +26,6 @@ import (
 	"github.com/miekg/dns"
 )
 
-const resolvePath = "/etc/resolv.conf"
-
 func GetFlagsFromMessage(message *dns.Msg) []string {
 	if message == nil {
 		return nil
@@ -63,34 +65,21 @@ func GetFlagsFromMessage(message *dns.Msg) []string {
 	return flags
 }
 
+// GetDnsServers returns the IP addresses of the servers in /etc/resolv.conf,
+// without their ports. ReadResolvConf returns the full configuration.
 func GetDnsServers(ctx context.Context) ([]string, error) {
-	file, err := os.Open(resolvePath)
+	resolverConfig, err := ReadResolvConf(ctx, DefaultResolvConfPath)
 	if err != nil {
-		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("os open: %w", err), resolvePath)
+		return nil, fmt.Errorf("read resolv conf: %w", err)
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			slog.WarnContext(
-				altshiftContext.WithError(
-					ctx,
-					altshiftErrors.NewWithTrace(fmt.Errorf("file close: %w", err), file),
-				),
-				"An error occurred when closing the file.",
-			)
-		}
-	}()
 
 	var dnsServers []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || line[0] == '#' || line[0] == ';' {
+	for _, nameserver := range resolverConfig.Nameservers {
+		host, _, err := net.SplitHostPort(nameserver)
+		if err != nil {
 			continue
 		}
-		fields := strings.Fields(line)
-		if len(fields) >= 2 && fields[0] == "nameserver" {
-			dnsServers = append(dnsServers, fields[1])
-		}
+		dnsServers = append(dnsServers, host)
 	}
 
 	return dnsServers, nil
@@ -213,6 +202,70 @@ func populateDnsContext(
 	dnsContext.Transport = transport
 	dnsContext.QuestionMessage = message
 	dnsContext.AnswerMessage = responseMessage
+	dnsContext.ClientSubnet = GetClientSubnet(responseMessage)
+	dnsContext.Nsid, _ = GetNsid(responseMessage)
+
+	return nil
+}
+
+// ValidateResponse checks that the response answers the query: that it is a
+// response, with the opcode of the query, and that its question section echoes
+// that of the query, comparing names case-insensitively. A response with an
+// unsuccessful rcode may have an empty question section.
+func ValidateResponse(query *dns.Msg, response *dns.Msg) error {
+	if query == nil || response == nil {
+		return nil
+	}
+
+	if !response.Response {
+		return &dnsUtilsErrors.ResponseMismatchError{Field: "qr", Query: "1", Response: "0"}
+	}
+
+	if response.Opcode != query.Opcode {
+		return &dnsUtilsErrors.ResponseMismatchError{
+			Field:    "opcode",
+			Query:    dns.OpcodeToString[query.Opcode],
+			Response: dns.OpcodeToString[response.Opcode],
+		}
+	}
+
+	if len(response.Question) == 0 && response.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+
+	if len(response.Question) != len(query.Question) {
+		return &dnsUtilsErrors.ResponseMismatchError{
+			Field:    "question count",
+			Query:    strconv.Itoa(len(query.Question)),
+			Response: strconv.Itoa(len(response.Question)),
+		}
+	}
+
+	for i, queryQuestion := range query.Question {
+		responseQuestion := response.Question[i]
+
+		if !strings.EqualFold(responseQuestion.Name, queryQuestion.Name) {
+			return &dnsUtilsErrors.ResponseMismatchError{
+				Field:    "question name",
+				Query:    queryQuestion.Name,
+				Response: responseQuestion.Name,
+			}
+		}
+		if responseQuestion.Qtype != queryQuestion.Qtype {
+			return &dnsUtilsErrors.ResponseMismatchError{
+				Field:    "question type",
+				Query:    dns.Type(queryQuestion.Qtype).String(),
+				Response: dns.Type(responseQuestion.Qtype).String(),
+			}
+		}
+		if responseQuestion.Qclass != queryQuestion.Qclass {
+			return &dnsUtilsErrors.ResponseMismatchError{
+				Field:    "question class",
+				Query:    dns.Class(queryQuestion.Qclass).String(),
+				Response: dns.Class(responseQuestion.Qclass).String(),
+			}
+		}
+	}
 
 	return nil
 }
@@ -270,10 +323,19 @@ func ExchangeWithConn(ctx context.Context, message *dns.Msg, client *dns.Client,
 		)
 	}
 
+	// Reject a response that does not answer the query, such as one from a
+	// misbehaving middlebox or a spoofed one.
+	if err := ValidateResponse(message, responseMessage); err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("validate response: %w", err),
+		)
+	}
+
 	if responseMessage.Rcode != dns.RcodeSuccess {
 		return responseMessage, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			&dnsUtilsErrors.RcodeError{Rcode: responseMessage.Rcode},
+			dnsUtilsErrors.NewRcodeError(responseMessage),
 		)
 	}
 
@@ -324,7 +386,8 @@ func Exchange(ctx context.Context, message *dns.Msg, client *dns.Client, serverA
 
 	responseMessage, err := ExchangeWithConn(ctxForExchange, message, client, connection)
 	if err != nil {
-		return nil, altshiftErrors.NewWithTraceCtx(
+		// An unsuccessful rcode comes with the response; pass it on.
+		return responseMessage, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
 			fmt.Errorf("exchange with conn: %w", err),
 		)
@@ -336,7 +399,408 @@ func Exchange(ctx context.Context, message *dns.Msg, client *dns.Client, serverA
 	return responseMessage, nil
 }
 
-func GetDnsAnswersWithMessage(ctx context.Context, message *dns.Msg, client *dns.Client, serverAddress string) ([]dns.RR, error) {
+// CaseRandomization selects whether, and how, the letter case of query names
+// is randomized to detect spoofed responses (DNS 0x20).
+type CaseRandomization int
+
+const (
+	CaseRandomizationOff CaseRandomization = iota
+	// CaseRandomizationRetryTcp retries an exchange over TCP when the response
+	// does not preserve the case of the query name.
+	CaseRandomizationRetryTcp
+	// CaseRandomizationFail fails an exchange with an *errors.SpoofingError
+	// when the response does not preserve the case of the query name.
+	CaseRandomizationFail
+)
+
+// RandomizeCase returns the name with the case of each letter chosen at
+// random.
+func RandomizeCase(name string) string {
+	randomBytes := make([]byte, len(name))
+	_, _ = rand.Read(randomBytes)
+
+	nameBytes := []byte(name)
+	for i, b := range nameBytes {
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') {
+			if randomBytes[i]&1 == 0 {
+				nameBytes[i] = b | 0x20
+			} else {
+				nameBytes[i] = b &^ 0x20
+			}
+		}
+	}
+
+	return string(nameBytes)
+}
+
+// Exchanger exchanges messages using a dns.Client: over UDP, TCP or, with a
+// "tcp-tls" client, DNS-over-TLS. A truncated UDP response is retried over
+// TCP.
+type Exchanger struct {
+	Client *dns.Client
+	// CaseRandomization applies to exchanges over UDP, where responses are
+	// easiest to spoof.
+	CaseRandomization CaseRandomization
+	// ClientSubnet4 and ClientSubnet6 are sent as the EDNS Client Subnet option
+	// of queries that do not have one already, as chosen by ClientSubnetFor.
+	ClientSubnet4 netip.Prefix
+	ClientSubnet6 netip.Prefix
+}
+
+type ExchangerOption func(*Exchanger)
+
+func WithCaseRandomization(caseRandomization CaseRandomization) ExchangerOption {
+	return func(exchanger *Exchanger) {
+		exchanger.CaseRandomization = caseRandomization
+	}
+}
+
+// WithClientSubnet sends the prefixes as the EDNS Client Subnet option (RFC
+// 7871), for example 198.51.100.0/24 and 2001:db8::/56; at most one of each
+// address family, the last one given.
+func WithClientSubnet(prefixes ...netip.Prefix) ExchangerOption {
+	return func(exchanger *Exchanger) {
+		for _, prefix := range prefixes {
+			if prefix.Addr().Is4() {
+				exchanger.ClientSubnet4 = prefix
+			} else if prefix.IsValid() {
+				exchanger.ClientSubnet6 = prefix
+			}
+		}
+	}
+}
+
+func isUdp(client *dns.Client) bool {
+	return client != nil && !strings.HasPrefix(client.Net, "tcp")
+}
+
+// preservesCase reports whether the question name of the response is exactly
+// that of the query.
+func preservesCase(query *dns.Msg, response *dns.Msg) bool {
+	return len(response.Question) == 1 && response.Question[0].Name == query.Question[0].Name
+}
+
+func (e *Exchanger) Exchange(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error) {
+	var client *dns.Client
+	var caseRandomization CaseRandomization
+	if e != nil {
+		client = e.Client
+		caseRandomization = e.CaseRandomization
+
+		clientSubnet := ClientSubnetFor(message, e.ClientSubnet4, e.ClientSubnet6)
+		if clientSubnet.IsValid() && GetClientSubnet(message) == nil {
+			message = message.Copy()
+			SetClientSubnet(message, clientSubnet)
+		}
+	}
+
+	var tcpDnsClient *dns.Client
+	if isUdp(client) {
+		tcpDnsClient = new(dns.Client)
+		*tcpDnsClient = *client
+		tcpDnsClient.Net = "tcp"
+	}
+
+	query := message
+	randomized := caseRandomization != CaseRandomizationOff && tcpDnsClient != nil &&
+		message != nil && len(message.Question) == 1
+	if randomized {
+		query = message.Copy()
+		query.Question[0].Name = RandomizeCase(message.Question[0].Name)
+	}
+
+	responseMessage, err := Exchange(ctx, query, client, serverAddress)
+
+	// Servers answer some errors without a question section. Such a response
+	// cannot be compared with the query; its rcode is passed on.
+	if randomized && responseMessage != nil && len(responseMessage.Question) != 0 {
+		if !preservesCase(query, responseMessage) {
+			if caseRandomization == CaseRandomizationFail {
+				return nil, altshiftErrors.NewWithTraceCtx(
+					ctx,
+					&dnsUtilsErrors.SpoofingError{
+						Query:    query.Question[0].Name,
+						Response: responseMessage.Question[0].Name,
+					},
+				)
+			}
+			return Exchange(ctx, message, tcpDnsClient, serverAddress)
+		}
+
+		// Give the caller back the name it asked for, also in the recorded
+		// query.
+		responseMessage.Question[0].Name = message.Question[0].Name
+		if dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext); ok && dnsContext != nil {
+			dnsContext.QuestionMessage = message
+		}
+	}
+
+	if err != nil {
+		return responseMessage, err
+	}
+
+	if responseMessage != nil && responseMessage.Truncated && tcpDnsClient != nil {
+		return Exchange(ctx, message, tcpDnsClient, serverAddress)
+	}
+
+	return responseMessage, nil
+}
+
+// NewQuestionMessage returns a recursive query for the domain and record type.
+// A non-zero udpSize is advertised as the EDNS(0) buffer size.
+func NewQuestionMessage(domain string, recordType uint16, udpSize uint16) *dns.Msg {
+	message := &dns.Msg{}
+	message.SetQuestion(dns.Fqdn(domain), recordType)
+
+	if udpSize > 0 {
+		message.SetEdns0(udpSize, false)
+	}
+
+	return message
+}
+
+// NewDnssecQuestionMessage returns a query for the domain and record type that
+// asks for DNSSEC records (the DO bit).
+func NewDnssecQuestionMessage(domain string, recordType uint16) *dns.Msg {
+	message := new(dns.Msg)
+	message.SetQuestion(dns.Fqdn(domain), recordType)
+
+	opt := &dns.OPT{
+		Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT, Class: 4096},
+	}
+	opt.SetDo()
+
+	message.Extra = append(message.Extra, opt)
+
+	return message
+}
+
+// SetClientSubnet sets the EDNS Client Subnet option of the message to the
+// prefix, which is masked to its length (RFC 7871). An OPT record is added if
+// the message does not have one. An invalid prefix leaves the message as is.
+func SetClientSubnet(message *dns.Msg, prefix netip.Prefix) {
+	if message == nil || !prefix.IsValid() {
+		return
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		message.SetEdns0(dns.DefaultMsgSize, false)
+		opt = message.IsEdns0()
+	}
+
+	prefix = prefix.Masked()
+	address := prefix.Addr()
+
+	subnet := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: uint8(prefix.Bits()),
+		Address:       address.AsSlice(),
+	}
+	if address.Is6() {
+		subnet.Family = 2
+	}
+
+	options := slices.DeleteFunc(opt.Option, func(option dns.EDNS0) bool {
+		return option.Option() == dns.EDNS0SUBNET
+	})
+	opt.Option = append(options, subnet)
+}
+
+// ClientSubnetFor returns which of an IPv4 and an IPv6 prefix to send as the
+// EDNS Client Subnet option of the message: the IPv6 one for AAAA queries and
+// the IPv4 one for the others or, when only one is valid, that one. A server
+// may refuse a family it does not support with FORMERR, which is why a prefix
+// of each can be configured. The returned prefix is invalid when neither is
+// valid or the message is nil.
+func ClientSubnetFor(message *dns.Msg, prefix4 netip.Prefix, prefix6 netip.Prefix) netip.Prefix {
+	if message == nil {
+		return netip.Prefix{}
+	}
+
+	preferred, other := prefix4, prefix6
+	if len(message.Question) == 1 && message.Question[0].Qtype == dns.TypeAAAA {
+		preferred, other = prefix6, prefix4
+	}
+
+	if preferred.IsValid() {
+		return preferred
+	}
+	return other
+}
+
+// GetClientSubnet returns the EDNS Client Subnet option of the message, or nil
+// if it has none. In a response, its SourceScope is the length of the prefix
+// that the answer is valid for.
+func GetClientSubnet(message *dns.Msg) *dns.EDNS0_SUBNET {
+	if message == nil {
+		return nil
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+
+	return nil
+}
+
+// RequestNsid adds an empty NSID option to the message, which asks the server
+// to identify itself (RFC 5001). An OPT record is added if the message does
+// not have one.
+func RequestNsid(message *dns.Msg) {
+	if message == nil {
+		return
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		message.SetEdns0(dns.DefaultMsgSize, false)
+		opt = message.IsEdns0()
+	}
+
+	for _, option := range opt.Option {
+		if option.Option() == dns.EDNS0NSID {
+			return
+		}
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+}
+
+// GetExtendedErrors returns the Extended DNS Errors of the message (RFC 8914),
+// of which there may be several, or nil if it has none.
+func GetExtendedErrors(message *dns.Msg) []*dnsUtilsErrors.ExtendedDnsError {
+	return dnsUtilsErrors.NewExtendedDnsErrors(message)
+}
+
+// GetNsid returns the NSID of the message, decoded as text if it is printable
+// ASCII and in hex otherwise. It reports false if the message has no NSID
+// option or the option is empty.
+func GetNsid(message *dns.Msg) (string, bool) {
+	if message == nil {
+		return "", false
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		return "", false
+	}
+
+	for _, option := range opt.Option {
+		nsidOption, ok := option.(*dns.EDNS0_NSID)
+		if !ok {
+			continue
+		}
+
+		nsid, err := hex.DecodeString(nsidOption.Nsid)
+		if err != nil || len(nsid) == 0 {
+			return "", false
+		}
+
+		for _, b := range nsid {
+			if b < 0x20 || b > 0x7e {
+				return hex.EncodeToString(nsid), true
+			}
+		}
+
+		return string(nsid), true
+	}
+
+	return "", false
+}
+
+// The lengths of DNS Cookies (RFC 7873 section 4).
+const (
+	ClientCookieLength    = 8
+	minServerCookieLength = 8
+	maxServerCookieLength = 32
+)
+
+// SetCookie sets the DNS Cookie option of the message to the client cookie and,
+// if not empty, the server cookie (RFC 7873). An OPT record is added if the
+// message does not have one.
+func SetCookie(message *dns.Msg, clientCookie []byte, serverCookie []byte) {
+	if message == nil || len(clientCookie) != ClientCookieLength {
+		return
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		message.SetEdns0(dns.DefaultMsgSize, false)
+		opt = message.IsEdns0()
+	}
+
+	cookie := &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: hex.EncodeToString(clientCookie) + hex.EncodeToString(serverCookie),
+	}
+
+	options := slices.DeleteFunc(opt.Option, func(option dns.EDNS0) bool {
+		return option.Option() == dns.EDNS0COOKIE
+	})
+	opt.Option = append(options, cookie)
+}
+
+// GetCookie returns the client cookie and the server cookie, which is empty if
+// there is none, of the DNS Cookie option of the message. It reports false if
+// the message has no such option or it is malformed.
+func GetCookie(message *dns.Msg) ([]byte, []byte, bool) {
+	if message == nil {
+		return nil, nil, false
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		return nil, nil, false
+	}
+
+	for _, option := range opt.Option {
+		cookieOption, ok := option.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+
+		cookie, err := hex.DecodeString(cookieOption.Cookie)
+		if err != nil || len(cookie) < ClientCookieLength {
+			return nil, nil, false
+		}
+
+		clientCookie, serverCookie := cookie[:ClientCookieLength], cookie[ClientCookieLength:]
+		if len(serverCookie) != 0 &&
+			(len(serverCookie) < minServerCookieLength || len(serverCookie) > maxServerCookieLength) {
+			return nil, nil, false
+		}
+
+		return clientCookie, serverCookie, true
+	}
+
+	return nil, nil, false
+}
+
+// ContainsDnskey reports whether the records include a DNSKEY.
+func ContainsDnskey(records []dns.RR) bool {
+	for _, record := range records {
+		if _, ok := record.(*dns.DNSKEY); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func GetDnsAnswersWithMessage(
+	ctx context.Context,
+	message *dns.Msg,
+	client *dns.Client,
+	serverAddress string,
+	options ...ExchangerOption,
+) ([]dns.RR, error) {
 	if message == nil {
 		return nil, nil
 	}
@@ -361,24 +825,17 @@ func GetDnsAnswersWithMessage(ctx context.Context, message *dns.Msg, client *dns
 
 	ctxForExchange := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
 
-	responseMessage, err := Exchange(ctxForExchange, message, client, serverAddress)
-	if err != nil {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("exchange: %w", err))
-	}
-	if responseMessage == nil {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("response message"))
-	}
-
-	if responseMessage.Truncated {
-		tcpDnsClient := *client
-		tcpDnsClient.Net = "tcp"
-
-		responseMessage, err = Exchange(ctxForExchange, message, &tcpDnsClient, serverAddress)
-		if err != nil {
-			return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("exchange: %w", err))
+	exchanger := &Exchanger{Client: client}
+	for _, option := range options {
+		if option != nil {
+			option(exchanger)
 		}
 	}
 
+	responseMessage, err := exchanger.Exchange(ctxForExchange, message, serverAddress)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("exchanger exchange: %w", err))
+	}
 	if responseMessage == nil {
 		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("response message"))
 	}
@@ -392,6 +849,7 @@ func GetDnsAnswers(
 	recordType uint16,
 	client *dns.Client,
 	serverAddress string,
+	options ...ExchangerOption,
 ) ([]dns.RR, error) {
 	if domain == "" {
 		return nil, nil
@@ -418,19 +876,16 @@ func GetDnsAnswers(
 		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
 	}
 
-	message := &dns.Msg{}
-	message.SetQuestion(dns.Fqdn(domain), recordType)
-
-	if client.Net == "" || client.Net == "udp" {
-		if bufferSize := client.UDPSize; bufferSize > 0 {
-			message.SetEdns0(bufferSize, false)
-		}
+	var udpSize uint16
+	if isUdp(client) {
+		udpSize = client.UDPSize
 	}
+	message := NewQuestionMessage(domain, recordType, udpSize)
 
 	dnsContext.QuestionMessage = message
 	ctxForDownstream := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
 
-	answers, err := GetDnsAnswersWithMessage(ctxForDownstream, message, client, serverAddress)
+	answers, err := GetDnsAnswersWithMessage(ctxForDownstream, message, client, serverAddress, options...)
 	if err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
@@ -458,6 +913,8 @@ func GetAnswerString(answer dns.RR) string {
 		return strings.Join(typedAnswer.Txt, "")
 	case *dns.CNAME:
 		return typedAnswer.Target
+	case *dns.PTR:
+		return typedAnswer.Ptr
 	case *dns.HTTPS:
 		return strings.TrimPrefix(typedAnswer.String(), typedAnswer.Hdr.String())
 	}
@@ -630,16 +1087,7 @@ func SupportsDnssec(ctx context.Context, domain string, client *dns.Client, serv
 		return false, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
 	}
 
-	message := new(dns.Msg)
-	message.SetQuestion(dns.Fqdn(domain), dns.TypeDNSKEY)
-
-	opt := &dns.OPT{
-		Hdr:    dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT, Class: 4096},
-		Option: []dns.EDNS0{&dns.EDNS0_COOKIE{}},
-	}
-	opt.SetDo()
-
-	message.Extra = append(message.Extra, opt)
+	message := NewDnssecQuestionMessage(domain, dns.TypeDNSKEY)
 
 	dnsContext.QuestionMessage = message
 	ctxForDownstream := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
@@ -652,13 +1100,5 @@ func SupportsDnssec(ctx context.Context, domain string, client *dns.Client, serv
 		)
 	}
 
-	dnssecSupported := false
-	for _, answer := range answers {
-		if _, ok := answer.(*dns.DNSKEY); ok {
-			dnssecSupported = true
-			break
-		}
-	}
-
-	return dnssecSupported, nil
+	return ContainsDnskey(answers), nil
 }
@@ -225,6 +225,11 @@ func TestGetAnswerString(t *testing.T) {
 			rr:   &dns.TXT{Txt: []string{"hello", "world"}},
 			want: "helloworld",
 		},
+		{
+			name: "PTR",
+			rr:   &dns.PTR{Ptr: "host.example.com."},
+			want: "host.example.com.",
+		},
 		{
 			name: "CNAME",
 			rr:   &dns.CNAME{Target: "alias.example.com."},
@@ -674,3 +679,31 @@ func TestSupportsDnssec_Error_AttachesDnsContext(t *testing.T) {
 		t.Errorf("DnsContext.ServerAddress = %q, want %q", dnsCtx.ServerAddress, "1.2.3.4:53")
 	}
 }
+
+func TestGetExtendedErrors(t *testing.T) {
+	t.Parallel()
+
+	if got := GetExtendedErrors(new(dns.Msg)); got != nil {
+		t.Errorf("GetExtendedErrors without OPT = %v, want nil", got)
+	}
+
+	message := new(dns.Msg)
+	message.Rcode = dns.RcodeServerFailure
+	message.SetEdns0(dns.DefaultMsgSize, false)
+	message.IsEdns0().Option = append(
+		message.IsEdns0().Option,
+		&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus},
+		&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeSignatureExpired, ExtraText: "expired"},
+	)
+
+	got := GetExtendedErrors(message)
+	if len(got) != 2 {
+		t.Fatalf("len(GetExtendedErrors) = %d, want 2", len(got))
+	}
+	if got[0].InfoCode != dns.ExtendedErrorCodeDNSBogus || got[0].Rcode != dns.RcodeServerFailure {
+		t.Errorf("first extended error = %+v", got[0])
+	}
+	if got[1].InfoCode != dns.ExtendedErrorCodeSignatureExpired || got[1].ExtraText != "expired" {
+		t.Errorf("second extended error = %+v", got[1])
+	}
+}
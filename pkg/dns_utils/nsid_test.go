@@ -0,0 +1,64 @@
+package dns_utils
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRequestNsid(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.SetQuestion("example.com.", dns.TypeA)
+	RequestNsid(message)
+	RequestNsid(message)
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		t.Fatal("no OPT record")
+	}
+	if len(opt.Option) != 1 || opt.Option[0].Option() != dns.EDNS0NSID {
+		t.Errorf("Option = %v, want one NSID option", opt.Option)
+	}
+	if _, err := message.Pack(); err != nil {
+		t.Errorf("pack: %v", err)
+	}
+}
+
+func TestGetNsid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		nsid   []byte
+		want   string
+		wantOk bool
+	}{
+		{name: "empty"},
+		{name: "text", nsid: []byte("ams01.example"), want: "ams01.example", wantOk: true},
+		{name: "binary", nsid: []byte{0x00, 0xff, 0x10}, want: "00ff10", wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetEdns0(4096, false)
+			message.IsEdns0().Option = append(
+				message.IsEdns0().Option,
+				&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString(tt.nsid)},
+			)
+
+			got, ok := GetNsid(message)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
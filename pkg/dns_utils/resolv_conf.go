@@ -0,0 +1,240 @@
+package dns_utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+)
+
+const (
+	DefaultResolvConfPath = "/etc/resolv.conf"
+	DefaultNameserverPort = "53"
+)
+
+// The defaults and limits of the resolv.conf options, as in glibc.
+const (
+	DefaultNdots    = 1
+	DefaultTimeout  = 5 * time.Second
+	DefaultAttempts = 2
+
+	maxNdots    = 15
+	maxTimeout  = 30 * time.Second
+	maxAttempts = 5
+)
+
+// ResolverConfig is the configuration of the system stub resolver, as read from
+// resolv.conf (resolv.conf(5)).
+type ResolverConfig struct {
+	// Nameservers are the addresses of the servers, as host:port. A server
+	// given without a port gets port 53; an IPv6 zone is kept.
+	Nameservers []string
+	// Search is the list of domains to append to names with fewer than Ndots
+	// dots. It is set by the last "search" or "domain" line.
+	Search []string
+	// Ndots is the number of dots a name must have to be tried as is before
+	// the search list.
+	Ndots int
+	// Timeout is how long to wait for a response from a server.
+	Timeout time.Duration
+	// Attempts is how many times the servers are tried.
+	Attempts int
+	// Rotate spreads the queries over the servers rather than always starting
+	// with the first.
+	Rotate bool
+	// Edns0 enables EDNS(0) (RFC 6891).
+	Edns0 bool
+	// UseVc makes the queries go over TCP.
+	UseVc bool
+	// TrustAd makes the AD bit of responses trusted, and set in queries.
+	TrustAd bool
+	// Sortlist orders the addresses of responses by the network they are in.
+	Sortlist []netip.Prefix
+}
+
+// parseNameserver returns the address of a server as host:port. Besides a bare
+// IP address, it accepts a bracketed IPv6 address or an IPv4 address followed
+// by a port.
+func parseNameserver(value string) (string, bool) {
+	port := DefaultNameserverPort
+
+	host := value
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		host = value[1 : len(value)-1]
+	} else if strings.HasPrefix(value, "[") || strings.Count(value, ":") == 1 {
+		var err error
+		host, port, err = net.SplitHostPort(value)
+		if err != nil {
+			return "", false
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", false
+		}
+	}
+
+	address, err := netip.ParseAddr(host)
+	if err != nil {
+		return "", false
+	}
+
+	return net.JoinHostPort(address.String(), port), true
+}
+
+// parseSortlistEntry parses an address with an optional mask, which can be
+// written as a netmask or as a prefix length.
+func parseSortlistEntry(value string) (netip.Prefix, bool) {
+	host, mask, hasMask := strings.Cut(value, "/")
+
+	address, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+
+	bits := address.BitLen()
+	if hasMask {
+		if maskAddress, err := netip.ParseAddr(mask); err == nil {
+			if maskAddress.BitLen() != address.BitLen() {
+				return netip.Prefix{}, false
+			}
+			ones, size := net.IPMask(maskAddress.AsSlice()).Size()
+			if size == 0 {
+				// The mask is not contiguous.
+				return netip.Prefix{}, false
+			}
+			bits = ones
+		} else if bits, err = strconv.Atoi(mask); err != nil {
+			return netip.Prefix{}, false
+		}
+	}
+
+	prefix, err := address.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+
+	return prefix, true
+}
+
+// parseOption applies an "options" value, ignoring unknown options and values
+// that do not parse, as the resolver does. Values beyond a limit are capped.
+func (c *ResolverConfig) parseOption(option string) {
+	name, value, _ := strings.Cut(option, ":")
+
+	switch name {
+	case "ndots":
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			c.Ndots = min(n, maxNdots)
+		}
+	case "timeout":
+		if n, err := strconv.Atoi(value); err == nil && n >= 1 {
+			c.Timeout = min(time.Duration(n)*time.Second, maxTimeout)
+		}
+	case "attempts":
+		if n, err := strconv.Atoi(value); err == nil && n >= 1 {
+			c.Attempts = min(n, maxAttempts)
+		}
+	case "rotate":
+		c.Rotate = true
+	case "edns0":
+		c.Edns0 = true
+	case "use-vc":
+		c.UseVc = true
+	case "trust-ad":
+		c.TrustAd = true
+	}
+}
+
+// ParseResolvConf parses a resolv.conf file. Lines that are not understood are
+// ignored, as by the resolver.
+func ParseResolvConf(reader io.Reader) (*ResolverConfig, error) {
+	resolverConfig := &ResolverConfig{
+		Ndots:    DefaultNdots,
+		Timeout:  DefaultTimeout,
+		Attempts: DefaultAttempts,
+	}
+
+	if reader == nil {
+		return resolverConfig, nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		keyword, values := fields[0], fields[1:]
+
+		switch keyword {
+		case "nameserver":
+			if len(values) == 0 {
+				continue
+			}
+			if nameserver, ok := parseNameserver(values[0]); ok {
+				resolverConfig.Nameservers = append(resolverConfig.Nameservers, nameserver)
+			}
+		case "domain":
+			// "domain" and "search" override each other.
+			if len(values) != 0 {
+				resolverConfig.Search = []string{values[0]}
+			}
+		case "search":
+			resolverConfig.Search = values
+		case "options":
+			for _, option := range values {
+				resolverConfig.parseOption(option)
+			}
+		case "sortlist":
+			var sortlist []netip.Prefix
+			for _, value := range values {
+				if prefix, ok := parseSortlistEntry(value); ok {
+					sortlist = append(sortlist, prefix)
+				}
+			}
+			resolverConfig.Sortlist = sortlist
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("scanner scan: %w", err))
+	}
+
+	return resolverConfig, nil
+}
+
+// ReadResolvConf reads and parses the resolv.conf file at the path.
+func ReadResolvConf(ctx context.Context, path string) (*ResolverConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("os open: %w", err), path)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.WarnContext(
+				altshiftContext.WithError(
+					ctx,
+					altshiftErrors.NewWithTrace(fmt.Errorf("file close: %w", err), file),
+				),
+				"An error occurred when closing the file.",
+			)
+		}
+	}()
+
+	resolverConfig, err := ParseResolvConf(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse resolv conf: %w", err)
+	}
+
+	return resolverConfig, nil
+}
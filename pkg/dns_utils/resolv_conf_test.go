@@ -0,0 +1,156 @@
+package dns_utils
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	t.Parallel()
+
+	defaults := func(modify func(*ResolverConfig)) *ResolverConfig {
+		resolverConfig := &ResolverConfig{Ndots: DefaultNdots, Timeout: DefaultTimeout, Attempts: DefaultAttempts}
+		if modify != nil {
+			modify(resolverConfig)
+		}
+		return resolverConfig
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  *ResolverConfig
+	}{
+		{name: "empty", input: "", want: defaults(nil)},
+		{
+			name: "nameservers",
+			input: strings.Join(
+				[]string{
+					"# comment",
+					"; comment",
+					"nameserver 192.0.2.1",
+					"nameserver 2001:db8::1",
+					"nameserver fe80::1%eth0",
+					"nameserver [2001:db8::2]:5353",
+					"nameserver [2001:db8::3]",
+					"nameserver 192.0.2.2:5353",
+					"nameserver",
+					"nameserver dns.example.com",
+					"nameserver 192.0.2.3:port",
+					"  nameserver   192.0.2.4  ",
+				},
+				"\n",
+			),
+			want: defaults(func(c *ResolverConfig) {
+				c.Nameservers = []string{
+					"192.0.2.1:53",
+					"[2001:db8::1]:53",
+					"[fe80::1%eth0]:53",
+					"[2001:db8::2]:5353",
+					"[2001:db8::3]:53",
+					"192.0.2.2:5353",
+					"192.0.2.4:53",
+				}
+			}),
+		},
+		{
+			name:  "search",
+			input: "search example.com example.org",
+			want:  defaults(func(c *ResolverConfig) { c.Search = []string{"example.com", "example.org"} }),
+		},
+		{
+			name:  "the last of domain and search wins",
+			input: "search example.com example.org\ndomain example.net",
+			want:  defaults(func(c *ResolverConfig) { c.Search = []string{"example.net"} }),
+		},
+		{
+			name:  "options",
+			input: "options ndots:2 timeout:3 attempts:4 rotate edns0 use-vc trust-ad unknown",
+			want: defaults(func(c *ResolverConfig) {
+				c.Ndots = 2
+				c.Timeout = 3 * time.Second
+				c.Attempts = 4
+				c.Rotate = true
+				c.Edns0 = true
+				c.UseVc = true
+				c.TrustAd = true
+			}),
+		},
+		{
+			name:  "options are capped",
+			input: "options ndots:20 timeout:60 attempts:10",
+			want: defaults(func(c *ResolverConfig) {
+				c.Ndots = maxNdots
+				c.Timeout = maxTimeout
+				c.Attempts = maxAttempts
+			}),
+		},
+		{
+			name:  "invalid option values are ignored",
+			input: "options ndots:-1 timeout:0 attempts:x",
+			want:  defaults(nil),
+		},
+		{
+			name:  "options over several lines",
+			input: "options ndots:2\noptions rotate\noptions ndots:3",
+			want: defaults(func(c *ResolverConfig) {
+				c.Ndots = 3
+				c.Rotate = true
+			}),
+		},
+		{
+			name:  "sortlist",
+			input: "sortlist 130.155.160.0/255.255.240.0 130.155.0.0 10.0.0.0/8 2001:db8::/32 10.0.0.0/255.0.255.0 junk",
+			want: defaults(func(c *ResolverConfig) {
+				c.Sortlist = []netip.Prefix{
+					netip.MustParsePrefix("130.155.160.0/20"),
+					netip.MustParsePrefix("130.155.0.0/32"),
+					netip.MustParsePrefix("10.0.0.0/8"),
+					netip.MustParsePrefix("2001:db8::/32"),
+				}
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseResolvConf(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadResolvConf(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte("nameserver 192.0.2.1\noptions rotate\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	got, err := ReadResolvConf(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Nameservers, []string{"192.0.2.1:53"}) || !got.Rotate {
+		t.Errorf("got = %+v", got)
+	}
+
+	if _, err := ReadResolvConf(context.Background(), filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,135 @@
+package dns_utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+func TestValidateResponse(t *testing.T) {
+	t.Parallel()
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	reply := func(modify func(response *dns.Msg)) *dns.Msg {
+		response := new(dns.Msg)
+		response.SetReply(query)
+		modify(response)
+		return response
+	}
+
+	tests := []struct {
+		name      string
+		response  *dns.Msg
+		wantField string
+	}{
+		{name: "a matching response", response: reply(func(*dns.Msg) {})},
+		{
+			name:     "the name is compared case-insensitively",
+			response: reply(func(response *dns.Msg) { response.Question[0].Name = "EXAMPLE.com." }),
+		},
+		{
+			name: "an error without a question",
+			response: reply(func(response *dns.Msg) {
+				response.Rcode = dns.RcodeFormatError
+				response.Question = nil
+			}),
+		},
+		{
+			name:      "not a response",
+			response:  reply(func(response *dns.Msg) { response.Response = false }),
+			wantField: "qr",
+		},
+		{
+			name:      "another opcode",
+			response:  reply(func(response *dns.Msg) { response.Opcode = dns.OpcodeNotify }),
+			wantField: "opcode",
+		},
+		{
+			name:      "a success without a question",
+			response:  reply(func(response *dns.Msg) { response.Question = nil }),
+			wantField: "question count",
+		},
+		{
+			name:      "another name",
+			response:  reply(func(response *dns.Msg) { response.Question[0].Name = "example.org." }),
+			wantField: "question name",
+		},
+		{
+			name:      "another type",
+			response:  reply(func(response *dns.Msg) { response.Question[0].Qtype = dns.TypeAAAA }),
+			wantField: "question type",
+		},
+		{
+			name:      "another class",
+			response:  reply(func(response *dns.Msg) { response.Question[0].Qclass = dns.ClassCHAOS }),
+			wantField: "question class",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateResponse(query, tt.response)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			mismatchError, ok := errors.AsType[*dnsUtilsErrors.ResponseMismatchError](err)
+			if !ok {
+				t.Fatalf("err = %v, want a *ResponseMismatchError", err)
+			}
+			if mismatchError.Field != tt.wantField {
+				t.Errorf("Field = %q, want %q", mismatchError.Field, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestExchangeWithConn_RejectsAMismatchedResponse(t *testing.T) {
+	t.Parallel()
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen packet: %v", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: packetConn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Question[0].Name = "spoofed.example."
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	client := &dns.Client{}
+	connection, err := client.Dial(packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = connection.Close() })
+
+	message := new(dns.Msg)
+	message.SetQuestion("example.com.", dns.TypeA)
+
+	response, err := ExchangeWithConn(context.Background(), message, client, connection)
+	if !errors.Is(err, dnsUtilsErrors.ErrResponseMismatch) {
+		t.Fatalf("err = %v, want ErrResponseMismatch", err)
+	}
+	if response != nil {
+		t.Error("response != nil, want nil")
+	}
+}
@@ -0,0 +1,287 @@
+package dnssec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/miekg/dns"
+)
+
+// DefaultMaxNsec3Iterations is the largest number of additional NSEC3 hash
+// iterations that is accepted; proofs with more are treated as insecure, as
+// RFC 9276 section 3.2 allows.
+const DefaultMaxNsec3Iterations = 150
+
+// WithMaxNsec3Iterations sets the largest number of additional NSEC3 hash
+// iterations that is accepted.
+func WithMaxNsec3Iterations(maxNsec3Iterations uint16) Option {
+	return func(validator *Validator) {
+		validator.maxNsec3Iterations = maxNsec3Iterations
+	}
+}
+
+// commonAncestor returns the longest name that both names are at or below.
+func commonAncestor(a string, b string) string {
+	aLabels := dns.SplitDomainName(dns.CanonicalName(a))
+	bLabels := dns.SplitDomainName(dns.CanonicalName(b))
+
+	var common []string
+	for i, j := len(aLabels)-1, len(bLabels)-1; i >= 0 && j >= 0 && aLabels[i] == bLabels[j]; i, j = i-1, j-1 {
+		common = append([]string{aLabels[i]}, common...)
+	}
+
+	return dns.Fqdn(strings.Join(common, "."))
+}
+
+// ancestor returns the ancestor of the name with the number of labels.
+func ancestor(name string, labels int) string {
+	nameLabels := dns.SplitDomainName(name)
+	if labels >= len(nameLabels) {
+		return dns.Fqdn(name)
+	}
+	return dns.Fqdn(strings.Join(nameLabels[len(nameLabels)-labels:], "."))
+}
+
+// nsecDenial checks an NSEC proof of non-existence (RFC 4035 section 5.4): an
+// NSEC record covers the name, and one covers the wildcard at its closest
+// encloser.
+func nsecDenial(denial *dnsUtilsDnssecTypes.Denial, records []*dns.NSEC) {
+	var covering *dns.NSEC
+	for _, nsec := range records {
+		if equalNames(nsec.Hdr.Name, denial.Name) {
+			denial.Status = dnsUtilsDnssecTypes.StatusBogus
+			denial.Reason = fmt.Sprintf("an NSEC record shows that %s exists", denial.Name)
+			return
+		}
+		if coversNsec(nsec, denial.Name) {
+			covering = nsec
+		}
+	}
+	if covering == nil {
+		denial.Status = dnsUtilsDnssecTypes.StatusBogus
+		denial.Reason = fmt.Sprintf("no NSEC record covers %s", denial.Name)
+		return
+	}
+
+	closestEncloser := commonAncestor(denial.Name, covering.Hdr.Name)
+	if nextAncestor := commonAncestor(denial.Name, covering.NextDomain); dns.CountLabel(nextAncestor) > dns.CountLabel(closestEncloser) {
+		closestEncloser = nextAncestor
+	}
+	denial.ClosestEncloser = closestEncloser
+
+	wildcard := "*." + closestEncloser
+	if closestEncloser == "." {
+		wildcard = "*."
+	}
+	for _, nsec := range records {
+		if equalNames(nsec.Hdr.Name, wildcard) {
+			denial.Status = dnsUtilsDnssecTypes.StatusBogus
+			denial.Reason = fmt.Sprintf("an NSEC record shows that the wildcard %s exists", wildcard)
+			return
+		}
+	}
+	for _, nsec := range records {
+		if coversNsec(nsec, wildcard) {
+			denial.Status = dnsUtilsDnssecTypes.StatusSecure
+			denial.Proven = true
+			return
+		}
+	}
+
+	denial.Status = dnsUtilsDnssecTypes.StatusBogus
+	denial.Reason = fmt.Sprintf("no NSEC record covers the wildcard %s", wildcard)
+}
+
+// nsec3Denial checks an NSEC3 proof of non-existence (RFC 5155 section 8.4):
+// an NSEC3 record matches the closest encloser, one covers the next closer
+// name and one covers the wildcard at the closest encloser. When the record
+// that covers the next closer name has the opt-out flag, an unsigned
+// delegation may exist there, so the proof is insecure (section 9.2).
+func (v *Validator) nsec3Denial(denial *dnsUtilsDnssecTypes.Denial, records []*dns.NSEC3) {
+	denial.Nsec3 = true
+
+	for _, nsec3 := range records {
+		if nsec3.Hash != dns.SHA1 {
+			denial.Status = dnsUtilsDnssecTypes.StatusInsecure
+			denial.Reason = fmt.Sprintf("unsupported NSEC3 hash algorithm %d", nsec3.Hash)
+			return
+		}
+		if nsec3.Iterations > v.maxNsec3Iterations {
+			denial.Status = dnsUtilsDnssecTypes.StatusInsecure
+			denial.Reason = fmt.Sprintf(
+				"%d NSEC3 iterations exceed the limit of %d",
+				nsec3.Iterations,
+				v.maxNsec3Iterations,
+			)
+			return
+		}
+	}
+
+	matches := func(name string) bool {
+		for _, nsec3 := range records {
+			if nsec3.Match(name) {
+				return true
+			}
+		}
+		return false
+	}
+	covering := func(name string) *dns.NSEC3 {
+		for _, nsec3 := range records {
+			if nsec3.Cover(name) {
+				return nsec3
+			}
+		}
+		return nil
+	}
+
+	if matches(denial.Name) {
+		denial.Status = dnsUtilsDnssecTypes.StatusBogus
+		denial.Reason = fmt.Sprintf("an NSEC3 record shows that %s exists", denial.Name)
+		return
+	}
+
+	labels := dns.CountLabel(denial.Name)
+	for closestEncloserLabels := labels - 1; closestEncloserLabels >= 0; closestEncloserLabels-- {
+		closestEncloser := ancestor(denial.Name, closestEncloserLabels)
+		if !matches(closestEncloser) {
+			continue
+		}
+		denial.ClosestEncloser = closestEncloser
+
+		nextCloser := ancestor(denial.Name, closestEncloserLabels+1)
+		nextCloserRecord := covering(nextCloser)
+		if nextCloserRecord == nil {
+			denial.Status = dnsUtilsDnssecTypes.StatusBogus
+			denial.Reason = fmt.Sprintf("no NSEC3 record covers the next closer name %s", nextCloser)
+			return
+		}
+
+		wildcard := "*." + closestEncloser
+		if closestEncloser == "." {
+			wildcard = "*."
+		}
+		if covering(wildcard) == nil {
+			denial.Status = dnsUtilsDnssecTypes.StatusBogus
+			denial.Reason = fmt.Sprintf("no NSEC3 record covers the wildcard %s", wildcard)
+			return
+		}
+
+		if nextCloserRecord.Flags&1 == 1 {
+			denial.Status = dnsUtilsDnssecTypes.StatusInsecure
+			denial.Reason = fmt.Sprintf("an opt-out NSEC3 record covers the next closer name %s", nextCloser)
+			return
+		}
+
+		denial.Status = dnsUtilsDnssecTypes.StatusSecure
+		denial.Proven = true
+		return
+	}
+
+	denial.Status = dnsUtilsDnssecTypes.StatusBogus
+	denial.Reason = fmt.Sprintf("no NSEC3 record matches a closest encloser of %s", denial.Name)
+}
+
+// alias returns the name that a CNAME record of the name, or else a DNAME
+// record above it, in the answer section redirects it to.
+func alias(name string, answer []dns.RR) (string, bool) {
+	for _, record := range answer {
+		if cname, ok := record.(*dns.CNAME); ok && equalNames(cname.Hdr.Name, name) {
+			return dns.Fqdn(cname.Target), true
+		}
+	}
+
+	for _, record := range answer {
+		dname, ok := record.(*dns.DNAME)
+		if !ok {
+			continue
+		}
+		owner := dns.Fqdn(dname.Hdr.Name)
+		if !dns.IsSubDomain(owner, name) || equalNames(owner, name) {
+			continue
+		}
+
+		// RFC 6672 section 2.2: the owner is replaced by the target.
+		prefix := name[:len(name)-len(owner)]
+		if target := dns.Fqdn(dname.Target); target != "." {
+			return prefix + target, true
+		}
+		return prefix, true
+	}
+
+	return "", false
+}
+
+// aliasTarget returns the name that the chain of CNAME and DNAME records in the
+// answer section leads to from the name, which is the name itself when there
+// is none, as the rcode is that of the last name of the chain (RFC 6604).
+func aliasTarget(name string, answer []dns.RR) string {
+	// Each step follows a record, so that a loop ends.
+	for range answer {
+		next, ok := alias(name, answer)
+		if !ok {
+			break
+		}
+		name = next
+	}
+
+	return name
+}
+
+// ValidateDenial verifies the proof that the name of the question of an
+// NXDOMAIN response does not exist or, when the answer section has a chain of
+// CNAME and DNAME records, the name that it ends at: that the NSEC or NSEC3
+// records of its authority section are secure and prove the closest encloser,
+// that the next closer name does not exist, and that no wildcard could have
+// matched it. It returns nil for a response that is not NXDOMAIN.
+func (v *Validator) ValidateDenial(ctx context.Context, message *dns.Msg) *dnsUtilsDnssecTypes.Denial {
+	if v == nil || message == nil || message.Rcode != dns.RcodeNameError || len(message.Question) != 1 {
+		return nil
+	}
+
+	denial := &dnsUtilsDnssecTypes.Denial{Name: aliasTarget(dns.Fqdn(message.Question[0].Name), message.Answer)}
+
+	var nsecRecords []*dns.NSEC
+	var nsec3Records []*dns.NSEC3
+	for _, result := range v.ValidateMessage(ctx, &dns.Msg{Ns: message.Ns}) {
+		if result.Type != dns.TypeNSEC && result.Type != dns.TypeNSEC3 {
+			continue
+		}
+		if result.Status != dnsUtilsDnssecTypes.StatusSecure {
+			denial.Status = result.Status
+			denial.Reason = fmt.Sprintf("the %s record %s: %s", dns.TypeToString[result.Type], result.Name, result.Reason)
+			return denial
+		}
+
+		set, _ := rrset(message.Ns, result.Name, result.Type)
+		for _, record := range set {
+			switch typedRecord := record.(type) {
+			case *dns.NSEC:
+				nsecRecords = append(nsecRecords, typedRecord)
+			case *dns.NSEC3:
+				nsec3Records = append(nsec3Records, typedRecord)
+			}
+		}
+	}
+
+	switch {
+	case len(nsecRecords) != 0:
+		nsecDenial(denial, nsecRecords)
+	case len(nsec3Records) != 0:
+		v.nsec3Denial(denial, nsec3Records)
+	default:
+		// Without records to check, it depends on whether there should be.
+		_, status, reason := v.enclosingZone(ctx, denial.Name, message.Ns)
+		switch status {
+		case dnsUtilsDnssecTypes.StatusSecure:
+			denial.Status = dnsUtilsDnssecTypes.StatusBogus
+			denial.Reason = fmt.Sprintf("no NSEC or NSEC3 records prove that %s does not exist", denial.Name)
+		default:
+			denial.Status = status
+			denial.Reason = reason
+		}
+	}
+
+	return denial
+}
@@ -0,0 +1,273 @@
+package dnssec
+
+import (
+	"context"
+	"testing"
+
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/miekg/dns"
+)
+
+func newNsec3(zone string, owner string, next string, iterations uint16, types ...uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr: dns.RR_Header{
+			Name:   dns.HashName(owner, dns.SHA1, iterations, "") + "." + zone,
+			Rrtype: dns.TypeNSEC3,
+			Class:  dns.ClassINET,
+			Ttl:    300,
+		},
+		Hash:       dns.SHA1,
+		Iterations: iterations,
+		NextDomain: dns.HashName(next, dns.SHA1, iterations, ""),
+		HashLength: 20,
+		TypeBitMap: types,
+	}
+}
+
+func nxdomain(name string, ns ...dns.RR) *dns.Msg {
+	message := new(dns.Msg)
+	message.SetQuestion(name, dns.TypeA)
+	message.Response = true
+	message.Rcode = dns.RcodeNameError
+	message.Ns = ns
+	return message
+}
+
+func TestValidator_ValidateDenial(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+
+	// The NSEC3 record of the apex whose next hashed name is its own: it
+	// covers every other hash.
+	onlyApex := func(iterations uint16) []dns.RR {
+		return example.sign(t, newNsec3("example.", "example.", "example.", iterations, dns.TypeSOA, dns.TypeNS))
+	}
+
+	optOut := newNsec3("example.", "example.", "example.", 0, dns.TypeSOA, dns.TypeNS)
+	optOut.Flags = 1
+
+	unsigned := newNsec("example.", "www.example.", dns.TypeSOA, dns.TypeNS)
+
+	tests := []struct {
+		name         string
+		message      *dns.Msg
+		wantProven   bool
+		wantStatus   dnsUtilsDnssecTypes.Status
+		wantNsec3    bool
+		wantEncloser string
+	}{
+		{
+			name: "nsec",
+			message: nxdomain(
+				"nothere.example.",
+				example.sign(t, newNsec("example.", "www.example.", dns.TypeSOA, dns.TypeNS))...,
+			),
+			wantProven:   true,
+			wantStatus:   dnsUtilsDnssecTypes.StatusSecure,
+			wantEncloser: "example.",
+		},
+		{
+			name: "nsec without the wildcard",
+			message: nxdomain(
+				"nothere.example.",
+				example.sign(t, newNsec("b.example.", "www.example.", dns.TypeA))...,
+			),
+			wantStatus:   dnsUtilsDnssecTypes.StatusBogus,
+			wantEncloser: "example.",
+		},
+		{
+			name: "nsec of the name",
+			message: nxdomain(
+				"www.example.",
+				example.sign(t, newNsec("www.example.", "z.example.", dns.TypeA))...,
+			),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:       "unsigned nsec",
+			message:    nxdomain("nothere.example.", unsigned),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:         "nsec3",
+			message:      nxdomain("nothere.example.", onlyApex(0)...),
+			wantProven:   true,
+			wantStatus:   dnsUtilsDnssecTypes.StatusSecure,
+			wantNsec3:    true,
+			wantEncloser: "example.",
+		},
+		{
+			name:         "nsec3 of a deeper name",
+			message:      nxdomain("a.b.nothere.example.", onlyApex(0)...),
+			wantProven:   true,
+			wantStatus:   dnsUtilsDnssecTypes.StatusSecure,
+			wantNsec3:    true,
+			wantEncloser: "example.",
+		},
+		{
+			// An unsigned delegation may exist at the next closer name.
+			name:         "nsec3 with opt-out",
+			message:      nxdomain("nothere.example.", example.sign(t, optOut)...),
+			wantStatus:   dnsUtilsDnssecTypes.StatusInsecure,
+			wantNsec3:    true,
+			wantEncloser: "example.",
+		},
+		{
+			name:       "nsec3 over the iteration limit",
+			message:    nxdomain("nothere.example.", onlyApex(DefaultMaxNsec3Iterations+1)...),
+			wantStatus: dnsUtilsDnssecTypes.StatusInsecure,
+			wantNsec3:  true,
+		},
+		{
+			name:       "no proof",
+			message:    nxdomain("nothere.www.example."),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+	}
+
+	hierarchy.resolver["nothere.www.example. SOA"] = &testResponse{
+		rcode: dns.RcodeNameError,
+		ns:    example.sign(t, newSoa("example.")),
+	}
+	validator := New(hierarchy.resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			denial := validator.ValidateDenial(context.Background(), tt.message)
+			if denial == nil {
+				t.Fatal("denial = nil")
+			}
+			if denial.Proven != tt.wantProven {
+				t.Errorf("Proven = %v (%s), want %v", denial.Proven, denial.Reason, tt.wantProven)
+			}
+			if denial.Status != tt.wantStatus {
+				t.Errorf("Status = %v (%s), want %v", denial.Status, denial.Reason, tt.wantStatus)
+			}
+			if denial.Nsec3 != tt.wantNsec3 {
+				t.Errorf("Nsec3 = %v, want %v", denial.Nsec3, tt.wantNsec3)
+			}
+			if denial.ClosestEncloser != tt.wantEncloser {
+				t.Errorf("ClosestEncloser = %q, want %q", denial.ClosestEncloser, tt.wantEncloser)
+			}
+		})
+	}
+}
+
+func newCname(name string, target string) *dns.CNAME {
+	return &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: target,
+	}
+}
+
+func newDname(name string, target string) *dns.DNAME {
+	return &dns.DNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeDNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: target,
+	}
+}
+
+func TestAliasTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		answer []dns.RR
+		want   string
+	}{
+		{name: "www.example.", want: "www.example."},
+		{
+			name:   "www.example.",
+			answer: []dns.RR{newCname("www.example.", "host.example.")},
+			want:   "host.example.",
+		},
+		{
+			name: "www.example.",
+			answer: []dns.RR{
+				newCname("host.example.", "nothere.example."),
+				newCname("WWW.example.", "host.example."),
+			},
+			want: "nothere.example.",
+		},
+		{
+			name:   "a.b.example.",
+			answer: []dns.RR{newDname("b.example.", "c.test.")},
+			want:   "a.c.test.",
+		},
+		{
+			name: "a.b.example.",
+			answer: []dns.RR{
+				newDname("b.example.", "c.test."),
+				newCname("a.b.example.", "a.c.test."),
+				newCname("a.c.test.", "d.test."),
+			},
+			want: "d.test.",
+		},
+		{
+			name:   "b.example.",
+			answer: []dns.RR{newDname("b.example.", "c.test.")},
+			want:   "b.example.",
+		},
+		{
+			name: "a.example.",
+			answer: []dns.RR{
+				newCname("a.example.", "b.example."),
+				newCname("b.example.", "a.example."),
+			},
+			want: "a.example.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			if got := aliasTarget(tt.name, tt.answer); got != tt.want {
+				t.Errorf("aliasTarget = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateDenial_FollowsAliases(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+	validator := New(hierarchy.resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	// The NSEC record proves that nothere.example. does not exist, but not
+	// that www.example. does not.
+	message := nxdomain(
+		"www.example.",
+		example.sign(t, newNsec("example.", "www.example.", dns.TypeSOA, dns.TypeNS))...,
+	)
+	message.Answer = example.sign(t, newCname("www.example.", "nothere.example."))
+
+	denial := validator.ValidateDenial(context.Background(), message)
+	if denial == nil {
+		t.Fatal("denial = nil")
+	}
+	if denial.Name != "nothere.example." {
+		t.Errorf("Name = %q, want the target nothere.example.", denial.Name)
+	}
+	if !denial.Proven || denial.Status != dnsUtilsDnssecTypes.StatusSecure {
+		t.Errorf("denial = %+v, want a proven, secure denial", denial)
+	}
+}
+
+func TestValidator_ValidateDenial_NotNxdomain(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.SetQuestion("example.", dns.TypeA)
+	message.Response = true
+
+	if denial := New(testResolver{}).ValidateDenial(context.Background(), message); denial != nil {
+		t.Errorf("denial = %+v, want nil", denial)
+	}
+}
@@ -0,0 +1,789 @@
+package dnssec
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/altshiftab/utils_go/pkg/errors/types/nil_error"
+	"github.com/miekg/dns"
+)
+
+// Exchanger sends a query to a recursive resolver and returns the response. A
+// response with an unsuccessful rcode may be returned together with an error.
+type Exchanger interface {
+	Exchange(ctx context.Context, message *dns.Msg) (*dns.Msg, error)
+}
+
+// DefaultTrustAnchors returns the DS records of the root key-signing keys,
+// KSK-2017 and KSK-2024, as published by IANA.
+func DefaultTrustAnchors() []*dns.DS {
+	header := dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET}
+	return []*dns.DS{
+		{
+			Hdr:        header,
+			KeyTag:     20326,
+			Algorithm:  dns.RSASHA256,
+			DigestType: dns.SHA256,
+			Digest:     "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		},
+		{
+			Hdr:        header,
+			KeyTag:     38696,
+			Algorithm:  dns.RSASHA256,
+			DigestType: dns.SHA256,
+			Digest:     "683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+		},
+	}
+}
+
+type Option func(*Validator)
+
+// Validator validates RRsets by following the chain of trust from a trust
+// anchor for the root zone down the delegations to the zone that signed them,
+// fetching the DS and DNSKEY records along the way with the exchanger. The
+// zones are found from the signer names of the signatures, and from SOA
+// records for unsigned RRsets; those that are authenticated are cached for the
+// TTL of their DS and DNSKEY records. It is safe for concurrent use.
+type Validator struct {
+	exchanger          Exchanger
+	trustAnchors       []*dns.DS
+	maxNsec3Iterations uint16
+	now                func() time.Time
+
+	mutex sync.Mutex
+	zones map[string]*zone
+}
+
+func New(exchanger Exchanger, options ...Option) *Validator {
+	validator := &Validator{
+		exchanger:          exchanger,
+		trustAnchors:       DefaultTrustAnchors(),
+		maxNsec3Iterations: DefaultMaxNsec3Iterations,
+		now:                time.Now,
+		zones:              make(map[string]*zone),
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option(validator)
+		}
+	}
+
+	return validator
+}
+
+// WithTrustAnchors sets the DS records of the root zone that are trusted. When
+// none are given, the root key-signing keys are.
+func WithTrustAnchors(trustAnchors ...*dns.DS) Option {
+	return func(validator *Validator) {
+		if len(trustAnchors) != 0 {
+			validator.trustAnchors = trustAnchors
+		}
+	}
+}
+
+// zone is a zone whose DNSKEY RRset has been authenticated or, without keys,
+// the zone below an insecure delegation.
+type zone struct {
+	name string
+	keys []*dns.DNSKEY
+	// insecure is set for the zone below an insecure delegation, and reason
+	// tells why it is insecure.
+	insecure bool
+	reason   string
+	// expires is when the keys are to be authenticated anew: when the first of
+	// the DS and DNSKEY RRsets that authenticated them expires. For an insecure
+	// zone, it is when the proof that it has no DS records expires.
+	expires time.Time
+}
+
+// cachedZone returns the authenticated or insecure zone with the name, if it is
+// cached and has not expired.
+func (v *Validator) cachedZone(name string) *zone {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	cached, ok := v.zones[name]
+	if !ok {
+		return nil
+	}
+	if !v.now().Before(cached.expires) {
+		delete(v.zones, name)
+		return nil
+	}
+	return cached
+}
+
+func (v *Validator) cacheZone(authenticated *zone) {
+	if !v.now().Before(authenticated.expires) {
+		return
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.zones == nil {
+		v.zones = make(map[string]*zone)
+	}
+	v.zones[authenticated.name] = authenticated
+}
+
+// minTtl returns the smallest TTL of the records.
+func minTtl(records []dns.RR) time.Duration {
+	var ttl uint32
+	for i, record := range records {
+		if header := record.Header(); i == 0 || header.Ttl < ttl {
+			ttl = header.Ttl
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// query asks for the records of the name and type, with their signatures and
+// without the validation of the resolver, which would hide bogus responses.
+func query(ctx context.Context, exchanger Exchanger, name string, recordType uint16) (*dns.Msg, error) {
+	message := new(dns.Msg)
+	message.SetQuestion(dns.Fqdn(name), recordType)
+	message.SetEdns0(dns.DefaultMsgSize, true)
+	message.CheckingDisabled = true
+
+	response, err := exchanger.Exchange(ctx, message)
+	if response == nil {
+		if err == nil {
+			err = nil_error.New("response message")
+		}
+		return nil, fmt.Errorf("exchanger exchange: %w", err)
+	}
+
+	// NXDOMAIN comes with the proof that is looked for.
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		if err == nil {
+			err = dnsUtilsErrors.NewRcodeError(response)
+		}
+		return nil, fmt.Errorf("exchanger exchange: %w", err)
+	}
+
+	return response, nil
+}
+
+func equalNames(a string, b string) bool {
+	return strings.EqualFold(dns.Fqdn(a), dns.Fqdn(b))
+}
+
+// parentName returns the name without its first label.
+func parentName(name string) string {
+	if offset, end := dns.NextLabel(name, 0); !end {
+		return name[offset:]
+	}
+	return "."
+}
+
+// rrset returns the records of the section with the name and type, and the
+// signatures that cover them.
+func rrset(records []dns.RR, name string, recordType uint16) ([]dns.RR, []*dns.RRSIG) {
+	var set []dns.RR
+	var signatures []*dns.RRSIG
+	for _, record := range records {
+		header := record.Header()
+		if !equalNames(header.Name, name) {
+			continue
+		}
+
+		if signature, ok := record.(*dns.RRSIG); ok {
+			if signature.TypeCovered == recordType {
+				signatures = append(signatures, signature)
+			}
+			continue
+		}
+
+		if header.Rrtype == recordType {
+			set = append(set, record)
+		}
+	}
+	return set, signatures
+}
+
+// supportedAlgorithm reports whether signatures of the algorithm can be
+// verified.
+func supportedAlgorithm(algorithm uint8) bool {
+	switch algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512,
+		dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+		return true
+	}
+	return false
+}
+
+// supportedDs reports whether a DS record can be used to authenticate a key.
+func supportedDs(ds *dns.DS) bool {
+	if !supportedAlgorithm(ds.Algorithm) {
+		return false
+	}
+	switch ds.DigestType {
+	case dns.SHA1, dns.SHA256, dns.SHA384:
+		return true
+	}
+	return false
+}
+
+// MatchesDs reports whether the DS record is that of the key.
+func MatchesDs(key *dns.DNSKEY, ds *dns.DS) bool {
+	if key.Flags&dns.ZONE == 0 || key.Algorithm != ds.Algorithm || key.KeyTag() != ds.KeyTag {
+		return false
+	}
+	keyDs := key.ToDS(ds.DigestType)
+	return keyDs != nil && strings.EqualFold(keyDs.Digest, ds.Digest)
+}
+
+// verify checks that one of the signatures over the RRset is by one of the keys
+// and is within its validity period, and returns it. It returns why not if none
+// is.
+func (v *Validator) verify(set []dns.RR, signatures []*dns.RRSIG, keys []*dns.DNSKEY) (*dns.RRSIG, string) {
+	if len(signatures) == 0 {
+		return nil, "no signatures"
+	}
+
+	now := v.now()
+	reason := "no signature by a key of the zone"
+	for _, signature := range signatures {
+		if !signature.ValidityPeriod(now) {
+			reason = fmt.Sprintf("the signature by key %d is outside its validity period", signature.KeyTag)
+			continue
+		}
+
+		for _, key := range keys {
+			if key.Flags&dns.ZONE == 0 || key.KeyTag() != signature.KeyTag || key.Algorithm != signature.Algorithm {
+				continue
+			}
+			if err := signature.Verify(key, set); err != nil {
+				reason = fmt.Sprintf("the signature by key %d does not verify: %v", signature.KeyTag, err)
+				continue
+			}
+			return signature, ""
+		}
+	}
+
+	return nil, reason
+}
+
+// zoneKeys fetches the DNSKEY RRset of the zone and authenticates it with the
+// DS records: it must be signed by a key that one of them matches.
+func (v *Validator) zoneKeys(ctx context.Context, name string, dsRecords []*dns.DS) (*zone, dnsUtilsDnssecTypes.Status, string) {
+	var supported []*dns.DS
+	for _, ds := range dsRecords {
+		if supportedDs(ds) {
+			supported = append(supported, ds)
+		}
+	}
+	if len(supported) == 0 {
+		// RFC 4035 section 5.2.
+		return nil, dnsUtilsDnssecTypes.StatusInsecure, fmt.Sprintf("no DS record of %s has a supported algorithm", name)
+	}
+
+	response, err := query(ctx, v.exchanger, name, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, dnsUtilsDnssecTypes.StatusIndeterminate, fmt.Sprintf("query %s DNSKEY: %v", name, err)
+	}
+
+	set, signatures := rrset(response.Answer, name, dns.TypeDNSKEY)
+	var keys []*dns.DNSKEY
+	for _, record := range set {
+		keys = append(keys, record.(*dns.DNSKEY))
+	}
+	if len(keys) == 0 {
+		return nil, dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf("%s has DS records but no DNSKEY records", name)
+	}
+
+	reason := fmt.Sprintf("no DNSKEY of %s matches a DS record", name)
+	for _, key := range keys {
+		for _, ds := range supported {
+			if !MatchesDs(key, ds) {
+				continue
+			}
+			signature, verifyReason := v.verify(set, signatures, []*dns.DNSKEY{key})
+			if signature != nil {
+				authenticated := &zone{name: dns.Fqdn(name), keys: keys, expires: v.now().Add(minTtl(set))}
+				return authenticated, dnsUtilsDnssecTypes.StatusSecure, ""
+			}
+			reason = fmt.Sprintf("the DNSKEY RRset of %s: %s", name, verifyReason)
+		}
+	}
+
+	return nil, dnsUtilsDnssecTypes.StatusBogus, reason
+}
+
+// dsAbsence checks the proof in the authority section of a response without DS
+// records for the name, which must be signed by the zone. It reports whether
+// the absence is proven and, if it is, whether the name is a delegation, which
+// is then an insecure one; the reason tells why when it is not proven, or why
+// it is treated as insecure.
+func (v *Validator) dsAbsence(response *dns.Msg, name string, parent *zone) (bool, bool, string) {
+	var proofs int
+	for _, record := range response.Ns {
+		switch typedRecord := record.(type) {
+		case *dns.NSEC:
+			set, signatures := rrset(response.Ns, typedRecord.Hdr.Name, dns.TypeNSEC)
+			if signature, reason := v.verify(set, signatures, parent.keys); signature == nil {
+				return false, false, fmt.Sprintf("the NSEC record %s: %s", typedRecord.Hdr.Name, reason)
+			}
+			proofs++
+
+			if equalNames(typedRecord.Hdr.Name, name) {
+				return bitmapDsAbsence(typedRecord.TypeBitMap, name)
+			}
+			if coversNsec(typedRecord, name) {
+				// The name does not exist, and so has no DS records.
+				return true, false, ""
+			}
+		case *dns.NSEC3:
+			set, signatures := rrset(response.Ns, typedRecord.Hdr.Name, dns.TypeNSEC3)
+			if signature, reason := v.verify(set, signatures, parent.keys); signature == nil {
+				return false, false, fmt.Sprintf("the NSEC3 record %s: %s", typedRecord.Hdr.Name, reason)
+			}
+			proofs++
+
+			if typedRecord.Iterations > v.maxNsec3Iterations {
+				// Treated as an insecure delegation (RFC 9276 section 3.2).
+				return true, true, fmt.Sprintf(
+					"%d NSEC3 iterations exceed the limit of %d",
+					typedRecord.Iterations,
+					v.maxNsec3Iterations,
+				)
+			}
+			if typedRecord.Match(name) {
+				return bitmapDsAbsence(typedRecord.TypeBitMap, name)
+			}
+			if typedRecord.Cover(name) {
+				// An opt-out span may hold unsigned delegations (RFC 5155
+				// section 6).
+				return true, typedRecord.Flags&1 == 1, ""
+			}
+		}
+	}
+
+	if proofs == 0 {
+		return false, false, fmt.Sprintf("no proof that %s has no DS records", name)
+	}
+	return false, false, fmt.Sprintf("no NSEC or NSEC3 record matches or covers %s", name)
+}
+
+// bitmapDsAbsence checks the type bitmap of the NSEC or NSEC3 record of a name
+// without DS records.
+func bitmapDsAbsence(typeBitMap []uint16, name string) (bool, bool, string) {
+	var hasNs, hasSoa bool
+	for _, recordType := range typeBitMap {
+		switch recordType {
+		case dns.TypeDS:
+			return false, false, fmt.Sprintf("the type bitmap of %s lists DS records", name)
+		case dns.TypeNS:
+			hasNs = true
+		case dns.TypeSOA:
+			hasSoa = true
+		}
+	}
+	return true, hasNs && !hasSoa, ""
+}
+
+// coversNsec reports whether the name falls between the owner and the next
+// name of the NSEC record, in canonical order.
+func coversNsec(nsec *dns.NSEC, name string) bool {
+	owner := dns.CanonicalName(nsec.Hdr.Name)
+	next := dns.CanonicalName(nsec.NextDomain)
+	name = dns.CanonicalName(name)
+
+	if compareNames(owner, next) < 0 {
+		return compareNames(owner, name) < 0 && compareNames(name, next) < 0
+	}
+	// The last NSEC record of the zone wraps around to the apex.
+	return compareNames(owner, name) < 0 || compareNames(name, next) < 0
+}
+
+// compareNames compares two lower-cased names in canonical order (RFC 4034
+// section 6.1): label by label, from the rightmost.
+func compareNames(a string, b string) int {
+	aLabels := dns.SplitDomainName(a)
+	bLabels := dns.SplitDomainName(b)
+
+	for i, j := len(aLabels)-1, len(bLabels)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(aLabels[i], bLabels[j]); c != 0 {
+			return c
+		}
+	}
+	return len(aLabels) - len(bLabels)
+}
+
+// signerName returns the signer name of the first signature among the records
+// that covers one of the types, or the empty string if there is none.
+func signerName(records []dns.RR, recordTypes ...uint16) string {
+	for _, record := range records {
+		signature, ok := record.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		for _, recordType := range recordTypes {
+			if signature.TypeCovered == recordType {
+				return dns.CanonicalName(signature.SignerName)
+			}
+		}
+	}
+	return ""
+}
+
+// authenticateZone follows the chain of trust from the root down to the zone
+// with the apex, one zone cut at a time: the parent of each zone is the signer
+// of its DS records, or of the proof that it has none. It returns the zone
+// when the chain is secure all the way, the insecure delegation above it when
+// there is one, and why not otherwise.
+func (v *Validator) authenticateZone(ctx context.Context, apex string) (*zone, dnsUtilsDnssecTypes.Status, string) {
+	apex = dns.CanonicalName(apex)
+	if cached := v.cachedZone(apex); cached != nil {
+		if cached.insecure {
+			return cached, dnsUtilsDnssecTypes.StatusInsecure, cached.reason
+		}
+		return cached, dnsUtilsDnssecTypes.StatusSecure, ""
+	}
+
+	if apex == "." {
+		root, status, reason := v.zoneKeys(ctx, ".", v.trustAnchors)
+		if status == dnsUtilsDnssecTypes.StatusSecure {
+			v.cacheZone(root)
+		}
+		return root, status, reason
+	}
+
+	response, err := query(ctx, v.exchanger, apex, dns.TypeDS)
+	if err != nil {
+		return nil, dnsUtilsDnssecTypes.StatusIndeterminate, fmt.Sprintf("query %s DS: %v", apex, err)
+	}
+
+	set, signatures := rrset(response.Answer, apex, dns.TypeDS)
+
+	var parent *zone
+	var status dnsUtilsDnssecTypes.Status
+	var reason string
+	if len(set) != 0 {
+		parent, status, reason = v.signerZone(ctx, apex, signerName(response.Answer, dns.TypeDS), response.Ns)
+	} else {
+		parent, status, reason = v.signerZone(
+			ctx,
+			apex,
+			signerName(response.Ns, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeSOA),
+			response.Ns,
+		)
+	}
+	if status != dnsUtilsDnssecTypes.StatusSecure {
+		return parent, status, reason
+	}
+
+	if len(set) != 0 {
+		if signature, reason := v.verify(set, signatures, parent.keys); signature == nil {
+			return nil, dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf("the DS RRset of %s: %s", apex, reason)
+		}
+
+		var dsRecords []*dns.DS
+		for _, record := range set {
+			dsRecords = append(dsRecords, record.(*dns.DS))
+		}
+
+		child, status, reason := v.zoneKeys(ctx, apex, dsRecords)
+		if status != dnsUtilsDnssecTypes.StatusSecure {
+			return &zone{name: apex}, status, reason
+		}
+		if expires := v.now().Add(minTtl(set)); expires.Before(child.expires) {
+			child.expires = expires
+		}
+		v.cacheZone(child)
+
+		return child, dnsUtilsDnssecTypes.StatusSecure, ""
+	}
+
+	proven, delegation, reason := v.dsAbsence(response, apex, parent)
+	if !proven {
+		return nil, dnsUtilsDnssecTypes.StatusBogus, reason
+	}
+	if !delegation {
+		return nil, dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf("%s is not a zone cut", apex)
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("%s is an insecure delegation", apex)
+	}
+
+	// The delegation stays insecure for as long as the proof and the keys of
+	// the parent zone that signed it.
+	insecure := &zone{name: apex, insecure: true, reason: reason, expires: parent.expires}
+	if expires := v.now().Add(minTtl(proofRecords(response.Ns))); expires.Before(insecure.expires) {
+		insecure.expires = expires
+	}
+	v.cacheZone(insecure)
+
+	return insecure, dnsUtilsDnssecTypes.StatusInsecure, reason
+}
+
+// proofRecords returns the NSEC and NSEC3 records among the records.
+func proofRecords(records []dns.RR) []dns.RR {
+	var proof []dns.RR
+	for _, record := range records {
+		switch record.(type) {
+		case *dns.NSEC, *dns.NSEC3:
+			proof = append(proof, record)
+		}
+	}
+	return proof
+}
+
+// signerZone authenticates the parent zone of the apex, given the signer of the
+// DS records of the apex or of the proof that it has none. Without a signer,
+// the records of the parent zone are unsigned, which is bogus unless the
+// parent zone is insecure.
+func (v *Validator) signerZone(
+	ctx context.Context,
+	apex string,
+	signer string,
+	authority []dns.RR,
+) (*zone, dnsUtilsDnssecTypes.Status, string) {
+	if signer == "" {
+		parent, status, reason := v.enclosingZone(ctx, parentName(apex), authority)
+		if status == dnsUtilsDnssecTypes.StatusSecure {
+			return nil, dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf("the DS records of %s, or their absence, are not signed", apex)
+		}
+		return parent, status, reason
+	}
+
+	if !dns.IsSubDomain(signer, apex) || equalNames(signer, apex) {
+		return nil, dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf("the signer %s of the DS records of %s is not above it", signer, apex)
+	}
+
+	return v.authenticateZone(ctx, signer)
+}
+
+// soaAbove returns the owner of the first SOA record at or above the name.
+func soaAbove(records []dns.RR, name string) (string, bool) {
+	for _, record := range records {
+		if soa, ok := record.(*dns.SOA); ok && dns.IsSubDomain(soa.Hdr.Name, name) {
+			return dns.CanonicalName(soa.Hdr.Name), true
+		}
+	}
+	return "", false
+}
+
+// enclosingZone authenticates the zone that the name is in, for records that
+// are unsigned and so have no signer name to tell. Its apex is that of an SOA
+// record at or above the name in the authority section, or else of the
+// response to an SOA query for the name or, failing that, its ancestors.
+func (v *Validator) enclosingZone(ctx context.Context, name string, authority []dns.RR) (*zone, dnsUtilsDnssecTypes.Status, string) {
+	name = dns.CanonicalName(name)
+
+	apex, ok := soaAbove(authority, name)
+	for current := name; !ok; current = parentName(current) {
+		if current == "." {
+			apex, ok = ".", true
+			break
+		}
+
+		response, err := query(ctx, v.exchanger, current, dns.TypeSOA)
+		if err != nil {
+			return nil, dnsUtilsDnssecTypes.StatusIndeterminate, fmt.Sprintf("query %s SOA: %v", current, err)
+		}
+		// An SOA query for an alias is answered for its target, whose SOA
+		// record is then not above the name.
+		apex, ok = soaAbove(slices.Concat(response.Answer, response.Ns), current)
+	}
+
+	return v.authenticateZone(ctx, apex)
+}
+
+// wildcardLabels returns the number of labels of the owner name that a
+// signature over its RRset has when the RRset is not a wildcard expansion (RFC
+// 4034 section 3.1.3).
+func wildcardLabels(name string) int {
+	labels := dns.CountLabel(name)
+	if strings.HasPrefix(name, "*.") {
+		labels--
+	}
+	return labels
+}
+
+// closerMatchAbsence checks that the name, whose RRset is a wildcard expansion
+// at the ancestor with the number of labels, does not exist: that an NSEC
+// record of the zone in the authority section covers it, or an NSEC3 record
+// covers its next closer name (RFC 4035 section 5.3.4, RFC 5155 section 8.8).
+func (v *Validator) closerMatchAbsence(
+	name string,
+	labels int,
+	authority []dns.RR,
+	signer *zone,
+) (dnsUtilsDnssecTypes.Status, string) {
+	nextCloser := ancestor(name, labels+1)
+
+	for _, record := range authority {
+		switch typedRecord := record.(type) {
+		case *dns.NSEC:
+			if !coversNsec(typedRecord, name) {
+				continue
+			}
+			set, signatures := rrset(authority, typedRecord.Hdr.Name, dns.TypeNSEC)
+			if signature, _ := v.verify(set, signatures, signer.keys); signature != nil {
+				return dnsUtilsDnssecTypes.StatusSecure, ""
+			}
+		case *dns.NSEC3:
+			if typedRecord.Hash != dns.SHA1 || !typedRecord.Cover(nextCloser) {
+				continue
+			}
+			set, signatures := rrset(authority, typedRecord.Hdr.Name, dns.TypeNSEC3)
+			if signature, _ := v.verify(set, signatures, signer.keys); signature == nil {
+				continue
+			}
+			if typedRecord.Iterations > v.maxNsec3Iterations {
+				// RFC 9276 section 3.2.
+				return dnsUtilsDnssecTypes.StatusInsecure, fmt.Sprintf(
+					"%d NSEC3 iterations exceed the limit of %d",
+					typedRecord.Iterations,
+					v.maxNsec3Iterations,
+				)
+			}
+			return dnsUtilsDnssecTypes.StatusSecure, ""
+		}
+	}
+
+	return dnsUtilsDnssecTypes.StatusBogus, fmt.Sprintf(
+		"%s is a wildcard expansion, but no NSEC or NSEC3 record proves that no closer match exists",
+		name,
+	)
+}
+
+// ValidateRRset returns the DNSSEC status of the RRset, given the signatures
+// that cover it. A wildcard expansion is bogus, as the proof that no closer
+// match exists is in the authority section of the response; see
+// ValidateMessage.
+func (v *Validator) ValidateRRset(ctx context.Context, set []dns.RR, signatures []*dns.RRSIG) *dnsUtilsDnssecTypes.Result {
+	return v.validateRRset(ctx, set, signatures, nil)
+}
+
+// validateRRset returns the DNSSEC status of the RRset, given the signatures
+// that cover it and the authority section of the response that it is in.
+func (v *Validator) validateRRset(
+	ctx context.Context,
+	set []dns.RR,
+	signatures []*dns.RRSIG,
+	authority []dns.RR,
+) *dnsUtilsDnssecTypes.Result {
+	if v == nil || len(set) == 0 {
+		return nil
+	}
+
+	header := set[0].Header()
+	result := &dnsUtilsDnssecTypes.Result{Name: header.Name, Type: header.Rrtype}
+
+	if v.exchanger == nil {
+		result.Reason = "no exchanger"
+		return result
+	}
+
+	if len(signatures) == 0 {
+		// Unsigned, the RRset is secure only if its zone is insecure. A DS
+		// RRset belongs to the parent side of the delegation.
+		name := header.Name
+		if header.Rrtype == dns.TypeDS {
+			name = parentName(name)
+		}
+
+		enclosing, status, reason := v.enclosingZone(ctx, name, authority)
+		if enclosing != nil {
+			result.Zone = enclosing.name
+		}
+		if status == dnsUtilsDnssecTypes.StatusSecure {
+			result.Status = dnsUtilsDnssecTypes.StatusBogus
+			result.Reason = "no signatures"
+			return result
+		}
+		result.Status = status
+		result.Reason = reason
+		return result
+	}
+
+	// The signer is the zone of the RRset, at or above its owner, and that of
+	// the parent for a DS RRset (RFC 4035 section 5.3.1).
+	signer := dns.CanonicalName(signatures[0].SignerName)
+	if !dns.IsSubDomain(signer, header.Name) || (header.Rrtype == dns.TypeDS && equalNames(signer, header.Name)) {
+		result.Status = dnsUtilsDnssecTypes.StatusBogus
+		result.Reason = fmt.Sprintf("the signer %s is not the zone of %s", signer, header.Name)
+		return result
+	}
+
+	var signerSignatures []*dns.RRSIG
+	for _, signature := range signatures {
+		if equalNames(signature.SignerName, signer) {
+			signerSignatures = append(signerSignatures, signature)
+		}
+	}
+
+	signerZone, status, reason := v.authenticateZone(ctx, signer)
+	if signerZone != nil {
+		result.Zone = signerZone.name
+	}
+	if status != dnsUtilsDnssecTypes.StatusSecure {
+		result.Status = status
+		result.Reason = reason
+		return result
+	}
+
+	signature, reason := v.verify(set, signerSignatures, signerZone.keys)
+	if signature == nil {
+		result.Status = dnsUtilsDnssecTypes.StatusBogus
+		result.Reason = reason
+		return result
+	}
+
+	if labels := int(signature.Labels); labels < wildcardLabels(header.Name) {
+		if status, reason := v.closerMatchAbsence(header.Name, labels, authority, signerZone); status != dnsUtilsDnssecTypes.StatusSecure {
+			result.Status = status
+			result.Reason = reason
+			return result
+		}
+	}
+
+	result.Status = dnsUtilsDnssecTypes.StatusSecure
+	return result
+}
+
+// ValidateMessage returns the DNSSEC status of each RRset in the answer and
+// authority sections of the response, in order. A wildcard expansion is secure
+// only if the authority section proves that no closer match exists.
+func (v *Validator) ValidateMessage(ctx context.Context, message *dns.Msg) []*dnsUtilsDnssecTypes.Result {
+	if v == nil || message == nil {
+		return nil
+	}
+
+	type rrsetKey struct {
+		name       string
+		recordType uint16
+	}
+
+	var results []*dnsUtilsDnssecTypes.Result
+	for _, section := range [][]dns.RR{message.Answer, message.Ns} {
+		seen := make(map[rrsetKey]bool)
+		for _, record := range section {
+			header := record.Header()
+			if header.Rrtype == dns.TypeRRSIG || header.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			key := rrsetKey{name: dns.CanonicalName(header.Name), recordType: header.Rrtype}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			set, signatures := rrset(section, header.Name, header.Rrtype)
+			results = append(results, v.validateRRset(ctx, set, signatures, message.Ns))
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,532 @@
+package dnssec
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/miekg/dns"
+)
+
+// testZone is a zone signed with a single ECDSA key.
+type testZone struct {
+	name   string
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	privateKey, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	return &testZone{name: name, key: key, signer: privateKey.(crypto.Signer)}
+}
+
+// signWithin returns the RRset followed by its signature, valid from the
+// inception to the expiration.
+func (z *testZone) signWithin(t *testing.T, inception time.Time, expiration time.Time, set ...dns.RR) []dns.RR {
+	t.Helper()
+
+	header := set[0].Header()
+	signature := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: header.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: header.Ttl},
+		TypeCovered: header.Rrtype,
+		Algorithm:   z.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(header.Name)),
+		OrigTtl:     header.Ttl,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      z.key.KeyTag(),
+		SignerName:  z.name,
+	}
+	if err := signature.Sign(z.signer, set); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	return append(set, signature)
+}
+
+func (z *testZone) sign(t *testing.T, set ...dns.RR) []dns.RR {
+	t.Helper()
+	return z.signWithin(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), set...)
+}
+
+func (z *testZone) ds() *dns.DS {
+	ds := z.key.ToDS(dns.SHA256)
+	ds.Hdr.Ttl = 3600
+	return ds
+}
+
+func newA(name string, ip string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP(ip),
+	}
+}
+
+func newNsec(name string, next string, types ...uint16) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// testResponse is the response to a query: either records or an error.
+type testResponse struct {
+	rcode  int
+	answer []dns.RR
+	ns     []dns.RR
+	err    error
+}
+
+// testResolver answers queries from a table, keyed by "name type".
+type testResolver map[string]*testResponse
+
+func (r testResolver) Exchange(_ context.Context, message *dns.Msg) (*dns.Msg, error) {
+	question := message.Question[0]
+	response, ok := r[strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype]]
+	if !ok {
+		return nil, errors.New("unexpected query " + question.String())
+	}
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(message, response.rcode)
+	m.Answer = response.answer
+	m.Ns = response.ns
+	return m, nil
+}
+
+// countingResolver records the queries that it answers.
+type countingResolver struct {
+	resolver testResolver
+
+	mutex   sync.Mutex
+	queries []string
+}
+
+func (r *countingResolver) Exchange(ctx context.Context, message *dns.Msg) (*dns.Msg, error) {
+	question := message.Question[0]
+
+	r.mutex.Lock()
+	r.queries = append(r.queries, strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype])
+	r.mutex.Unlock()
+
+	return r.resolver.Exchange(ctx, message)
+}
+
+func (r *countingResolver) takeQueries() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	queries := r.queries
+	r.queries = nil
+	return queries
+}
+
+// wildcardExpansion returns an A RRset of the name, synthesized from a wildcard
+// at its parent, followed by its signature.
+func wildcardExpansion(t *testing.T, z *testZone, name string) []dns.RR {
+	t.Helper()
+
+	records := z.sign(t, newA("*."+parentName(name), "192.0.2.5"))
+	for _, record := range records {
+		record.Header().Name = name
+	}
+	return records
+}
+
+// testHierarchy is a signed root with a signed example. zone, which has an
+// insecure delegation to insecure.example.
+type testHierarchy struct {
+	root     *testZone
+	example  *testZone
+	resolver testResolver
+}
+
+func newTestHierarchy(t *testing.T) *testHierarchy {
+	t.Helper()
+
+	root := newTestZone(t, ".")
+	example := newTestZone(t, "example.")
+
+	resolver := testResolver{
+		". DNSKEY":        {answer: root.sign(t, root.key)},
+		"example. DS":     {answer: root.sign(t, example.ds())},
+		"example. DNSKEY": {answer: example.sign(t, example.key)},
+		"example. SOA":    {answer: example.sign(t, newSoa("example."))},
+		"www.example. SOA": {
+			ns: example.sign(t, newSoa("example.")),
+		},
+		"insecure.example. DS": {
+			ns: example.sign(t, newNsec("insecure.example.", "www.example.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC)),
+		},
+		"host.insecure.example. SOA": {ns: []dns.RR{newSoa("insecure.example.")}},
+		"broken.example. SOA":        {err: errors.New("timeout")},
+	}
+
+	return &testHierarchy{root: root, example: example, resolver: resolver}
+}
+
+func TestValidator_ValidateRRset(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+
+	signed := example.sign(t, newA("www.example.", "192.0.2.1"))
+	tampered := example.sign(t, newA("www.example.", "192.0.2.1"))
+	tampered[0] = newA("www.example.", "192.0.2.66")
+	expired := example.signWithin(
+		t,
+		time.Now().Add(-2*time.Hour),
+		time.Now().Add(-time.Hour),
+		newA("www.example.", "192.0.2.1"),
+	)
+
+	tests := []struct {
+		name       string
+		records    []dns.RR
+		wantStatus dnsUtilsDnssecTypes.Status
+		wantZone   string
+	}{
+		{name: "secure", records: signed, wantStatus: dnsUtilsDnssecTypes.StatusSecure, wantZone: "example."},
+		{name: "tampered", records: tampered, wantStatus: dnsUtilsDnssecTypes.StatusBogus, wantZone: "example."},
+		{name: "expired", records: expired, wantStatus: dnsUtilsDnssecTypes.StatusBogus, wantZone: "example."},
+		{
+			name:       "missing signature",
+			records:    []dns.RR{newA("www.example.", "192.0.2.1")},
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+			wantZone:   "example.",
+		},
+		{
+			name:       "insecure delegation",
+			records:    []dns.RR{newA("host.insecure.example.", "192.0.2.2")},
+			wantStatus: dnsUtilsDnssecTypes.StatusInsecure,
+			wantZone:   "insecure.example.",
+		},
+		{
+			name:       "failed query",
+			records:    []dns.RR{newA("broken.example.", "192.0.2.3")},
+			wantStatus: dnsUtilsDnssecTypes.StatusIndeterminate,
+		},
+		{
+			name:       "ds",
+			records:    hierarchy.resolver["example. DS"].answer,
+			wantStatus: dnsUtilsDnssecTypes.StatusSecure,
+			wantZone:   ".",
+		},
+		{
+			name:       "signer not above the owner",
+			records:    example.sign(t, newA("other.", "192.0.2.4")),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:       "ds signed by its own zone",
+			records:    example.sign(t, example.ds()),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:       "wildcard expansion without a proof",
+			records:    wildcardExpansion(t, example, "host.example."),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+			wantZone:   "example.",
+		},
+	}
+
+	validator := New(hierarchy.resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			set, signatures := rrset(tt.records, tt.records[0].Header().Name, tt.records[0].Header().Rrtype)
+
+			result := validator.ValidateRRset(context.Background(), set, signatures)
+			if result == nil {
+				t.Fatal("result = nil")
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %v (%s), want %v", result.Status, result.Reason, tt.wantStatus)
+			}
+			if result.Zone != tt.wantZone {
+				t.Errorf("Zone = %q, want %q", result.Zone, tt.wantZone)
+			}
+			if (result.Reason == "") != (tt.wantStatus == dnsUtilsDnssecTypes.StatusSecure) {
+				t.Errorf("Reason = %q", result.Reason)
+			}
+		})
+	}
+}
+
+func TestValidator_UntrustedRoot(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	otherRoot := newTestZone(t, ".")
+
+	validator := New(hierarchy.resolver, WithTrustAnchors(otherRoot.ds()))
+
+	records := hierarchy.example.sign(t, newA("www.example.", "192.0.2.1"))
+	set, signatures := rrset(records, "www.example.", dns.TypeA)
+
+	if result := validator.ValidateRRset(context.Background(), set, signatures); result.Status != dnsUtilsDnssecTypes.StatusBogus {
+		t.Errorf("Status = %v, want bogus", result.Status)
+	}
+}
+
+func TestValidator_ValidateMessage(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	validator := New(hierarchy.resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	message := new(dns.Msg)
+	message.SetQuestion("www.example.", dns.TypeA)
+	message.Response = true
+	message.Answer = hierarchy.example.sign(
+		t,
+		newA("www.example.", "192.0.2.1"),
+		newA("www.example.", "192.0.2.2"),
+	)
+	message.Ns = []dns.RR{newA("host.insecure.example.", "192.0.2.3")}
+
+	results := validator.ValidateMessage(context.Background(), message)
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+	if results[0].Type != dns.TypeA || results[0].Status != dnsUtilsDnssecTypes.StatusSecure {
+		t.Errorf("results[0] = %+v, want a secure A RRset", results[0])
+	}
+	if results[1].Status != dnsUtilsDnssecTypes.StatusInsecure {
+		t.Errorf("results[1] = %+v, want an insecure RRset", results[1])
+	}
+}
+
+func TestValidator_ZoneCutsFromSignerNames(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+	// An alias, whose DS query would be answered for its target.
+	hierarchy.resolver["alias.example. DS"] = &testResponse{
+		answer: example.sign(t, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "alias.example.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: "www.example.",
+		}),
+	}
+
+	resolver := &countingResolver{resolver: hierarchy.resolver}
+	validator := New(resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	sets := [][]dns.RR{
+		example.sign(t, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "alias.example.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: "www.example.",
+		}),
+		example.sign(t, newA("a.b.alias.example.", "192.0.2.1")),
+		example.sign(t, newA("www.example.", "192.0.2.1")),
+	}
+
+	for i, records := range sets {
+		header := records[0].Header()
+		set, signatures := rrset(records, header.Name, header.Rrtype)
+
+		result := validator.ValidateRRset(context.Background(), set, signatures)
+		if result.Status != dnsUtilsDnssecTypes.StatusSecure || result.Zone != "example." {
+			t.Errorf("%s: result = %+v, want secure in example.", header.Name, result)
+		}
+
+		queries := resolver.takeQueries()
+		switch {
+		case i == 0 && len(queries) != 3:
+			t.Errorf("%s: queries = %v, want those of the DNSKEY and DS records of . and example.", header.Name, queries)
+		case i != 0 && len(queries) != 0:
+			t.Errorf("%s: queries = %v, want none with the keys cached", header.Name, queries)
+		}
+	}
+}
+
+func TestValidator_ZoneCacheExpires(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+
+	ds := example.ds()
+	ds.Hdr.Ttl = 60
+	hierarchy.resolver["example. DS"] = &testResponse{answer: hierarchy.root.sign(t, ds)}
+
+	resolver := &countingResolver{resolver: hierarchy.resolver}
+	validator := New(resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	records := example.sign(t, newA("www.example.", "192.0.2.1"))
+	set, signatures := rrset(records, "www.example.", dns.TypeA)
+
+	validator.ValidateRRset(context.Background(), set, signatures)
+	resolver.takeQueries()
+
+	later := time.Now().Add(2 * time.Minute)
+	validator.now = func() time.Time { return later }
+
+	if result := validator.ValidateRRset(context.Background(), set, signatures); result.Status != dnsUtilsDnssecTypes.StatusSecure {
+		t.Errorf("Status = %v (%s), want secure", result.Status, result.Reason)
+	}
+	// The root keys are cached for the hour of their TTL, and those of
+	// example. for the minute of its DS TTL.
+	if queries := resolver.takeQueries(); len(queries) != 2 || queries[0] != "example. DS" || queries[1] != "example. DNSKEY" {
+		t.Errorf("queries = %v, want [example. DS example. DNSKEY]", queries)
+	}
+}
+
+func TestValidator_InsecureDelegationIsCached(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+
+	nsec := newNsec("insecure.example.", "www.example.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC)
+	nsec.Hdr.Ttl = 60
+	hierarchy.resolver["insecure.example. DS"] = &testResponse{ns: example.sign(t, nsec)}
+
+	resolver := &countingResolver{resolver: hierarchy.resolver}
+	validator := New(resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	set := []dns.RR{newA("host.insecure.example.", "192.0.2.2")}
+
+	validate := func() {
+		t.Helper()
+
+		if result := validator.ValidateRRset(context.Background(), set, nil); result.Status != dnsUtilsDnssecTypes.StatusInsecure {
+			t.Errorf("Status = %v (%s), want insecure", result.Status, result.Reason)
+		}
+	}
+
+	validate()
+	resolver.takeQueries()
+
+	// The delegation is known to be insecure, without asking for its DS
+	// records again.
+	validate()
+	if queries := resolver.takeQueries(); slices.Contains(queries, "insecure.example. DS") {
+		t.Errorf("queries = %v, want none of insecure.example. DS", queries)
+	}
+
+	// Once the minute of the NSEC TTL has passed, the proof is fetched anew.
+	later := time.Now().Add(2 * time.Minute)
+	validator.now = func() time.Time { return later }
+
+	validate()
+	if queries := resolver.takeQueries(); !slices.Contains(queries, "insecure.example. DS") {
+		t.Errorf("queries = %v, want insecure.example. DS", queries)
+	}
+}
+
+func TestValidator_ValidateMessage_Wildcard(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+	validator := New(hierarchy.resolver, WithTrustAnchors(hierarchy.root.ds()))
+
+	tests := []struct {
+		name       string
+		ns         []dns.RR
+		wantStatus dnsUtilsDnssecTypes.Status
+	}{
+		{
+			name:       "nsec",
+			ns:         example.sign(t, newNsec("b.example.", "www.example.", dns.TypeA)),
+			wantStatus: dnsUtilsDnssecTypes.StatusSecure,
+		},
+		{
+			name: "nsec3",
+			ns: example.sign(
+				t,
+				newNsec3("example.", "example.", "example.", 0, dns.TypeSOA, dns.TypeNS),
+			),
+			wantStatus: dnsUtilsDnssecTypes.StatusSecure,
+		},
+		{
+			name:       "nsec that does not cover the name",
+			ns:         example.sign(t, newNsec("www.example.", "z.example.", dns.TypeA)),
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:       "unsigned nsec",
+			ns:         []dns.RR{newNsec("b.example.", "www.example.", dns.TypeA)},
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+		{
+			name:       "no proof",
+			wantStatus: dnsUtilsDnssecTypes.StatusBogus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := new(dns.Msg)
+			message.SetQuestion("host.example.", dns.TypeA)
+			message.Response = true
+			message.Answer = wildcardExpansion(t, example, "host.example.")
+			message.Ns = tt.ns
+
+			results := validator.ValidateMessage(context.Background(), message)
+			if len(results) == 0 {
+				t.Fatal("no results")
+			}
+			if result := results[0]; result.Status != tt.wantStatus {
+				t.Errorf("Status = %v (%s), want %v", result.Status, result.Reason, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCoversNsec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		nsec *dns.NSEC
+		want bool
+	}{
+		{name: "b.example.", nsec: newNsec("a.example.", "c.example."), want: true},
+		{name: "a.example.", nsec: newNsec("a.example.", "c.example.")},
+		{name: "c.example.", nsec: newNsec("a.example.", "c.example.")},
+		{name: "x.a.example.", nsec: newNsec("a.example.", "c.example."), want: true},
+		{name: "z.example.", nsec: newNsec("y.example.", "example."), want: true},
+		{name: "b.example.", nsec: newNsec("y.example.", "example.")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.nsec.Hdr.Name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := coversNsec(tt.nsec, tt.name); got != tt.want {
+				t.Errorf("coversNsec = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
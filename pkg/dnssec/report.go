@@ -0,0 +1,427 @@
+package dnssec
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/altshiftab/utils_go/pkg/errors/types/nil_error"
+	"github.com/miekg/dns"
+)
+
+// DefaultExpiryWarning is how long before its expiration a signature is
+// reported as expiring soon.
+const DefaultExpiryWarning = 7 * 24 * time.Hour
+
+// Key is a DNSKEY record of the zone.
+type Key struct {
+	Flags         uint16 `json:"flags"`
+	Algorithm     uint8  `json:"algorithm"`
+	AlgorithmName string `json:"algorithm_name"`
+	KeyTag        uint16 `json:"key_tag"`
+	// Size is the size of the key in bits, or zero if it cannot be told.
+	Size int `json:"size"`
+	// KeySigning is set for a key with the SEP flag, which conventionally
+	// marks a key-signing key.
+	KeySigning bool `json:"key_signing"`
+	Revoked    bool `json:"revoked"`
+	// MatchesDs is set when a DS record of the parent refers to the key.
+	MatchesDs bool `json:"matches_ds"`
+}
+
+// Ds is a DS record of the zone at the parent.
+type Ds struct {
+	KeyTag         uint16 `json:"key_tag"`
+	Algorithm      uint8  `json:"algorithm"`
+	AlgorithmName  string `json:"algorithm_name"`
+	DigestType     uint8  `json:"digest_type"`
+	DigestTypeName string `json:"digest_type_name"`
+	Digest         string `json:"digest"`
+	// Matches is set when the DS record refers to a DNSKEY of the zone.
+	Matches bool `json:"matches"`
+}
+
+// Signature is an RRSIG record over an RRset of the zone.
+type Signature struct {
+	TypeCovered string    `json:"type_covered"`
+	Algorithm   uint8     `json:"algorithm"`
+	KeyTag      uint16    `json:"key_tag"`
+	SignerName  string    `json:"signer_name"`
+	Inception   time.Time `json:"inception"`
+	Expiration  time.Time `json:"expiration"`
+}
+
+// Nsec3Parameters are the parameters of the NSEC3 records of the zone.
+type Nsec3Parameters struct {
+	Hash       uint8  `json:"hash"`
+	Flags      uint8  `json:"flags"`
+	Iterations uint16 `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+// Report describes how a zone is signed.
+type Report struct {
+	// Name is the name the report was asked for, and Zone the zone it is in.
+	Name       string       `json:"name"`
+	Zone       string       `json:"zone"`
+	Keys       []*Key       `json:"keys"`
+	Ds         []*Ds        `json:"ds"`
+	Signatures []*Signature `json:"signatures"`
+	// Denial is the type of the records that prove non-existence in the zone,
+	// NSEC or NSEC3, or empty if there are none.
+	Denial string           `json:"denial"`
+	Nsec3  *Nsec3Parameters `json:"nsec3,omitempty"`
+	// Warnings are the problems that were found with the zone.
+	Warnings []string `json:"warnings"`
+}
+
+// deprecatedAlgorithm reports whether signing with the algorithm is
+// deprecated (RFC 8624 section 3.1).
+func deprecatedAlgorithm(algorithm uint8) bool {
+	switch algorithm {
+	case dns.RSAMD5, dns.DSA, dns.RSASHA1, dns.DSANSEC3SHA1, dns.RSASHA1NSEC3SHA1:
+		return true
+	}
+	return false
+}
+
+// keySize returns the size in bits of the key, or zero if it cannot be told.
+func keySize(key *dns.DNSKEY) int {
+	switch key.Algorithm {
+	case dns.ECDSAP256SHA256, dns.ED25519:
+		return 256
+	case dns.ECDSAP384SHA384:
+		return 384
+	case dns.ED448:
+		return 456
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(publicKey) == 0 {
+		return 0
+	}
+
+	switch key.Algorithm {
+	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		// The exponent length is one octet, or three if the first is zero
+		// (RFC 3110 section 2).
+		exponentLength, offset := int(publicKey[0]), 1
+		if exponentLength == 0 {
+			if len(publicKey) < 3 {
+				return 0
+			}
+			exponentLength, offset = int(publicKey[1])<<8|int(publicKey[2]), 3
+		}
+		if offset+exponentLength >= len(publicKey) {
+			return 0
+		}
+		return new(big.Int).SetBytes(publicKey[offset+exponentLength:]).BitLen()
+	case dns.DSA, dns.DSANSEC3SHA1:
+		// The size follows from the T parameter (RFC 2536 section 2).
+		return 512 + 64*int(publicKey[0])
+	}
+
+	return 0
+}
+
+type ReportOption func(*reporter)
+
+// reporter gathers the records of a report with the exchanger.
+type reporter struct {
+	exchanger     Exchanger
+	expiryWarning time.Duration
+	now           func() time.Time
+}
+
+// WithExpiryWarning sets how long before its expiration a signature is
+// reported as expiring soon.
+func WithExpiryWarning(expiryWarning time.Duration) ReportOption {
+	return func(reporter *reporter) {
+		reporter.expiryWarning = expiryWarning
+	}
+}
+
+// reportSignatures returns the signatures for the report.
+func reportSignatures(signatures []*dns.RRSIG) []*Signature {
+	var reported []*Signature
+	for _, signature := range signatures {
+		reported = append(reported, &Signature{
+			TypeCovered: dns.TypeToString[signature.TypeCovered],
+			Algorithm:   signature.Algorithm,
+			KeyTag:      signature.KeyTag,
+			SignerName:  signature.SignerName,
+			Inception:   time.Unix(int64(signature.Inception), 0).UTC(),
+			Expiration:  time.Unix(int64(signature.Expiration), 0).UTC(),
+		})
+	}
+	return reported
+}
+
+// zoneOf returns the zone that the name is in, from the SOA record in the
+// response to a SOA query.
+func zoneOf(response *dns.Msg) (string, bool) {
+	for _, section := range [][]dns.RR{response.Answer, response.Ns} {
+		for _, record := range section {
+			if soa, ok := record.(*dns.SOA); ok {
+				return dns.Fqdn(soa.Hdr.Name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// GetReport fetches the DNSKEY and SOA records of the zone of the domain, its
+// DS records at the parent, and the records that prove non-existence in it,
+// with the exchanger, and reports how the zone is signed.
+func GetReport(ctx context.Context, exchanger Exchanger, domain string, options ...ReportOption) (*Report, error) {
+	if exchanger == nil {
+		return nil, altshiftErrors.NewWithTrace(nil_error.New("exchanger"))
+	}
+
+	reporter := &reporter{exchanger: exchanger, expiryWarning: DefaultExpiryWarning, now: time.Now}
+	for _, option := range options {
+		if option != nil {
+			option(reporter)
+		}
+	}
+
+	return reporter.report(ctx, dns.Fqdn(domain))
+}
+
+// GetSignatures fetches the RRsets of the name with the types with the
+// exchanger, and returns their signatures. A type without records has none.
+func GetSignatures(ctx context.Context, exchanger Exchanger, name string, recordTypes ...uint16) ([]*Signature, error) {
+	if exchanger == nil {
+		return nil, altshiftErrors.NewWithTrace(nil_error.New("exchanger"))
+	}
+
+	name = dns.Fqdn(name)
+
+	var signatures []*Signature
+	for _, recordType := range recordTypes {
+		typeString := strings.ToLower(dns.TypeToString[recordType])
+
+		response, err := query(ctx, exchanger, name, recordType)
+		if err != nil {
+			return nil, altshiftErrors.NewWithTrace(fmt.Errorf("query (%s): %w", typeString, err), name)
+		}
+		if response.Rcode == dns.RcodeNameError {
+			return nil, altshiftErrors.NewWithTrace(
+				fmt.Errorf("query (%s): %w", typeString, dnsUtilsErrors.NewRcodeError(response)),
+				name,
+			)
+		}
+
+		_, rrsetSignatures := rrset(response.Answer, name, recordType)
+		signatures = append(signatures, reportSignatures(rrsetSignatures)...)
+	}
+
+	return signatures, nil
+}
+
+func (r *reporter) report(ctx context.Context, name string) (*Report, error) {
+	soaResponse, err := query(ctx, r.exchanger, name, dns.TypeSOA)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("query (soa): %w", err), name)
+	}
+	if soaResponse.Rcode == dns.RcodeNameError {
+		return nil, altshiftErrors.NewWithTrace(
+			fmt.Errorf("query (soa): %w", dnsUtilsErrors.NewRcodeError(soaResponse)),
+			name,
+		)
+	}
+	zone, ok := zoneOf(soaResponse)
+	if !ok {
+		return nil, altshiftErrors.NewWithTrace(dnsUtilsErrors.ErrNoSoaRecord, name)
+	}
+
+	report := &Report{Name: name, Zone: zone}
+
+	soaSet, soaSignatures := rrset(soaResponse.Answer, zone, dns.TypeSOA)
+	if len(soaSet) == 0 {
+		// The SOA record of a name below the apex is in the authority section.
+		_, soaSignatures = rrset(soaResponse.Ns, zone, dns.TypeSOA)
+	}
+	report.Signatures = append(report.Signatures, reportSignatures(soaSignatures)...)
+
+	dnskeyResponse, err := query(ctx, r.exchanger, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("query (dnskey): %w", err), zone)
+	}
+	dnskeySet, dnskeySignatures := rrset(dnskeyResponse.Answer, zone, dns.TypeDNSKEY)
+	report.Signatures = append(report.Signatures, reportSignatures(dnskeySignatures)...)
+
+	var dsSet []dns.RR
+	if zone != "." {
+		dsResponse, err := query(ctx, r.exchanger, zone, dns.TypeDS)
+		if err != nil {
+			return nil, altshiftErrors.NewWithTrace(fmt.Errorf("query (ds): %w", err), zone)
+		}
+		var dsSignatures []*dns.RRSIG
+		dsSet, dsSignatures = rrset(dsResponse.Answer, zone, dns.TypeDS)
+		report.Signatures = append(report.Signatures, reportSignatures(dsSignatures)...)
+	}
+
+	nsec3paramResponse, err := query(ctx, r.exchanger, zone, dns.TypeNSEC3PARAM)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("query (nsec3param): %w", err), zone)
+	}
+	r.denial(report, nsec3paramResponse)
+
+	r.keys(report, dnskeySet, dsSet)
+	r.warn(report)
+
+	return report, nil
+}
+
+// denial tells how the zone proves non-existence from the response to an
+// NSEC3PARAM query at its apex: with the NSEC3PARAM record if there is one,
+// and with the NSEC or NSEC3 record that proves that there is none otherwise.
+func (r *reporter) denial(report *Report, response *dns.Msg) {
+	for _, record := range response.Answer {
+		if nsec3param, ok := record.(*dns.NSEC3PARAM); ok {
+			report.Denial = "NSEC3"
+			report.Nsec3 = &Nsec3Parameters{
+				Hash:       nsec3param.Hash,
+				Flags:      nsec3param.Flags,
+				Iterations: nsec3param.Iterations,
+				Salt:       nsec3param.Salt,
+			}
+			return
+		}
+	}
+
+	for _, record := range response.Ns {
+		switch typedRecord := record.(type) {
+		case *dns.NSEC:
+			report.Denial = "NSEC"
+			return
+		case *dns.NSEC3:
+			report.Denial = "NSEC3"
+			report.Nsec3 = &Nsec3Parameters{
+				Hash:       typedRecord.Hash,
+				Flags:      typedRecord.Flags,
+				Iterations: typedRecord.Iterations,
+				Salt:       typedRecord.Salt,
+			}
+			return
+		}
+	}
+}
+
+// keys adds the DNSKEY and DS records to the report, and matches them up.
+func (r *reporter) keys(report *Report, dnskeySet []dns.RR, dsSet []dns.RR) {
+	var dnskeys []*dns.DNSKEY
+	for _, record := range dnskeySet {
+		dnskeys = append(dnskeys, record.(*dns.DNSKEY))
+	}
+
+	for _, record := range dsSet {
+		ds := record.(*dns.DS)
+		reportDs := &Ds{
+			KeyTag:         ds.KeyTag,
+			Algorithm:      ds.Algorithm,
+			AlgorithmName:  dns.AlgorithmToString[ds.Algorithm],
+			DigestType:     ds.DigestType,
+			DigestTypeName: dns.HashToString[ds.DigestType],
+			Digest:         strings.ToUpper(ds.Digest),
+		}
+		for _, key := range dnskeys {
+			if MatchesDs(key, ds) {
+				reportDs.Matches = true
+				break
+			}
+		}
+		report.Ds = append(report.Ds, reportDs)
+	}
+
+	for _, key := range dnskeys {
+		reportKey := &Key{
+			Flags:         key.Flags,
+			Algorithm:     key.Algorithm,
+			AlgorithmName: dns.AlgorithmToString[key.Algorithm],
+			KeyTag:        key.KeyTag(),
+			Size:          keySize(key),
+			KeySigning:    key.Flags&dns.SEP != 0,
+			Revoked:       key.Flags&dns.REVOKE != 0,
+		}
+		for _, record := range dsSet {
+			if MatchesDs(key, record.(*dns.DS)) {
+				reportKey.MatchesDs = true
+				break
+			}
+		}
+		report.Keys = append(report.Keys, reportKey)
+	}
+}
+
+// warn adds the warnings about the zone to the report.
+func (r *reporter) warn(report *Report) {
+	warn := func(format string, arguments ...any) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(format, arguments...))
+	}
+
+	if len(report.Keys) == 0 {
+		if len(report.Ds) != 0 {
+			warn("the parent has DS records but the zone has no DNSKEY records")
+		}
+		return
+	}
+	if len(report.Ds) == 0 {
+		warn("the zone has DNSKEY records but the parent has no DS records")
+	}
+
+	for _, key := range report.Keys {
+		if deprecatedAlgorithm(key.Algorithm) {
+			warn("the DNSKEY %d uses the deprecated algorithm %s", key.KeyTag, key.AlgorithmName)
+		}
+	}
+	for _, ds := range report.Ds {
+		if deprecatedAlgorithm(ds.Algorithm) {
+			warn("the DS record %d uses the deprecated algorithm %s", ds.KeyTag, ds.AlgorithmName)
+		}
+		if ds.DigestType == dns.SHA1 {
+			warn("the DS record %d uses the deprecated digest type SHA1", ds.KeyTag)
+		}
+		if !ds.Matches {
+			warn("the DS record %d matches no DNSKEY", ds.KeyTag)
+		}
+	}
+
+	now := r.now()
+	for _, signature := range report.Signatures {
+		switch {
+		case now.After(signature.Expiration):
+			warn(
+				"the signature by key %d over %s expired at %s",
+				signature.KeyTag,
+				signature.TypeCovered,
+				signature.Expiration.Format(time.RFC3339),
+			)
+		case now.Before(signature.Inception):
+			warn(
+				"the signature by key %d over %s is not valid until %s",
+				signature.KeyTag,
+				signature.TypeCovered,
+				signature.Inception.Format(time.RFC3339),
+			)
+		case signature.Expiration.Sub(now) < r.expiryWarning:
+			warn(
+				"the signature by key %d over %s expires at %s",
+				signature.KeyTag,
+				signature.TypeCovered,
+				signature.Expiration.Format(time.RFC3339),
+			)
+		}
+	}
+
+	if report.Nsec3 != nil && report.Nsec3.Iterations > 0 {
+		// RFC 9276 section 3.1.
+		warn("the NSEC3 records use %d additional iterations instead of 0", report.Nsec3.Iterations)
+	}
+}
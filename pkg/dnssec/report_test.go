@@ -0,0 +1,238 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+func newSoa(name string) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:      "ns." + name,
+		Mbox:    "hostmaster." + name,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  300,
+	}
+}
+
+func TestGetReport(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+	other := newTestZone(t, "example.")
+
+	soa := example.sign(t, newSoa("example."))
+	resolver := testResolver{
+		"example. SOA":         {answer: soa},
+		"www.example. SOA":     {ns: soa},
+		"nothere.example. SOA": {rcode: dns.RcodeNameError, ns: soa},
+		"example. DNSKEY":      hierarchy.resolver["example. DNSKEY"],
+		"example. DS":          hierarchy.resolver["example. DS"],
+		"example. NSEC3PARAM": {
+			ns: example.sign(t, newNsec("example.", "www.example.", dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY)),
+		},
+	}
+
+	// A zone whose DS record refers to another key, with NSEC3.
+	mismatched := testResolver{
+		"example. SOA":    resolver["example. SOA"],
+		"example. DNSKEY": resolver["example. DNSKEY"],
+		"example. DS":     {answer: hierarchy.root.sign(t, other.ds())},
+		"example. NSEC3PARAM": {
+			answer: example.sign(t, &dns.NSEC3PARAM{
+				Hdr:        dns.RR_Header{Name: "example.", Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET},
+				Hash:       dns.SHA1,
+				Iterations: 10,
+				SaltLength: 2,
+				Salt:       "ABCD",
+			}),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		resolver     testResolver
+		domain       string
+		options      []ReportOption
+		wantZone     string
+		wantDenial   string
+		wantMatches  bool
+		wantWarnings []string
+		wantErr      error
+	}{
+		{
+			name:        "apex",
+			resolver:    resolver,
+			domain:      "example",
+			wantZone:    "example.",
+			wantDenial:  "NSEC",
+			wantMatches: true,
+		},
+		{
+			name:        "below the apex",
+			resolver:    resolver,
+			domain:      "www.example.",
+			wantZone:    "example.",
+			wantDenial:  "NSEC",
+			wantMatches: true,
+		},
+		{
+			name:        "expiring signatures",
+			resolver:    resolver,
+			domain:      "example.",
+			options:     []ReportOption{WithExpiryWarning(2 * time.Hour)},
+			wantZone:    "example.",
+			wantDenial:  "NSEC",
+			wantMatches: true,
+			wantWarnings: []string{
+				"over SOA expires",
+				"over DNSKEY expires",
+				"over DS expires",
+			},
+		},
+		{
+			name:       "mismatched ds",
+			resolver:   mismatched,
+			domain:     "example.",
+			wantZone:   "example.",
+			wantDenial: "NSEC3",
+			wantWarnings: []string{
+				"matches no DNSKEY",
+				"10 additional iterations",
+			},
+		},
+		{
+			name:     "nxdomain",
+			resolver: resolver,
+			domain:   "nothere.example.",
+			wantErr:  dnsUtilsErrors.ErrUnsuccessfulRcode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The test signatures expire within the default warning period.
+			options := append([]ReportOption{WithExpiryWarning(time.Minute)}, tt.options...)
+
+			report, err := GetReport(context.Background(), tt.resolver, tt.domain, options...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if report.Zone != tt.wantZone {
+				t.Errorf("Zone = %q, want %q", report.Zone, tt.wantZone)
+			}
+			if report.Denial != tt.wantDenial {
+				t.Errorf("Denial = %q, want %q", report.Denial, tt.wantDenial)
+			}
+			if len(report.Keys) != 1 || len(report.Ds) != 1 {
+				t.Fatalf("%d keys and %d DS records, want 1 of each", len(report.Keys), len(report.Ds))
+			}
+			key := report.Keys[0]
+			if key.KeyTag != example.key.KeyTag() || key.Size != 256 || !key.KeySigning || key.AlgorithmName != "ECDSAP256SHA256" {
+				t.Errorf("Keys[0] = %+v", key)
+			}
+			if key.MatchesDs != tt.wantMatches || report.Ds[0].Matches != tt.wantMatches {
+				t.Errorf("MatchesDs = %v, Matches = %v, want %v", key.MatchesDs, report.Ds[0].Matches, tt.wantMatches)
+			}
+			if len(report.Signatures) != 3 {
+				t.Errorf("len(Signatures) = %d, want 3", len(report.Signatures))
+			}
+			for _, signature := range report.Signatures {
+				if !signature.Inception.Before(time.Now()) || !signature.Expiration.After(time.Now()) {
+					t.Errorf("the signature over %s is valid from %s to %s", signature.TypeCovered, signature.Inception, signature.Expiration)
+				}
+			}
+
+			if len(report.Warnings) != len(tt.wantWarnings) {
+				t.Fatalf("Warnings = %q, want %d", report.Warnings, len(tt.wantWarnings))
+			}
+			for i, want := range tt.wantWarnings {
+				if !strings.Contains(report.Warnings[i], want) {
+					t.Errorf("Warnings[%d] = %q, want it to contain %q", i, report.Warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		algorithm uint8
+		bits      int
+	}{
+		{name: "rsa", algorithm: dns.RSASHA256, bits: 1024},
+		{name: "rsasha1", algorithm: dns.RSASHA1, bits: 2048},
+		{name: "ecdsa", algorithm: dns.ECDSAP384SHA384, bits: 384},
+		{name: "ed25519", algorithm: dns.ED25519, bits: 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			key := &dns.DNSKEY{
+				Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+				Flags:     dns.ZONE,
+				Protocol:  3,
+				Algorithm: tt.algorithm,
+			}
+			if _, err := key.Generate(tt.bits); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			if got := keySize(key); got != tt.bits {
+				t.Errorf("keySize = %d, want %d", got, tt.bits)
+			}
+		})
+	}
+}
+
+func TestGetSignatures(t *testing.T) {
+	t.Parallel()
+
+	hierarchy := newTestHierarchy(t)
+	example := hierarchy.example
+
+	resolver := testResolver{
+		"example. SOA": {answer: example.sign(t, newSoa("example."))},
+		"example. A":   {answer: example.sign(t, newA("example.", "192.0.2.1"))},
+		"example. MX":  {},
+	}
+
+	signatures, err := GetSignatures(context.Background(), resolver, "example", dns.TypeSOA, dns.TypeA, dns.TypeMX)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(signatures) != 2 {
+		t.Fatalf("len(signatures) = %d, want 2", len(signatures))
+	}
+	if signatures[0].TypeCovered != "SOA" || signatures[1].TypeCovered != "A" {
+		t.Errorf("signatures cover %s and %s, want SOA and A", signatures[0].TypeCovered, signatures[1].TypeCovered)
+	}
+	if signatures[0].SignerName != "example." || signatures[0].KeyTag != example.key.KeyTag() {
+		t.Errorf("signatures[0] = %+v", signatures[0])
+	}
+}
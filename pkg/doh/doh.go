@@ -0,0 +1,240 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsDohErrors "github.com/Motmedel/dns_utils/pkg/doh/errors"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	altshiftTlsTypes "github.com/altshiftab/utils_go/pkg/tls/types"
+	"github.com/miekg/dns"
+)
+
+const (
+	MediaType = "application/dns-message"
+	// QueryParameter is the name of the GET request parameter that carries the
+	// message.
+	QueryParameter = "dns"
+)
+
+// Exchanger exchanges messages over DNS-over-HTTPS (RFC 8484). The server
+// address is the URL of the DoH endpoint, e.g. https://dns.google/dns-query.
+type Exchanger struct {
+	// HttpClient is used for the requests; http.DefaultClient when nil.
+	HttpClient *http.Client
+	// Method is http.MethodGet or http.MethodPost; POST when empty.
+	Method string
+}
+
+func (e *Exchanger) Exchange(ctx context.Context, message *dns.Msg, serverUrl string) (*dns.Msg, error) {
+	var httpClient *http.Client
+	var method string
+	if e != nil {
+		httpClient = e.HttpClient
+		method = e.Method
+	}
+
+	return ExchangeWithMethod(ctx, message, serverUrl, method, httpClient)
+}
+
+// Exchange sends the message to the DoH endpoint with a POST request.
+func Exchange(ctx context.Context, message *dns.Msg, serverUrl string, httpClient *http.Client) (*dns.Msg, error) {
+	return ExchangeWithMethod(ctx, message, serverUrl, http.MethodPost, httpClient)
+}
+
+func newRequest(ctx context.Context, method string, serverUrl string, messageBytes []byte) (*http.Request, error) {
+	switch method {
+	case http.MethodGet:
+		parsedUrl, err := url.Parse(serverUrl)
+		if err != nil {
+			return nil, altshiftErrors.NewWithTrace(fmt.Errorf("url parse: %w", err), serverUrl)
+		}
+
+		query := parsedUrl.Query()
+		query.Set(QueryParameter, base64.RawURLEncoding.EncodeToString(messageBytes))
+		parsedUrl.RawQuery = query.Encode()
+
+		request, err := http.NewRequestWithContext(ctx, method, parsedUrl.String(), nil)
+		if err != nil {
+			return nil, altshiftErrors.NewWithTrace(fmt.Errorf("http new request with context: %w", err))
+		}
+
+		return request, nil
+	case http.MethodPost:
+		request, err := http.NewRequestWithContext(ctx, method, serverUrl, bytes.NewReader(messageBytes))
+		if err != nil {
+			return nil, altshiftErrors.NewWithTrace(fmt.Errorf("http new request with context: %w", err))
+		}
+		request.Header.Set("Content-Type", MediaType)
+
+		return request, nil
+	default:
+		return nil, altshiftErrors.NewWithTrace(
+			fmt.Errorf("%w: %s", dnsUtilsDohErrors.ErrUnsupportedMethod, method),
+		)
+	}
+}
+
+// ExchangeWithMethod sends the message to the DoH endpoint with a GET request,
+// the message in the base64url-encoded "dns" parameter, or a POST request, the
+// message as the body.
+func ExchangeWithMethod(
+	ctx context.Context,
+	message *dns.Msg,
+	serverUrl string,
+	method string,
+	httpClient *http.Client,
+) (*dns.Msg, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	dnsContext.QuestionMessage = message
+	if dnsContext.ServerAddress == "" {
+		dnsContext.ServerAddress = serverUrl
+	}
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	if serverUrl == "" {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	// RFC 8484 section 4.1: the ID should be zero, so that the responses are
+	// cacheable. The caller's ID is put back on the response.
+	requestMessage := message.Copy()
+	requestMessage.Id = 0
+
+	messageBytes, err := requestMessage.Pack()
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("request pack: %w", err))
+	}
+
+	request, err := newRequest(ctx, method, serverUrl, messageBytes)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("new request: %w", err))
+	}
+	request.Header.Set("Accept", MediaType)
+
+	var localAddrString string
+	var remoteAddrString string
+	var transport string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if connection := info.Conn; connection != nil {
+				if localAddr := connection.LocalAddr(); localAddr != nil {
+					localAddrString = localAddr.String()
+				}
+				if remoteAddr := connection.RemoteAddr(); remoteAddr != nil {
+					remoteAddrString = remoteAddr.String()
+					transport = remoteAddr.Network()
+				}
+			}
+		},
+	}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("http client do: %w", err))
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			slog.WarnContext(
+				altshiftContext.WithError(
+					ctx,
+					altshiftErrors.NewWithTrace(fmt.Errorf("response body close: %w", err)),
+				),
+				"An error occurred when closing a response body.",
+			)
+		}
+	}()
+
+	if remoteAddrString != "" {
+		dnsContext.ClientAddress = localAddrString
+		dnsContext.ServerAddress = remoteAddrString
+	}
+	if transport == "" {
+		// HTTP/3 runs over QUIC; the earlier versions over TCP.
+		transport = "tcp"
+		if response.ProtoMajor == 3 {
+			transport = "udp"
+		}
+	}
+	dnsContext.Transport = transport
+
+	if connectionState := response.TLS; connectionState != nil {
+		dnsContext.TlsContext = &altshiftTlsTypes.TlsContext{
+			ConnectionState: connectionState,
+			ClientInitiated: true,
+		}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			&dnsUtilsDohErrors.StatusCodeError{StatusCode: response.StatusCode},
+		)
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != MediaType {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("%w: %q", dnsUtilsDohErrors.ErrUnexpectedContentType, contentType),
+		)
+	}
+
+	// A DNS message cannot be longer than 65535 bytes; read one more to tell.
+	responseBytes, err := io.ReadAll(io.LimitReader(response.Body, dns.MaxMsgSize+1))
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("io read all: %w", err))
+	}
+	if len(responseBytes) > dns.MaxMsgSize {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, dnsUtilsDohErrors.ErrMessageLengthOverflow)
+	}
+
+	var responseMessage dns.Msg
+	if err := responseMessage.Unpack(responseBytes); err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("response unpack: %w", err))
+	}
+	responseMessage.Id = message.Id
+
+	t := time.Now()
+	dnsContext.Time = &t
+	dnsContext.AnswerMessage = &responseMessage
+
+	if responseMessage.Rcode != dns.RcodeSuccess {
+		return &responseMessage, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			dnsUtilsErrors.NewRcodeError(&responseMessage),
+		)
+	}
+
+	return &responseMessage, nil
+}
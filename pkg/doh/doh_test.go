@@ -0,0 +1,223 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsDohErrors "github.com/Motmedel/dns_utils/pkg/doh/errors"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	"github.com/miekg/dns"
+)
+
+// startTestDohServer starts a local DoH endpoint that answers with the
+// supplied rcode and an A record, and reports the method and message ID of
+// each request on the returned channel.
+func startTestDohServer(t *testing.T, rcode int) (*httptest.Server, <-chan *dns.Msg) {
+	t.Helper()
+
+	requests := make(chan *dns.Msg, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var messageBytes []byte
+		switch r.Method {
+		case http.MethodGet:
+			var err error
+			messageBytes, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get(QueryParameter))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != MediaType {
+				http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			messageBytes, _ = io.ReadAll(r.Body)
+		}
+
+		var request dns.Msg
+		if err := request.Unpack(messageBytes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- &request
+
+		response := new(dns.Msg)
+		response.SetRcode(&request, rcode)
+		if rcode == dns.RcodeSuccess {
+			record, _ := dns.NewRR(request.Question[0].Name + " 60 IN A 192.0.2.1")
+			response.Answer = append(response.Answer, record)
+		}
+
+		responseBytes, _ := response.Pack()
+		w.Header().Set("Content-Type", MediaType)
+		_, _ = w.Write(responseBytes)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+func TestExchange_NilMessage(t *testing.T) {
+	t.Parallel()
+
+	got, err := Exchange(context.Background(), nil, "https://dns.example/dns-query", nil)
+	if err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+	if got != nil {
+		t.Errorf("got = %v, want nil", got)
+	}
+}
+
+func TestExchange_EmptyServer(t *testing.T) {
+	t.Parallel()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+
+	_, err := Exchange(context.Background(), msg, "", nil)
+
+	var ee *empty_error.Error
+	if !errors.As(err, &ee) {
+		t.Fatalf("err type = %T (%v), want *empty_error.Error", err, err)
+	}
+	if ee.Field != "dns server" {
+		t.Errorf("Field = %q, want %q", ee.Field, "dns server")
+	}
+}
+
+func TestExchangeWithMethod_UnsupportedMethod(t *testing.T) {
+	t.Parallel()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+
+	_, err := ExchangeWithMethod(context.Background(), msg, "https://dns.example/dns-query", http.MethodPut, nil)
+	if !errors.Is(err, dnsUtilsDohErrors.ErrUnsupportedMethod) {
+		t.Errorf("err = %v, want ErrUnsupportedMethod", err)
+	}
+}
+
+func TestExchangeWithMethod(t *testing.T) {
+	t.Parallel()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			t.Parallel()
+
+			server, requests := startTestDohServer(t, dns.RcodeSuccess)
+
+			msg := new(dns.Msg)
+			msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+			msg.Id = 4711
+
+			dnsContext := &dnsUtilsTypes.DnsContext{}
+			ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+			got, err := ExchangeWithMethod(ctx, msg, server.URL+"/dns-query", method, server.Client())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if request := <-requests; request.Id != 0 {
+				t.Errorf("request ID = %d, want 0", request.Id)
+			}
+			if got.Id != msg.Id {
+				t.Errorf("response ID = %d, want %d", got.Id, msg.Id)
+			}
+			if len(got.Answer) != 1 {
+				t.Fatalf("len(Answer) = %d, want 1", len(got.Answer))
+			}
+
+			if dnsContext.AnswerMessage != got {
+				t.Error("DnsContext.AnswerMessage is not the response")
+			}
+			if dnsContext.Transport != "tcp" {
+				t.Errorf("DnsContext.Transport = %q, want tcp", dnsContext.Transport)
+			}
+			if dnsContext.ServerAddress != server.Listener.Addr().String() {
+				t.Errorf("DnsContext.ServerAddress = %q, want %q", dnsContext.ServerAddress, server.Listener.Addr().String())
+			}
+			if dnsContext.ClientAddress == "" {
+				t.Error("DnsContext.ClientAddress is empty")
+			}
+			if dnsContext.TlsContext == nil || dnsContext.TlsContext.ConnectionState == nil {
+				t.Error("DnsContext.TlsContext = nil, want the connection state")
+			}
+			if dnsContext.Time == nil {
+				t.Error("DnsContext.Time = nil")
+			}
+		})
+	}
+}
+
+func TestExchange_RcodeErrorCarriesTheResponse(t *testing.T) {
+	t.Parallel()
+
+	server, _ := startTestDohServer(t, dns.RcodeNameError)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn("missing.example.com"), dns.TypeA)
+
+	got, err := Exchange(context.Background(), msg, server.URL, server.Client())
+
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok {
+		t.Fatalf("err type = %T (%v), want *dnsUtilsErrors.RcodeError", err, err)
+	}
+	if rcodeError.Rcode != dns.RcodeNameError {
+		t.Errorf("Rcode = %d, want %d", rcodeError.Rcode, dns.RcodeNameError)
+	}
+	if got == nil || got.Rcode != dns.RcodeNameError {
+		t.Errorf("got = %v, want the NXDOMAIN response", got)
+	}
+}
+
+func TestExchange_UnexpectedStatusCode(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+
+	_, err := Exchange(context.Background(), msg, server.URL, server.Client())
+
+	statusCodeError, ok := errors.AsType[*dnsUtilsDohErrors.StatusCodeError](err)
+	if !ok {
+		t.Fatalf("err type = %T (%v), want *StatusCodeError", err, err)
+	}
+	if statusCodeError.StatusCode != http.StatusBadGateway {
+		t.Errorf("StatusCode = %d, want %d", statusCodeError.StatusCode, http.StatusBadGateway)
+	}
+}
+
+func TestExchange_UnexpectedContentType(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	t.Cleanup(server.Close)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+
+	_, err := Exchange(context.Background(), msg, server.URL, server.Client())
+	if !errors.Is(err, dnsUtilsDohErrors.ErrUnexpectedContentType) {
+		t.Errorf("err = %v, want ErrUnexpectedContentType", err)
+	}
+}
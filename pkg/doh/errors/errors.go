@@ -0,0 +1,25 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnsupportedMethod     = errors.New("unsupported method")
+	ErrUnexpectedStatusCode  = errors.New("unexpected status code")
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+	ErrMessageLengthOverflow = errors.New("message length overflow")
+)
+
+type StatusCodeError struct {
+	StatusCode int
+}
+
+func (e *StatusCodeError) Is(target error) bool {
+	return target == ErrUnexpectedStatusCode
+}
+
+func (e *StatusCodeError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrUnexpectedStatusCode, e.StatusCode)
+}
@@ -0,0 +1,28 @@
+package errors
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestStatusCodeError_Error(t *testing.T) {
+	t.Parallel()
+
+	err := &StatusCodeError{StatusCode: http.StatusBadGateway}
+	if got, want := err.Error(), "unexpected status code: 502"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestStatusCodeError_Is(t *testing.T) {
+	t.Parallel()
+
+	err := error(&StatusCodeError{StatusCode: http.StatusNotFound})
+	if !errors.Is(err, ErrUnexpectedStatusCode) {
+		t.Errorf("errors.Is(err, ErrUnexpectedStatusCode) = false, want true")
+	}
+	if errors.Is(err, ErrUnexpectedContentType) {
+		t.Errorf("errors.Is(err, ErrUnexpectedContentType) = true, want false")
+	}
+}
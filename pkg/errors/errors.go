@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
 	"github.com/miekg/dns"
 )
 
@@ -11,16 +12,45 @@ var (
 	ErrUnsetRecordType   = errors.New("unset record type")
 	ErrUnsuccessfulRcode = errors.New("unsuccessful rcode")
 	ErrMultipleRecords   = errors.New("multiple records")
+	ErrSpkiPinMismatch   = errors.New("spki pin mismatch")
+	ErrResponseMismatch  = errors.New("response mismatch")
+	ErrPossibleSpoofing  = errors.New("possible spoofing")
+	ErrExtendedDnsError  = errors.New("extended dns error")
+	ErrNoSoaRecord       = errors.New("no soa record")
+	ErrDnssecBogus       = errors.New("dnssec bogus")
 )
 
 type RcodeError struct {
 	Rcode int
+	// ExtendedErrors are the Extended DNS Errors of the response (RFC 8914),
+	// which errors.As finds in turn.
+	ExtendedErrors []*ExtendedDnsError
+}
+
+// NewRcodeError returns the error for a response with an unsuccessful rcode,
+// with the Extended DNS Errors of its OPT record.
+func NewRcodeError(message *dns.Msg) *RcodeError {
+	if message == nil {
+		return nil
+	}
+
+	return &RcodeError{Rcode: message.Rcode, ExtendedErrors: NewExtendedDnsErrors(message)}
 }
 
 func (e *RcodeError) Is(target error) bool {
 	return target == ErrUnsuccessfulRcode
 }
 
+func (e *RcodeError) Unwrap() []error {
+	var errs []error
+	for _, extendedError := range e.ExtendedErrors {
+		if extendedError != nil {
+			errs = append(errs, extendedError)
+		}
+	}
+	return errs
+}
+
 func (e *RcodeError) Error() string {
 	rcode := e.Rcode
 
@@ -29,6 +59,62 @@ func (e *RcodeError) Error() string {
 		msg += fmt.Sprintf(" (%s)", rcodeString)
 	}
 
+	for _, extendedError := range e.ExtendedErrors {
+		if extendedError != nil {
+			msg += ": " + extendedError.Error()
+		}
+	}
+
+	return msg
+}
+
+// ExtendedDnsError is an Extended DNS Error of a response (RFC 8914), which
+// tells why it failed, for example "DNSSEC Bogus" or "Blocked".
+type ExtendedDnsError struct {
+	// Rcode is the rcode of the response.
+	Rcode     int
+	InfoCode  uint16
+	ExtraText string
+}
+
+// NewExtendedDnsErrors returns the Extended DNS Errors of the OPT record of the
+// message, in order.
+func NewExtendedDnsErrors(message *dns.Msg) []*ExtendedDnsError {
+	if message == nil {
+		return nil
+	}
+
+	opt := message.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	var extendedErrors []*ExtendedDnsError
+	for _, option := range opt.Option {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok {
+			extendedErrors = append(
+				extendedErrors,
+				&ExtendedDnsError{Rcode: message.Rcode, InfoCode: ede.InfoCode, ExtraText: ede.ExtraText},
+			)
+		}
+	}
+
+	return extendedErrors
+}
+
+func (e *ExtendedDnsError) Is(target error) bool {
+	return target == ErrExtendedDnsError
+}
+
+func (e *ExtendedDnsError) Error() string {
+	msg := fmt.Sprintf("%s: %d", ErrExtendedDnsError, e.InfoCode)
+	if infoCodeString, ok := dns.ExtendedErrorCodeToString[e.InfoCode]; ok && infoCodeString != "" {
+		msg += fmt.Sprintf(" (%s)", infoCodeString)
+	}
+	if e.ExtraText != "" {
+		msg += fmt.Sprintf(": %q", e.ExtraText)
+	}
+
 	return msg
 }
 
@@ -47,3 +133,60 @@ func (e *MultipleRecordsError) Error() string {
 func (e *MultipleRecordsError) GetInput() any {
 	return e.Records
 }
+
+// ResponseMismatchError is returned for a response that does not answer the
+// query: one whose field differs from that of the query.
+type ResponseMismatchError struct {
+	// Field names what differs, such as "question name" or "opcode".
+	Field    string
+	Query    string
+	Response string
+}
+
+func (e *ResponseMismatchError) Is(target error) bool {
+	return target == ErrResponseMismatch
+}
+
+func (e *ResponseMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s: %q, want %q", ErrResponseMismatch, e.Field, e.Response, e.Query)
+}
+
+// SpoofingError is returned for a response that may be spoofed: one whose
+// question name does not preserve the randomized letter case of the query
+// (DNS 0x20).
+type SpoofingError struct {
+	Query    string
+	Response string
+}
+
+func (e *SpoofingError) Is(target error) bool {
+	return target == ErrPossibleSpoofing
+}
+
+func (e *SpoofingError) Error() string {
+	return fmt.Sprintf("%s: question name %q, want %q", ErrPossibleSpoofing, e.Response, e.Query)
+}
+
+// DnssecBogusError is returned for a response that fails DNSSEC validation: an
+// RRset, or the proof of non-existence, that should be signed but whose
+// signatures do not validate (RFC 4035 section 4.3).
+type DnssecBogusError struct {
+	// Result is the validation of the RRset that is bogus; for a proof of
+	// non-existence, its type is NSEC or NSEC3.
+	Result *dnsUtilsDnssecTypes.Result
+}
+
+func (e *DnssecBogusError) Is(target error) bool {
+	return target == ErrDnssecBogus
+}
+
+func (e *DnssecBogusError) Error() string {
+	if e.Result == nil {
+		return ErrDnssecBogus.Error()
+	}
+
+	return fmt.Sprintf(
+		"%s: %s %s: %s",
+		ErrDnssecBogus, e.Result.Name, dns.TypeToString[e.Result.Type], e.Result.Reason,
+	)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"testing"
 
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
 	"github.com/miekg/dns"
 )
 
@@ -54,6 +55,52 @@ func TestRcodeError_AsTarget(t *testing.T) {
 	}
 }
 
+func TestNewRcodeError_ExtendedErrors(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.Rcode = dns.RcodeServerFailure
+	message.SetEdns0(4096, false)
+	message.IsEdns0().Option = append(
+		message.IsEdns0().Option,
+		&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked, ExtraText: "policy"},
+	)
+
+	err := error(NewRcodeError(message))
+
+	if got, want := err.Error(), `unsuccessful rcode: 2 (SERVFAIL): extended dns error: 15 (Blocked): "policy"`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrUnsuccessfulRcode) || !errors.Is(err, ErrExtendedDnsError) {
+		t.Errorf("errors.Is: want both ErrUnsuccessfulRcode and ErrExtendedDnsError")
+	}
+
+	extendedError, ok := errors.AsType[*ExtendedDnsError](err)
+	if !ok {
+		t.Fatal("errors.As did not match *ExtendedDnsError")
+	}
+	if extendedError.Rcode != dns.RcodeServerFailure ||
+		extendedError.InfoCode != dns.ExtendedErrorCodeBlocked ||
+		extendedError.ExtraText != "policy" {
+		t.Errorf("got = %+v", extendedError)
+	}
+}
+
+func TestNewRcodeError_NoExtendedErrors(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.Rcode = dns.RcodeServerFailure
+
+	err := error(NewRcodeError(message))
+	if errors.Is(err, ErrExtendedDnsError) {
+		t.Error("errors.Is(err, ErrExtendedDnsError) = true, want false")
+	}
+	if got, want := err.Error(), "unsuccessful rcode: 2 (SERVFAIL)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
 func TestMultipleRecordsError_Error(t *testing.T) {
 	t.Parallel()
 
@@ -94,3 +141,53 @@ func TestMultipleRecordsError_GetInput(t *testing.T) {
 		}
 	}
 }
+
+func TestResponseMismatchError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&ResponseMismatchError{Field: "question name", Query: "example.com.", Response: "example.org."})
+
+	want := `response mismatch: question name: "example.org.", want "example.com."`
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrResponseMismatch) {
+		t.Errorf("errors.Is(err, ErrResponseMismatch) = false, want true")
+	}
+	if errors.Is(err, ErrUnsuccessfulRcode) {
+		t.Errorf("errors.Is(err, ErrUnsuccessfulRcode) = true, want false")
+	}
+}
+
+func TestSpoofingError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&SpoofingError{Query: "ExAmPlE.com.", Response: "example.com."})
+
+	want := `possible spoofing: question name "example.com.", want "ExAmPlE.com."`
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrPossibleSpoofing) {
+		t.Errorf("errors.Is(err, ErrPossibleSpoofing) = false, want true")
+	}
+}
+
+func TestDnssecBogusError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&DnssecBogusError{Result: &dnsUtilsDnssecTypes.Result{
+		Name:   "example.",
+		Type:   dns.TypeA,
+		Status: dnsUtilsDnssecTypes.StatusBogus,
+		Reason: "no valid signature",
+	}})
+
+	want := "dnssec bogus: example. A: no valid signature"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrDnssecBogus) {
+		t.Errorf("errors.Is(err, ErrDnssecBogus) = false, want true")
+	}
+}
@@ -0,0 +1,270 @@
+package hosts
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+const (
+	DefaultPath = "/etc/hosts"
+	// DefaultMaxAge is how long the contents of a file are used before it is
+	// checked for changes.
+	DefaultMaxAge = 5 * time.Second
+)
+
+// Hosts maps names to addresses and back, as listed in a hosts file
+// (hosts(5)).
+type Hosts struct {
+	// addresses maps lower-cased, fully qualified names to their addresses.
+	addresses map[string][]netip.Addr
+	// names maps addresses to their names, the canonical name first.
+	names map[netip.Addr][]string
+}
+
+// normalizeAddress drops the zone of an address and unmaps an IPv4-mapped IPv6
+// address, so that it can be compared with those of records.
+func normalizeAddress(address netip.Addr) netip.Addr {
+	return address.WithZone("").Unmap()
+}
+
+// Parse parses a hosts file. Lines that are not understood are ignored.
+func Parse(reader io.Reader) (*Hosts, error) {
+	hosts := &Hosts{
+		addresses: make(map[string][]netip.Addr),
+		names:     make(map[netip.Addr][]string),
+	}
+
+	if reader == nil {
+		return hosts, nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		address, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+		address = normalizeAddress(address)
+
+		for _, name := range fields[1:] {
+			name = strings.ToLower(dns.Fqdn(name))
+			if _, ok := dns.IsDomainName(name); !ok {
+				continue
+			}
+
+			if !slices.Contains(hosts.addresses[name], address) {
+				hosts.addresses[name] = append(hosts.addresses[name], address)
+			}
+			if !slices.Contains(hosts.names[address], name) {
+				hosts.names[address] = append(hosts.names[address], name)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("scanner scan: %w", err))
+	}
+
+	return hosts, nil
+}
+
+// Addresses returns the addresses of the name.
+func (h *Hosts) Addresses(name string) []netip.Addr {
+	if h == nil {
+		return nil
+	}
+	return h.addresses[strings.ToLower(dns.Fqdn(name))]
+}
+
+// Names returns the fully qualified names of the address, the canonical name
+// first.
+func (h *Hosts) Names(address netip.Addr) []string {
+	if h == nil {
+		return nil
+	}
+	return h.names[normalizeAddress(address)]
+}
+
+// reverseAddress returns the address of a name in in-addr.arpa or ip6.arpa.
+func reverseAddress(name string) (netip.Addr, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	if labels, ok := strings.CutSuffix(name, ".in-addr.arpa."); ok {
+		octets := strings.Split(labels, ".")
+		if len(octets) != 4 {
+			return netip.Addr{}, false
+		}
+		slices.Reverse(octets)
+		address, err := netip.ParseAddr(strings.Join(octets, "."))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		return address, true
+	}
+
+	if labels, ok := strings.CutSuffix(name, ".ip6.arpa."); ok {
+		nibbles := strings.Split(labels, ".")
+		if len(nibbles) != 32 {
+			return netip.Addr{}, false
+		}
+		slices.Reverse(nibbles)
+
+		var builder strings.Builder
+		for i, nibble := range nibbles {
+			if len(nibble) != 1 {
+				return netip.Addr{}, false
+			}
+			if i > 0 && i%4 == 0 {
+				builder.WriteByte(':')
+			}
+			builder.WriteString(nibble)
+		}
+
+		address, err := netip.ParseAddr(builder.String())
+		if err != nil || !address.Is6() {
+			return netip.Addr{}, false
+		}
+		return address, true
+	}
+
+	return netip.Addr{}, false
+}
+
+// Answer returns the records that answer the question: A and AAAA records for
+// a name, or PTR records for an address. The records have a TTL of zero, so
+// that they are not cached.
+func (h *Hosts) Answer(question dns.Question) []dns.RR {
+	if h == nil || question.Qclass != dns.ClassINET {
+		return nil
+	}
+
+	header := dns.RR_Header{Name: question.Name, Rrtype: question.Qtype, Class: dns.ClassINET}
+
+	var records []dns.RR
+	switch question.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		for _, address := range h.Addresses(question.Name) {
+			switch {
+			case question.Qtype == dns.TypeA && address.Is4():
+				records = append(records, &dns.A{Hdr: header, A: address.AsSlice()})
+			case question.Qtype == dns.TypeAAAA && address.Is6():
+				records = append(records, &dns.AAAA{Hdr: header, AAAA: address.AsSlice()})
+			}
+		}
+	case dns.TypePTR:
+		address, ok := reverseAddress(question.Name)
+		if !ok {
+			return nil
+		}
+		for _, name := range h.Names(address) {
+			records = append(records, &dns.PTR{Hdr: header, Ptr: name})
+		}
+	}
+
+	return records
+}
+
+// File is a hosts file that is read when first used and read again when it
+// has changed, which is checked at most once per DefaultMaxAge. A missing file
+// has no entries. It is safe for concurrent use.
+type File struct {
+	path string
+	now  func() time.Time
+
+	mutex     sync.Mutex
+	hosts     *Hosts
+	checkedAt time.Time
+	modTime   time.Time
+	size      int64
+}
+
+// NewFile returns the hosts file at the path, or at DefaultPath if the path is
+// empty.
+func NewFile(path string) *File {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &File{path: path, now: time.Now}
+}
+
+func (f *File) read(ctx context.Context) (*Hosts, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("os open: %w", err), f.path)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.WarnContext(
+				altshiftContext.WithError(
+					ctx,
+					altshiftErrors.NewWithTrace(fmt.Errorf("file close: %w", err), file),
+				),
+				"An error occurred when closing the file.",
+			)
+		}
+	}()
+
+	hosts, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	return hosts, nil
+}
+
+// Hosts returns the current contents of the file.
+func (f *File) Hosts(ctx context.Context) (*Hosts, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if f.hosts != nil && now.Sub(f.checkedAt) < DefaultMaxAge {
+		return f.hosts, nil
+	}
+	f.checkedAt = now
+
+	fileInfo, err := os.Stat(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			f.hosts, f.modTime, f.size = &Hosts{}, time.Time{}, 0
+			return f.hosts, nil
+		}
+		return nil, altshiftErrors.NewWithTrace(fmt.Errorf("os stat: %w", err), f.path)
+	}
+
+	if f.hosts != nil && fileInfo.ModTime().Equal(f.modTime) && fileInfo.Size() == f.size {
+		return f.hosts, nil
+	}
+
+	hosts, err := f.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	f.hosts, f.modTime, f.size = hosts, fileInfo.ModTime(), fileInfo.Size()
+
+	return hosts, nil
+}
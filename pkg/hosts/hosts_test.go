@@ -0,0 +1,194 @@
+package hosts
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testHosts = `# comment
+127.0.0.1	localhost
+::1		localhost ip6-localhost # trailing comment
+192.0.2.1	host.example.com host
+192.0.2.2	host.example.com
+2001:db8::1	Host.Example.com
+fe80::1%lo0	link.local
+::ffff:192.0.2.3	mapped
+not-an-address	ignored
+192.0.2.4
+`
+
+func mustParse(t *testing.T, input string) *Hosts {
+	t.Helper()
+
+	hosts, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return hosts
+}
+
+func answerStrings(records []dns.RR) []string {
+	var strs []string
+	for _, record := range records {
+		strs = append(strs, record.String())
+	}
+	return strs
+}
+
+func TestHosts_Answer(t *testing.T) {
+	t.Parallel()
+
+	hosts := mustParse(t, testHosts)
+
+	tests := []struct {
+		name     string
+		question dns.Question
+		want     []string
+	}{
+		{
+			name:     "a",
+			question: dns.Question{Name: "host.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+			want: []string{
+				"host.example.com.\t0\tIN\tA\t192.0.2.1",
+				"host.example.com.\t0\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name:     "aaaa, case-insensitively",
+			question: dns.Question{Name: "HOST.example.com.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET},
+			want:     []string{"HOST.example.com.\t0\tIN\tAAAA\t2001:db8::1"},
+		},
+		{
+			name:     "an alias",
+			question: dns.Question{Name: "host.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+			want:     []string{"host.\t0\tIN\tA\t192.0.2.1"},
+		},
+		{
+			name:     "the zone is dropped",
+			question: dns.Question{Name: "link.local.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET},
+			want:     []string{"link.local.\t0\tIN\tAAAA\tfe80::1"},
+		},
+		{
+			name:     "an ipv4-mapped address is an ipv4 address",
+			question: dns.Question{Name: "mapped.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+			want:     []string{"mapped.\t0\tIN\tA\t192.0.2.3"},
+		},
+		{
+			name:     "ptr",
+			question: dns.Question{Name: "1.2.0.192.in-addr.arpa.", Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+			want: []string{
+				"1.2.0.192.in-addr.arpa.\t0\tIN\tPTR\thost.example.com.",
+				"1.2.0.192.in-addr.arpa.\t0\tIN\tPTR\thost.",
+			},
+		},
+		{
+			name: "ptr for an ipv6 address",
+			question: dns.Question{
+				Name:   "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+				Qtype:  dns.TypePTR,
+				Qclass: dns.ClassINET,
+			},
+			want: []string{
+				"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.\t0\tIN\tPTR\tlocalhost.",
+				"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.\t0\tIN\tPTR\tip6-localhost.",
+			},
+		},
+		{
+			name:     "no address of the type",
+			question: dns.Question{Name: "host.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET},
+		},
+		{
+			name:     "another type",
+			question: dns.Question{Name: "host.example.com.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET},
+		},
+		{
+			name:     "another class",
+			question: dns.Question{Name: "host.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassCHAOS},
+		},
+		{
+			name:     "not listed",
+			question: dns.Question{Name: "ignored.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+		},
+		{
+			name:     "a malformed reverse name",
+			question: dns.Question{Name: "2.0.192.in-addr.arpa.", Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := answerStrings(hosts.Answer(tt.question)); !slices.Equal(got, tt.want) {
+				t.Errorf("got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHosts_Names(t *testing.T) {
+	t.Parallel()
+
+	hosts := mustParse(t, testHosts)
+
+	got := hosts.Names(netip.MustParseAddr("::ffff:192.0.2.1"))
+	if want := []string{"host.example.com.", "host."}; !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestFile_Hosts(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "hosts")
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := NewFile(path)
+	file.now = func() time.Time { return now }
+
+	lookup := func() []netip.Addr {
+		t.Helper()
+
+		hosts, err := file.Hosts(context.Background())
+		if err != nil {
+			t.Fatalf("hosts: %v", err)
+		}
+		return hosts.Addresses("host")
+	}
+
+	// A missing file has no entries.
+	if got := lookup(); got != nil {
+		t.Errorf("Addresses() = %v, want none", got)
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.1 host\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	// The file is not checked again until DefaultMaxAge has passed.
+	if got := lookup(); got != nil {
+		t.Errorf("Addresses() = %v, want none", got)
+	}
+
+	now = now.Add(DefaultMaxAge)
+	if got := lookup(); !slices.Equal(got, []netip.Addr{netip.MustParseAddr("192.0.2.1")}) {
+		t.Errorf("Addresses() = %v, want 192.0.2.1", got)
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.22 host\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	now = now.Add(DefaultMaxAge)
+	if got := lookup(); !slices.Equal(got, []netip.Addr{netip.MustParseAddr("192.0.2.22")}) {
+		t.Errorf("Addresses() = %v, want 192.0.2.22", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"math"
 	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 
@@ -101,6 +102,58 @@ func EnrichWithDnsMessage(base *schema.Base, message *dns.Msg) {
 	} else {
 		ecsDns.Type = "question"
 	}
+
+	if subnet := dns_utils.GetClientSubnet(message); subnet != nil {
+		// ECS has no fields for the EDNS Client Subnet option (RFC 7871).
+		setLabel(base, "dns_client_subnet", subnetPrefix(subnet))
+		if message.Response {
+			setLabel(base, "dns_client_subnet_scope", strconv.Itoa(int(subnet.SourceScope)))
+		}
+	}
+
+	// Nor for Extended DNS Errors (RFC 8914), of which there may be several.
+	var infoCodes, infoCodeNames, extraTexts []string
+	for _, extendedError := range dns_utils.GetExtendedErrors(message) {
+		infoCodes = append(infoCodes, strconv.Itoa(int(extendedError.InfoCode)))
+		infoCodeNames = append(infoCodeNames, dns.ExtendedErrorCodeToString[extendedError.InfoCode])
+		if extendedError.ExtraText != "" {
+			extraTexts = append(extraTexts, extendedError.ExtraText)
+		}
+	}
+	if len(infoCodes) != 0 {
+		setLabel(base, "dns_extended_error_code", strings.Join(infoCodes, ","))
+		setLabel(base, "dns_extended_error", strings.Join(infoCodeNames, ","))
+		setLabel(base, "dns_extended_error_text", strings.Join(extraTexts, "; "))
+	}
+}
+
+func setLabel(base *schema.Base, key string, value string) {
+	if value == "" {
+		return
+	}
+	if base.Labels == nil {
+		base.Labels = make(map[string]string)
+	}
+	base.Labels[key] = value
+}
+
+// subnetPrefix returns the source prefix of an EDNS Client Subnet option in
+// CIDR notation.
+func subnetPrefix(subnet *dns.EDNS0_SUBNET) string {
+	address, ok := netip.AddrFromSlice(subnet.Address)
+	if !ok {
+		return ""
+	}
+	if subnet.Family == 1 {
+		address = address.Unmap()
+	}
+
+	prefix, err := address.Prefix(int(subnet.SourceNetmask))
+	if err != nil {
+		return ""
+	}
+
+	return prefix.String()
 }
 
 func ParseDnsMessage(message *dns.Msg) *schema.Base {
@@ -309,6 +362,10 @@ func ParseDnsContext(dnsContext *dnsUtilsTypes.DnsContext) *schema.Base {
 	EnrichWithDnsMessage(base, message)
 	schemaUtils.EnrichWithTlsContext(base, dnsContext.TlsContext)
 
+	// The NSID names the instance of the server that answered (RFC 5001), for
+	// which ECS has no field either.
+	setLabel(base, "dns_nsid", dnsContext.Nsid)
+
 	base.Message = MakeDnsMessage(base)
 
 	return base
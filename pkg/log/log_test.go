@@ -156,6 +156,94 @@ func TestEnrichWithDnsMessage_AnswerWithResolvedIps(t *testing.T) {
 	}
 }
 
+func TestEnrichWithDnsMessage_ClientSubnet(t *testing.T) {
+	t.Parallel()
+
+	subnet := func(response bool, family uint16, bits uint8, scope uint8, ip string) *dns.Msg {
+		msg := &dns.Msg{}
+		msg.SetQuestion("example.com.", dns.TypeA)
+		msg.Response = response
+		msg.SetEdns0(4096, false)
+		msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        family,
+			SourceNetmask: bits,
+			SourceScope:   scope,
+			Address:       net.ParseIP(ip),
+		})
+		return msg
+	}
+
+	tests := []struct {
+		name       string
+		message    *dns.Msg
+		wantLabels map[string]string
+	}{
+		{name: "none", message: &dns.Msg{}},
+		{
+			name:       "question",
+			message:    subnet(false, 1, 24, 0, "198.51.100.0"),
+			wantLabels: map[string]string{"dns_client_subnet": "198.51.100.0/24"},
+		},
+		{
+			name:    "answer",
+			message: subnet(true, 1, 24, 16, "198.51.100.0"),
+			wantLabels: map[string]string{
+				"dns_client_subnet":       "198.51.100.0/24",
+				"dns_client_subnet_scope": "16",
+			},
+		},
+		{
+			name:    "ipv6 answer",
+			message: subnet(true, 2, 56, 48, "2001:db8::"),
+			wantLabels: map[string]string{
+				"dns_client_subnet":       "2001:db8::/56",
+				"dns_client_subnet_scope": "48",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			base := &schema.Base{}
+			EnrichWithDnsMessage(base, tt.message)
+
+			if !reflect.DeepEqual(base.Labels, tt.wantLabels) {
+				t.Errorf("Labels = %v, want %v", base.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestEnrichWithDnsMessage_ExtendedErrors(t *testing.T) {
+	t.Parallel()
+
+	msg := &dns.Msg{}
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Response = true
+	msg.Rcode = dns.RcodeServerFailure
+	msg.SetEdns0(4096, false)
+	msg.IsEdns0().Option = append(
+		msg.IsEdns0().Option,
+		&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus, ExtraText: "no valid signature"},
+		&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer},
+	)
+
+	base := &schema.Base{}
+	EnrichWithDnsMessage(base, msg)
+
+	want := map[string]string{
+		"dns_extended_error_code": "6,3",
+		"dns_extended_error":      "DNSSEC Bogus,Stale Answer",
+		"dns_extended_error_text": "no valid signature",
+	}
+	if !reflect.DeepEqual(base.Labels, want) {
+		t.Errorf("Labels = %v, want %v", base.Labels, want)
+	}
+}
+
 func TestEnrichWithDnsMessage_PreservesExistingDns(t *testing.T) {
 	t.Parallel()
 
@@ -356,6 +444,35 @@ func TestParseDnsContext_ParsesAddresses(t *testing.T) {
 	}
 }
 
+func TestParseDnsContext_Nsid(t *testing.T) {
+	t.Parallel()
+
+	msg := &dns.Msg{}
+	msg.SetQuestion("example.com.", dns.TypeA)
+
+	base := ParseDnsContext(&dnsUtilsTypes.DnsContext{
+		QuestionMessage: msg,
+		ServerAddress:   "192.0.2.53:53",
+		Nsid:            "ams01.example",
+	})
+	if base == nil {
+		t.Fatal("ParseDnsContext = nil")
+	}
+	if got := base.Labels["dns_nsid"]; got != "ams01.example" {
+		t.Errorf("Labels[dns_nsid] = %q, want %q", got, "ams01.example")
+	}
+	if base.Server == nil || base.Server.Ip != "192.0.2.53" {
+		t.Errorf("Server = %+v, want the server that answered", base.Server)
+	}
+	if base.Observer != nil {
+		t.Errorf("Observer = %+v, want nil", base.Observer)
+	}
+
+	if base := ParseDnsContext(&dnsUtilsTypes.DnsContext{QuestionMessage: msg}); base.Labels["dns_nsid"] != "" {
+		t.Errorf("Labels = %v, want no NSID without one", base.Labels)
+	}
+}
+
 func TestParseDnsContext_HostnameAddress(t *testing.T) {
 	t.Parallel()
 
@@ -1,7 +1,76 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrMessageLengthOverflow = errors.New("message length overflow")
+	ErrSessionClosed         = errors.New("session closed")
+	ErrServerClosed          = errors.New("server closed")
+	ErrUnsupportedAlpn       = errors.New("unsupported alpn")
+
+	ErrDoqError            = errors.New("doq error")
+	ErrDoqNoError          = errors.New("DOQ_NO_ERROR")
+	ErrDoqInternalError    = errors.New("DOQ_INTERNAL_ERROR")
+	ErrDoqProtocolError    = errors.New("DOQ_PROTOCOL_ERROR")
+	ErrDoqRequestCancelled = errors.New("DOQ_REQUEST_CANCELLED")
+	ErrDoqExcessiveLoad    = errors.New("DOQ_EXCESSIVE_LOAD")
+	ErrDoqUnspecifiedError = errors.New("DOQ_UNSPECIFIED_ERROR")
+	ErrDoqErrorReserved    = errors.New("DOQ_ERROR_RESERVED")
 )
+
+// The DoQ application error codes (RFC 9250 section 4.3), used when closing a
+// stream or a connection.
+const (
+	DoqNoError          = 0x0
+	DoqInternalError    = 0x1
+	DoqProtocolError    = 0x2
+	DoqRequestCancelled = 0x3
+	DoqExcessiveLoad    = 0x4
+	DoqUnspecifiedError = 0x5
+	DoqErrorReserved    = 0xd098ea5e
+)
+
+var doqCodeErrors = map[uint64]error{
+	DoqNoError:          ErrDoqNoError,
+	DoqInternalError:    ErrDoqInternalError,
+	DoqProtocolError:    ErrDoqProtocolError,
+	DoqRequestCancelled: ErrDoqRequestCancelled,
+	DoqExcessiveLoad:    ErrDoqExcessiveLoad,
+	DoqUnspecifiedError: ErrDoqUnspecifiedError,
+	DoqErrorReserved:    ErrDoqErrorReserved,
+}
+
+// DoqError is a DoQ application error code with which a stream or the
+// connection was closed, by the peer if Remote is set.
+type DoqError struct {
+	Code    uint64
+	Remote  bool
+	Message string
+}
+
+func (e *DoqError) Is(target error) bool {
+	if target == ErrDoqError {
+		return true
+	}
+
+	codeError, ok := doqCodeErrors[e.Code]
+	return ok && target == codeError
+}
+
+func (e *DoqError) Error() string {
+	msg := fmt.Sprintf("%s: %#x", ErrDoqError, e.Code)
+	if codeError, ok := doqCodeErrors[e.Code]; ok {
+		msg += fmt.Sprintf(" (%s)", codeError)
+	}
+	if e.Remote {
+		msg += " from the peer"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
@@ -1,6 +1,9 @@
 package errors
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestErrMessageLengthOverflow_Message(t *testing.T) {
 	t.Parallel()
@@ -9,3 +12,73 @@ func TestErrMessageLengthOverflow_Message(t *testing.T) {
 		t.Errorf("ErrMessageLengthOverflow.Error() = %q, want %q", got, want)
 	}
 }
+
+func TestErrSessionClosed_Message(t *testing.T) {
+	t.Parallel()
+
+	if got, want := ErrSessionClosed.Error(), "session closed"; got != want {
+		t.Errorf("ErrSessionClosed.Error() = %q, want %q", got, want)
+	}
+}
+
+func TestErrServerClosed_Message(t *testing.T) {
+	t.Parallel()
+
+	if got, want := ErrServerClosed.Error(), "server closed"; got != want {
+		t.Errorf("ErrServerClosed.Error() = %q, want %q", got, want)
+	}
+}
+
+func TestDoqError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       *DoqError
+		target    error
+		wantIs    bool
+		wantError string
+	}{
+		{
+			name:      "known code",
+			err:       &DoqError{Code: DoqProtocolError},
+			target:    ErrDoqProtocolError,
+			wantIs:    true,
+			wantError: "doq error: 0x2 (DOQ_PROTOCOL_ERROR)",
+		},
+		{
+			name:      "any code is a doq error",
+			err:       &DoqError{Code: DoqExcessiveLoad, Remote: true},
+			target:    ErrDoqError,
+			wantIs:    true,
+			wantError: "doq error: 0x4 (DOQ_EXCESSIVE_LOAD) from the peer",
+		},
+		{
+			name:      "another code",
+			err:       &DoqError{Code: DoqRequestCancelled, Message: "gone"},
+			target:    ErrDoqInternalError,
+			wantIs:    false,
+			wantError: "doq error: 0x3 (DOQ_REQUEST_CANCELLED): gone",
+		},
+		{
+			name:      "unknown code",
+			err:       &DoqError{Code: 0x42},
+			target:    ErrDoqNoError,
+			wantIs:    false,
+			wantError: "doq error: 0x42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := errors.Is(tt.err, tt.target); got != tt.wantIs {
+				t.Errorf("errors.Is = %v, want %v", got, tt.wantIs)
+			}
+			if got := tt.err.Error(); got != tt.wantError {
+				t.Errorf("Error() = %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+}
@@ -4,59 +4,184 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"time"
 
 	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
 	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
 	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
 	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
 	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
 	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
 	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	"github.com/altshiftab/utils_go/pkg/errors/types/nil_error"
+	altshiftTlsTypes "github.com/altshiftab/utils_go/pkg/tls/types"
 	"github.com/miekg/dns"
 	"github.com/quic-go/quic-go"
 )
 
-func Exchange(
-	ctx context.Context,
-	message *dns.Msg,
-	serverAddress string,
-	tlsConfig *tls.Config,
-	quicConfig *quic.Config,
-) (*dns.Msg, error) {
-	if message == nil {
-		return nil, nil
+const (
+	// Alpn is the ALPN token of DoQ (RFC 9250 section 4.1.1).
+	Alpn = "doq"
+	// PaddingBlockSize is the block size to which queries are padded, as
+	// recommended for clients by RFC 8467 section 4.1.
+	PaddingBlockSize = 128
+	// ResponsePaddingBlockSize is the block size to which responses to padded
+	// queries are padded, as recommended for servers by RFC 8467 section 4.1.
+	ResponsePaddingBlockSize = 468
+)
+
+// doqTlsConfig returns the TLS configuration to use for the connections. A
+// configuration that does not offer an ALPN is given the DoQ one; offering
+// another is an error.
+func doqTlsConfig(tlsConfig *tls.Config) (*tls.Config, error) {
+	if tlsConfig == nil {
+		return &tls.Config{NextProtos: []string{Alpn}}, nil
 	}
 
-	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
-	if !ok || dnsContext == nil {
-		dnsContext = &dnsUtilsTypes.DnsContext{}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = []string{Alpn}
+		return tlsConfig, nil
 	}
-	dnsContext.QuestionMessage = message
-	if dnsContext.ServerAddress == "" {
-		dnsContext.ServerAddress = serverAddress
+
+	for _, protocol := range tlsConfig.NextProtos {
+		if protocol != Alpn {
+			return nil, altshiftErrors.NewWithTrace(
+				fmt.Errorf("%w: %q", dnsUtilsQuicErrors.ErrUnsupportedAlpn, protocol),
+			)
+		}
 	}
-	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
 
-	if serverAddress == "" {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	return tlsConfig, nil
+}
+
+func hasTcpKeepalive(message *dns.Msg) bool {
+	if opt := message.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if _, ok := option.(*dns.EDNS0_TCP_KEEPALIVE); ok {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	if tlsConfig == nil {
-		tlsConfig = &tls.Config{NextProtos: []string{"doq"}}
+// prepareMessage returns a copy of the message as RFC 9250 requires it to be
+// sent: with Message ID 0 (section 4.2.1) and without the edns-tcp-keepalive
+// option (section 5.5.2). With a non-zero block size, the copy is padded to a
+// multiple of it (section 5.4), and given an OPT record for that if it has
+// none.
+func prepareMessage(message *dns.Msg, blockSize int) *dns.Msg {
+	prepared := message.Copy()
+	prepared.Id = 0
+
+	opt := prepared.IsEdns0()
+	if opt == nil && blockSize > 0 {
+		prepared.SetEdns0(dns.MaxMsgSize, false)
+		opt = prepared.IsEdns0()
+	}
+	if opt == nil {
+		return prepared
 	}
 
-	messageBytes, err := message.Pack()
-	if err != nil {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("request pack: %w", err))
+	opt.Option = slices.DeleteFunc(opt.Option, func(option dns.EDNS0) bool {
+		switch option.(type) {
+		case *dns.EDNS0_TCP_KEEPALIVE, *dns.EDNS0_PADDING:
+			return true
+		}
+		return false
+	})
+
+	if blockSize > 0 {
+		padding := &dns.EDNS0_PADDING{}
+		opt.Option = append(opt.Option, padding)
+		if remainder := prepared.Len() % blockSize; remainder != 0 {
+			padding.Padding = make([]byte, blockSize-remainder)
+		}
 	}
 
-	connection, err := quic.DialAddr(ctx, serverAddress, tlsConfig, quicConfig)
-	if err != nil {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("quic dial addr: %w", err))
+	return prepared
+}
+
+// streamError returns the DoQ error that a stream or connection error carries,
+// or the error itself. An error caused by the context being done wraps the
+// cause as well.
+func streamError(ctx context.Context, err error) error {
+	if streamErr, ok := errors.AsType[*quic.StreamError](err); ok {
+		err = &dnsUtilsQuicErrors.DoqError{Code: uint64(streamErr.ErrorCode), Remote: streamErr.Remote}
+	} else if applicationErr, ok := errors.AsType[*quic.ApplicationError](err); ok {
+		err = &dnsUtilsQuicErrors.DoqError{
+			Code:    uint64(applicationErr.ErrorCode),
+			Remote:  applicationErr.Remote,
+			Message: applicationErr.ErrorMessage,
+		}
+	}
+
+	if ctxErr := context.Cause(ctx); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+
+	return err
+}
+
+// protocolError closes the connection with DOQ_PROTOCOL_ERROR, which RFC 9250
+// section 4.3.3 calls for on a malformed exchange, and returns the error.
+func protocolError(ctx context.Context, connection *quic.Conn, message string) error {
+	if err := connection.CloseWithError(dnsUtilsQuicErrors.DoqProtocolError, message); err != nil {
+		slog.WarnContext(
+			altshiftContext.WithError(
+				ctx,
+				altshiftErrors.NewWithTrace(fmt.Errorf("connection close with error: %w", err)),
+			),
+			"An error occurred when closing a connection.",
+		)
+	}
+
+	return &dnsUtilsQuicErrors.DoqError{Code: dnsUtilsQuicErrors.DoqProtocolError, Message: message}
+}
+
+// Exchanger exchanges messages over DNS-over-QUIC (RFC 9250). It satisfies the
+// Exchanger of the client configuration, which makes DoQ available to every
+// client.Client method.
+type Exchanger struct {
+	// TlsConfig is used for the connections; it must offer the "doq" ALPN.
+	TlsConfig  *tls.Config
+	QuicConfig *quic.Config
+}
+
+func (e *Exchanger) Exchange(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error) {
+	var tlsConfig *tls.Config
+	var quicConfig *quic.Config
+	if e != nil {
+		tlsConfig = e.TlsConfig
+		quicConfig = e.QuicConfig
+	}
+
+	return Exchange(ctx, message, serverAddress, tlsConfig, quicConfig)
+}
+
+// ExchangeWithConn exchanges the message on a new stream of the connection,
+// which is left open.
+func ExchangeWithConn(ctx context.Context, message *dns.Msg, connection *quic.Conn) (*dns.Msg, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	dnsContext.QuestionMessage = message
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	if connection == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("connection"))
 	}
 
 	var localAddrString string
@@ -75,14 +200,26 @@ func Exchange(
 	dnsContext.ServerAddress = remoteAddrString
 	dnsContext.Transport = transport
 
-	// TODO: Not sure if I can obtain TLS information? Maybe if I call something other than `quic.DialAddr`?
+	messageBytes, err := prepareMessage(message, PaddingBlockSize).Pack()
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("request pack: %w", err))
+	}
+
+	rawMessageLength := len(messageBytes)
+	if rawMessageLength > 0xFFFF {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("%w (%d)", dnsUtilsQuicErrors.ErrMessageLengthOverflow, rawMessageLength),
+		)
+	}
+	messageLength := uint16(rawMessageLength)
 
 	closeStreamInDefer := true
 	stream, err := connection.OpenStreamSync(ctx)
 	if err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			fmt.Errorf("connection open stream sync: %w", err),
+			fmt.Errorf("connection open stream sync: %w", streamError(ctx, err)),
 		)
 	}
 	defer func() {
@@ -99,30 +236,31 @@ func Exchange(
 		}
 	}()
 
-	rawMessageLength := len(messageBytes)
-	if rawMessageLength > 0xFFFF {
-		return nil, altshiftErrors.NewWithTraceCtx(
-			ctxWithDnsContext,
-			fmt.Errorf("%w (%d)", dnsUtilsQuicErrors.ErrMessageLengthOverflow, rawMessageLength),
-		)
-	}
-	messageLength := uint16(rawMessageLength)
+	// The stream is abandoned when the context is done.
+	stopAfter := context.AfterFunc(ctx, func() {
+		stream.CancelRead(dnsUtilsQuicErrors.DoqRequestCancelled)
+		stream.CancelWrite(dnsUtilsQuicErrors.DoqRequestCancelled)
+	})
+	defer stopAfter()
 
 	if err := binary.Write(stream, binary.BigEndian, messageLength); err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			fmt.Errorf("binary write (message length): %w", err),
+			fmt.Errorf("binary write (message length): %w", streamError(ctx, err)),
 		)
 	}
 	if _, err := stream.Write(messageBytes); err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			fmt.Errorf("binary write (message bytes): %w", err),
+			fmt.Errorf("binary write (message bytes): %w", streamError(ctx, err)),
 		)
 	}
 
 	if err := stream.Close(); err != nil {
-		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("stream close: %w", err))
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("stream close: %w", streamError(ctx, err)),
+		)
 	}
 	closeStreamInDefer = false
 
@@ -130,34 +268,129 @@ func Exchange(
 	if err := binary.Read(stream, binary.BigEndian, &responseLength); err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			fmt.Errorf("binary read (response length): %w", err),
+			fmt.Errorf("binary read (response length): %w", streamError(ctx, err)),
 		)
 	}
 
 	responseBuffer := make([]byte, responseLength)
 	if _, err := io.ReadFull(stream, responseBuffer); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = protocolError(ctx, connection, "stream ended before the end of the response")
+		}
 		return nil, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			fmt.Errorf("io read full (response): %w", err),
+			fmt.Errorf("io read full (response): %w", streamError(ctx, err)),
 		)
 	}
 
+	// A response arrives only once the handshake is complete, even for a query
+	// sent as 0-RTT data, so the connection state is final.
+	connectionState := connection.ConnectionState().TLS
+	dnsContext.TlsContext = &altshiftTlsTypes.TlsContext{
+		ConnectionState: &connectionState,
+		ClientInitiated: true,
+	}
+
 	var response dns.Msg
 	if err := response.Unpack(responseBuffer); err != nil {
 		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("response unpack: %w", err))
 	}
 
+	if response.Id != 0 {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			protocolError(ctx, connection, "non-zero message id"),
+		)
+	}
+	if hasTcpKeepalive(&response) {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			protocolError(ctx, connection, "edns-tcp-keepalive option"),
+		)
+	}
+	response.Id = message.Id
+
 	// TODO: Maybe I can obtain an earlier time?
 	t := time.Now()
 	dnsContext.Time = &t
 	dnsContext.AnswerMessage = &response
 
+	// Reject a response that does not answer the query, as the other
+	// transports do.
+	if err := dns_utils.ValidateResponse(message, &response); err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("validate response: %w", err),
+		)
+	}
+
 	if response.Rcode != dns.RcodeSuccess {
 		return &response, altshiftErrors.NewWithTraceCtx(
 			ctxWithDnsContext,
-			&dnsUtilsErrors.RcodeError{Rcode: response.Rcode},
+			dnsUtilsErrors.NewRcodeError(&response),
 		)
 	}
 
 	return &response, nil
 }
+
+// Exchange dials a connection to the server, exchanges the message and closes
+// the connection. Use a Session to reuse connections across exchanges.
+func Exchange(
+	ctx context.Context,
+	message *dns.Msg,
+	serverAddress string,
+	tlsConfig *tls.Config,
+	quicConfig *quic.Config,
+) (*dns.Msg, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	dnsContext.QuestionMessage = message
+	if dnsContext.ServerAddress == "" {
+		dnsContext.ServerAddress = serverAddress
+	}
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	if serverAddress == "" {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	tlsConfig, err := doqTlsConfig(tlsConfig)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("doq tls config: %w", err))
+	}
+
+	connection, err := quic.DialAddr(ctx, serverAddress, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("quic dial addr: %w", err))
+	}
+	defer func() {
+		if err := connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, ""); err != nil {
+			slog.WarnContext(
+				altshiftContext.WithError(
+					ctx,
+					altshiftErrors.NewWithTrace(fmt.Errorf("connection close with error: %w", err)),
+				),
+				"An error occurred when closing a connection.",
+			)
+		}
+	}()
+
+	ctxForExchange := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	response, err := ExchangeWithConn(ctxForExchange, message, connection)
+	if err != nil {
+		return response, altshiftErrors.NewWithTraceCtx(
+			ctxWithDnsContext,
+			fmt.Errorf("exchange with conn: %w", err),
+		)
+	}
+
+	return response, nil
+}
@@ -2,16 +2,164 @@ package quic
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"math/big"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
 	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
 	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
 	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
 )
 
+// makeTestCertificate creates a self-signed certificate for dns.example and
+// 127.0.0.1.
+func makeTestCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dns.example"},
+		DNSNames:              []string{"dns.example"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}, certificate
+}
+
+// testDoqServer is a local DNS-over-QUIC server that accepts 0-RTT. Its
+// listener counts the connections.
+type testDoqServer struct {
+	*quic.EarlyListener
+	address string
+	// tlsConfig is a client configuration that trusts the server.
+	tlsConfig *tls.Config
+	// connections is the number of connections accepted.
+	connections atomic.Int32
+	// resumed is the number of connections that used 0-RTT.
+	resumed atomic.Int32
+}
+
+func (s *testDoqServer) Accept(ctx context.Context) (*quic.Conn, error) {
+	connection, err := s.EarlyListener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.connections.Add(1)
+
+	go func() {
+		select {
+		case <-connection.HandshakeComplete():
+			if connection.ConnectionState().Used0RTT {
+				s.resumed.Add(1)
+			}
+		case <-connection.Context().Done():
+		}
+	}()
+
+	return connection, nil
+}
+
+// startTestDoqServer starts a local DNS-over-QUIC server that answers with the
+// handler's response.
+func startTestDoqServer(t *testing.T, handler func(*dns.Msg) *dns.Msg) *testDoqServer {
+	t.Helper()
+
+	return startTestDoqServerWithHandler(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		_ = w.WriteMsg(handler(r))
+	}))
+}
+
+// startTestDoqServerWithHandler starts a Server with the handler on a local
+// address.
+func startTestDoqServerWithHandler(t *testing.T, handler dns.Handler) *testDoqServer {
+	t.Helper()
+
+	certificate, x509Certificate := makeTestCertificate(t)
+
+	listener, err := quic.ListenAddrEarly(
+		"127.0.0.1:0",
+		&tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: []string{Alpn}},
+		&quic.Config{Allow0RTT: true},
+	)
+	if err != nil {
+		t.Fatalf("listen addr early: %v", err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(x509Certificate)
+
+	testServer := &testDoqServer{
+		EarlyListener: listener,
+		address:       listener.Addr().String(),
+		tlsConfig:     &tls.Config{RootCAs: rootCAs, NextProtos: []string{Alpn}},
+	}
+
+	server := &Server{Handler: handler}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(testServer) }()
+
+	t.Cleanup(func() {
+		if err := server.Shutdown(); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+		// A server shut down before it serves reports so.
+		if err := <-served; err != nil && !errors.Is(err, dnsUtilsQuicErrors.ErrServerClosed) {
+			t.Errorf("serve: %v", err)
+		}
+	})
+
+	return testServer
+}
+
+// aHandler answers with an A record, or NXDOMAIN for names below "missing.".
+func aHandler(request *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	if dns.IsSubDomain("missing.", request.Question[0].Name) {
+		return response.SetRcode(request, dns.RcodeNameError)
+	}
+
+	response.SetReply(request)
+	record, _ := dns.NewRR(request.Question[0].Name + " 60 IN A 192.0.2.1")
+	response.Answer = append(response.Answer, record)
+
+	return response
+}
+
 func extractDnsContext(t *testing.T, err error) *dnsUtilsTypes.DnsContext {
 	t.Helper()
 
@@ -109,3 +257,331 @@ func TestExchange_Error_ReusesExistingDnsContext(t *testing.T) {
 		t.Errorf("caller DnsContext.QuestionMessage not populated")
 	}
 }
+
+func TestExchanger(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+	address := server.address
+	exchanger := &Exchanger{TlsConfig: server.tlsConfig}
+
+	t.Run("answer", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn("example.com"), dns.TypeA)
+
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		got, err := exchanger.Exchange(ctx, msg, address)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got.Answer) != 1 {
+			t.Fatalf("len(Answer) = %d, want 1", len(got.Answer))
+		}
+
+		if dnsContext.AnswerMessage != got {
+			t.Error("DnsContext.AnswerMessage is not the response")
+		}
+		if dnsContext.Transport != "udp" {
+			t.Errorf("DnsContext.Transport = %q, want udp", dnsContext.Transport)
+		}
+		if dnsContext.ServerAddress != address {
+			t.Errorf("DnsContext.ServerAddress = %q, want %q", dnsContext.ServerAddress, address)
+		}
+	})
+
+	t.Run("tls context", func(t *testing.T) {
+		t.Parallel()
+
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		if _, err := exchanger.Exchange(ctx, newTestQuestion("example.com"), address); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		tlsContext := dnsContext.TlsContext
+		if tlsContext == nil || tlsContext.ConnectionState == nil {
+			t.Fatal("DnsContext.TlsContext = nil, want the connection state")
+		}
+		if !tlsContext.ClientInitiated {
+			t.Error("ClientInitiated = false, want true")
+		}
+
+		connectionState := tlsContext.ConnectionState
+		if connectionState.Version != tls.VersionTLS13 {
+			t.Errorf("Version = %#x, want TLS 1.3", connectionState.Version)
+		}
+		if connectionState.CipherSuite == 0 {
+			t.Error("CipherSuite is unset")
+		}
+		if connectionState.NegotiatedProtocol != "doq" {
+			t.Errorf("NegotiatedProtocol = %q, want doq", connectionState.NegotiatedProtocol)
+		}
+		if len(connectionState.PeerCertificates) != 1 {
+			t.Errorf("len(PeerCertificates) = %d, want 1", len(connectionState.PeerCertificates))
+		}
+	})
+
+	t.Run("rcode error carries the response", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn("host.missing"), dns.TypeA)
+
+		got, err := exchanger.Exchange(context.Background(), msg, address)
+
+		rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+		if !ok {
+			t.Fatalf("err type = %T (%v), want *dnsUtilsErrors.RcodeError", err, err)
+		}
+		if rcodeError.Rcode != dns.RcodeNameError {
+			t.Errorf("Rcode = %d, want %d", rcodeError.Rcode, dns.RcodeNameError)
+		}
+		if got == nil || got.Rcode != dns.RcodeNameError {
+			t.Errorf("got = %v, want the NXDOMAIN response", got)
+		}
+	})
+
+	t.Run("nil exchanger", func(t *testing.T) {
+		t.Parallel()
+
+		var nilExchanger *Exchanger
+		got, err := nilExchanger.Exchange(context.Background(), nil, address)
+		if err != nil || got != nil {
+			t.Errorf("got = %v, err = %v, want nil, nil", got, err)
+		}
+	})
+}
+
+func TestExchange_Rfc9250(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan *dns.Msg, 1)
+	server := startTestDoqServer(t, func(request *dns.Msg) *dns.Msg {
+		requests <- request
+		return aHandler(request)
+	})
+
+	msg := newTestQuestion("example.com")
+	msg.Id = 4711
+	msg.SetEdns0(1232, true)
+	opt := msg.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Length: 2, Timeout: 100})
+
+	got, err := Exchange(context.Background(), msg, server.address, server.tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Id != msg.Id {
+		t.Errorf("response ID = %d, want %d", got.Id, msg.Id)
+	}
+
+	request := <-requests
+	if request.Id != 0 {
+		t.Errorf("request ID = %d, want 0", request.Id)
+	}
+	if length := request.Len(); length%PaddingBlockSize != 0 {
+		t.Errorf("request length = %d, want a multiple of %d", length, PaddingBlockSize)
+	}
+
+	requestOpt := request.IsEdns0()
+	if requestOpt == nil {
+		t.Fatal("request has no OPT record")
+	}
+	if !requestOpt.Do() {
+		t.Error("request DO = false, want true")
+	}
+	var padded bool
+	for _, option := range requestOpt.Option {
+		switch option.(type) {
+		case *dns.EDNS0_TCP_KEEPALIVE:
+			t.Error("request has the edns-tcp-keepalive option")
+		case *dns.EDNS0_PADDING:
+			padded = true
+		}
+	}
+	if !padded {
+		t.Error("request has no padding option")
+	}
+
+	if msg.Id != 4711 || len(opt.Option) != 1 {
+		t.Error("the caller's message was modified")
+	}
+}
+
+func TestExchange_PadsWithoutOpt(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan *dns.Msg, 1)
+	server := startTestDoqServer(t, func(request *dns.Msg) *dns.Msg {
+		requests <- request
+		return aHandler(request)
+	})
+
+	if _, err := Exchange(context.Background(), newTestQuestion("example.com"), server.address, server.tlsConfig, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if length := (<-requests).Len(); length%PaddingBlockSize != 0 {
+		t.Errorf("request length = %d, want a multiple of %d", length, PaddingBlockSize)
+	}
+}
+
+func TestExchange_ProtocolErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler func(*dns.Msg) *dns.Msg
+	}{
+		{
+			name: "non-zero message id",
+			handler: func(request *dns.Msg) *dns.Msg {
+				response := aHandler(request)
+				response.Id = 1234
+				return response
+			},
+		},
+		{
+			name: "edns-tcp-keepalive",
+			handler: func(request *dns.Msg) *dns.Msg {
+				response := aHandler(request)
+				response.SetEdns0(dns.MaxMsgSize, false)
+				opt := response.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Length: 2, Timeout: 100})
+				return response
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The response is written as is; WriteMsg would make it conform.
+			server := startTestDoqServerWithHandler(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				responseBytes, _ := tt.handler(r).Pack()
+				_, _ = w.Write(responseBytes)
+			}))
+
+			_, err := Exchange(context.Background(), newTestQuestion("example.com"), server.address, server.tlsConfig, nil)
+			if !errors.Is(err, dnsUtilsQuicErrors.ErrDoqProtocolError) {
+				t.Errorf("err = %v, want ErrDoqProtocolError", err)
+			}
+		})
+	}
+}
+
+func TestExchange_ResponseMismatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler func(*dns.Msg) *dns.Msg
+	}{
+		{
+			name: "question name",
+			handler: func(request *dns.Msg) *dns.Msg {
+				response := aHandler(request)
+				response.Question[0].Name = "other.example."
+				return response
+			},
+		},
+		{
+			name: "qr",
+			handler: func(request *dns.Msg) *dns.Msg {
+				response := aHandler(request)
+				response.Response = false
+				return response
+			},
+		},
+		{
+			name: "opcode",
+			handler: func(request *dns.Msg) *dns.Msg {
+				response := aHandler(request)
+				response.Opcode = dns.OpcodeStatus
+				return response
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := startTestDoqServerWithHandler(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				responseBytes, _ := tt.handler(r).Pack()
+				_, _ = w.Write(responseBytes)
+			}))
+
+			response, err := Exchange(context.Background(), newTestQuestion("example.com"), server.address, server.tlsConfig, nil)
+			if !errors.Is(err, dnsUtilsErrors.ErrResponseMismatch) {
+				t.Errorf("err = %v, want ErrResponseMismatch", err)
+			}
+			if response != nil {
+				t.Error("the mismatched response was returned")
+			}
+		})
+	}
+}
+
+func TestExchange_NoAnswer(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServerWithHandler(t, dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {}))
+
+	_, err := Exchange(context.Background(), newTestQuestion("example.com"), server.address, server.tlsConfig, nil)
+	if !errors.Is(err, dnsUtilsQuicErrors.ErrDoqUnspecifiedError) {
+		t.Fatalf("err = %v, want ErrDoqUnspecifiedError", err)
+	}
+
+	doqError, ok := errors.AsType[*dnsUtilsQuicErrors.DoqError](err)
+	if !ok {
+		t.Fatalf("err type = %T, want *DoqError", err)
+	}
+	if !doqError.Remote {
+		t.Error("Remote = false, want true")
+	}
+}
+
+func TestExchange_ExtendedDnsError(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, func(request *dns.Msg) *dns.Msg {
+		response := new(dns.Msg)
+		response.SetRcode(request, dns.RcodeServerFailure)
+		response.SetEdns0(dns.DefaultMsgSize, false)
+		opt := response.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus, ExtraText: "bad signature"})
+		return response
+	})
+
+	_, err := Exchange(context.Background(), newTestQuestion("example.com"), server.address, server.tlsConfig, nil)
+
+	extendedError, ok := errors.AsType[*dnsUtilsErrors.ExtendedDnsError](err)
+	if !ok {
+		t.Fatalf("err = %v, want an *dnsUtilsErrors.ExtendedDnsError", err)
+	}
+	if extendedError.InfoCode != dns.ExtendedErrorCodeDNSBogus || extendedError.ExtraText != "bad signature" {
+		t.Errorf("extended error = %+v, want DNSSEC Bogus with the extra text", extendedError)
+	}
+}
+
+func TestExchange_UnsupportedAlpn(t *testing.T) {
+	t.Parallel()
+
+	_, err := Exchange(
+		context.Background(),
+		newTestQuestion("example.com"),
+		"127.0.0.1:853",
+		&tls.Config{NextProtos: []string{"doq", "h3"}},
+		nil,
+	)
+	if !errors.Is(err, dnsUtilsQuicErrors.ErrUnsupportedAlpn) {
+		t.Errorf("err = %v, want ErrUnsupportedAlpn", err)
+	}
+}
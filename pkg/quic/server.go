@@ -0,0 +1,336 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// Listener accepts QUIC connections; *quic.Listener and *quic.EarlyListener
+// satisfy it.
+type Listener interface {
+	Accept(ctx context.Context) (*quic.Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// Server serves DNS-over-QUIC (RFC 9250), dispatching the query of each stream
+// to a dns.Handler. Messages are framed with the same 2-byte length prefix as
+// in Exchange.
+type Server struct {
+	// Addr is the address ListenAndServe listens on, e.g. "127.0.0.1:853".
+	Addr string
+	// TlsConfig must have a certificate; the "doq" ALPN is added if it offers
+	// none.
+	TlsConfig *tls.Config
+	// QuicConfig is used by ListenAndServe. With Allow0RTT set, queries may be
+	// received as 0-RTT data.
+	QuicConfig *quic.Config
+	// Handler handles the queries; dns.DefaultServeMux when nil.
+	Handler dns.Handler
+
+	mutex       sync.Mutex
+	listener    Listener
+	connections map[*quic.Conn]struct{}
+	shutdown    bool
+}
+
+// ListenAndServe listens on Addr and serves the connections.
+func (s *Server) ListenAndServe() error {
+	tlsConfig, err := doqTlsConfig(s.TlsConfig)
+	if err != nil {
+		return fmt.Errorf("doq tls config: %w", err)
+	}
+
+	listener, err := quic.ListenAddrEarly(s.Addr, tlsConfig, s.QuicConfig)
+	if err != nil {
+		return altshiftErrors.NewWithTrace(fmt.Errorf("quic listen addr early: %w", err), s.Addr)
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve serves the connections of the listener until Shutdown is called, at
+// which point it returns nil.
+func (s *Server) Serve(listener Listener) error {
+	if listener == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if s.shutdown {
+		s.mutex.Unlock()
+		_ = listener.Close()
+		return altshiftErrors.NewWithTrace(dnsUtilsQuicErrors.ErrServerClosed)
+	}
+	s.listener = listener
+	if s.connections == nil {
+		s.connections = make(map[*quic.Conn]struct{})
+	}
+	s.mutex.Unlock()
+
+	for {
+		connection, err := listener.Accept(context.Background())
+		if err != nil {
+			s.mutex.Lock()
+			shutdown := s.shutdown
+			s.mutex.Unlock()
+
+			if shutdown {
+				return nil
+			}
+			return altshiftErrors.NewWithTrace(fmt.Errorf("listener accept: %w", err))
+		}
+
+		s.mutex.Lock()
+		if s.shutdown {
+			s.mutex.Unlock()
+			_ = connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, "")
+			return nil
+		}
+		s.connections[connection] = struct{}{}
+		s.mutex.Unlock()
+
+		go s.serveConnection(connection)
+	}
+}
+
+func (s *Server) serveConnection(connection *quic.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.connections, connection)
+		s.mutex.Unlock()
+	}()
+
+	for {
+		stream, err := connection.AcceptStream(connection.Context())
+		if err != nil {
+			return
+		}
+
+		go s.serveStream(connection, stream)
+	}
+}
+
+// readQuery reads the query of a stream, which must be the only data on it.
+func readQuery(stream *quic.Stream) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("binary read (query length): %w", err)
+	}
+
+	queryBytes := make([]byte, length)
+	if _, err := io.ReadFull(stream, queryBytes); err != nil {
+		return nil, fmt.Errorf("io read full (query): %w", err)
+	}
+
+	// The client ends the stream after the query (RFC 9250 section 4.2).
+	if n, err := stream.Read(make([]byte, 1)); n > 0 {
+		return nil, fmt.Errorf("stream read: %w", io.ErrShortBuffer)
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("stream read: %w", err)
+	}
+
+	return queryBytes, nil
+}
+
+func hasPadding(message *dns.Msg) bool {
+	if opt := message.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if _, ok := option.(*dns.EDNS0_PADDING); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) serveStream(connection *quic.Conn, stream *quic.Stream) {
+	ctx := connection.Context()
+
+	queryBytes, err := readQuery(stream)
+	if err != nil {
+		switch {
+		case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+			_ = protocolError(ctx, connection, "stream ended before the end of the query")
+		case errors.Is(err, io.ErrShortBuffer):
+			_ = protocolError(ctx, connection, "more than one query on a stream")
+		default:
+			// The client reset the stream, or the connection is gone.
+			stream.CancelRead(dnsUtilsQuicErrors.DoqRequestCancelled)
+			stream.CancelWrite(dnsUtilsQuicErrors.DoqRequestCancelled)
+		}
+		return
+	}
+
+	var query dns.Msg
+	if err := query.Unpack(queryBytes); err != nil {
+		response := new(dns.Msg)
+		response.Response = true
+		response.Rcode = dns.RcodeFormatError
+		writer := &responseWriter{connection: connection, stream: stream}
+		if err := writer.WriteMsg(response); err == nil {
+			_ = stream.Close()
+		}
+		return
+	}
+
+	if query.Id != 0 {
+		_ = protocolError(ctx, connection, "non-zero message id")
+		return
+	}
+	if hasTcpKeepalive(&query) {
+		_ = protocolError(ctx, connection, "edns-tcp-keepalive option")
+		return
+	}
+
+	handler := s.Handler
+	if handler == nil {
+		handler = dns.DefaultServeMux
+	}
+
+	writer := &responseWriter{connection: connection, stream: stream, padded: hasPadding(&query)}
+	handler.ServeDNS(writer, &query)
+
+	if writer.hijacked {
+		return
+	}
+	if !writer.written {
+		// There is nothing to send; tell the client so rather than end the
+		// stream without a response.
+		stream.CancelWrite(dnsUtilsQuicErrors.DoqUnspecifiedError)
+		return
+	}
+	if err := stream.Close(); err != nil {
+		slog.WarnContext(
+			altshiftContext.WithError(
+				ctx,
+				altshiftErrors.NewWithTrace(fmt.Errorf("stream close: %w", err)),
+			),
+			"An error occurred when closing a stream.",
+		)
+	}
+}
+
+// Shutdown stops the listener and closes the connections.
+func (s *Server) Shutdown() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.shutdown = true
+
+	var errs []error
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("listener close: %w", err))
+		}
+	}
+
+	for connection := range s.connections {
+		if err := connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, ""); err != nil {
+			errs = append(errs, fmt.Errorf("connection close with error: %w", err))
+		}
+		delete(s.connections, connection)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return altshiftErrors.NewWithTrace(err)
+	}
+
+	return nil
+}
+
+// responseWriter writes the response to the stream of a query. It satisfies
+// dns.ResponseWriter and dns.ConnectionStater.
+type responseWriter struct {
+	connection *quic.Conn
+	stream     *quic.Stream
+	// padded is set when the query was padded, in which case so is the
+	// response. The query then had an OPT record, so the response may have
+	// one too (RFC 6891 section 7).
+	padded   bool
+	written  bool
+	hijacked bool
+}
+
+func (w *responseWriter) LocalAddr() net.Addr {
+	return w.connection.LocalAddr()
+}
+
+func (w *responseWriter) RemoteAddr() net.Addr {
+	return w.connection.RemoteAddr()
+}
+
+func (w *responseWriter) ConnectionState() *tls.ConnectionState {
+	connectionState := w.connection.ConnectionState().TLS
+	return &connectionState
+}
+
+func (w *responseWriter) WriteMsg(message *dns.Msg) error {
+	if message == nil {
+		return nil
+	}
+
+	var blockSize int
+	if w.padded {
+		blockSize = ResponsePaddingBlockSize
+	}
+
+	messageBytes, err := prepareMessage(message, blockSize).Pack()
+	if err != nil {
+		return altshiftErrors.NewWithTrace(fmt.Errorf("response pack: %w", err))
+	}
+
+	if _, err := w.Write(messageBytes); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// Write writes a raw message, which it prefixes with its length.
+func (w *responseWriter) Write(messageBytes []byte) (int, error) {
+	if len(messageBytes) > 0xFFFF {
+		return 0, altshiftErrors.NewWithTrace(
+			fmt.Errorf("%w (%d)", dnsUtilsQuicErrors.ErrMessageLengthOverflow, len(messageBytes)),
+		)
+	}
+
+	frame := make([]byte, 2, 2+len(messageBytes))
+	binary.BigEndian.PutUint16(frame, uint16(len(messageBytes)))
+	frame = append(frame, messageBytes...)
+
+	w.written = true
+	n, err := w.stream.Write(frame)
+	if err != nil {
+		return max(n-2, 0), altshiftErrors.NewWithTrace(fmt.Errorf("stream write: %w", err))
+	}
+
+	return len(messageBytes), nil
+}
+
+func (w *responseWriter) Close() error {
+	return w.stream.Close()
+}
+
+func (w *responseWriter) TsigStatus() error {
+	return nil
+}
+
+func (w *responseWriter) TsigTimersOnly(bool) {}
+
+func (w *responseWriter) Hijack() {
+	w.hijacked = true
+}
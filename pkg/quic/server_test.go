@@ -0,0 +1,196 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// writeTestFrames writes the messages to a new stream of a new connection to
+// the server, ends the stream and returns it.
+func writeTestFrames(t *testing.T, server *testDoqServer, messages ...*dns.Msg) *quic.Stream {
+	t.Helper()
+
+	connection, err := quic.DialAddr(context.Background(), server.address, server.tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("dial addr: %v", err)
+	}
+	t.Cleanup(func() { _ = connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, "") })
+
+	stream, err := connection.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatalf("open stream sync: %v", err)
+	}
+
+	for _, message := range messages {
+		messageBytes, err := message.Pack()
+		if err != nil {
+			t.Fatalf("pack: %v", err)
+		}
+		if err := binary.Write(stream, binary.BigEndian, uint16(len(messageBytes))); err != nil {
+			t.Fatalf("write length: %v", err)
+		}
+		if _, err := stream.Write(messageBytes); err != nil {
+			t.Fatalf("write message: %v", err)
+		}
+	}
+
+	if err := stream.Close(); err != nil {
+		t.Fatalf("stream close: %v", err)
+	}
+
+	return stream
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	negotiatedProtocols := make(chan string, 1)
+	server := startTestDoqServerWithHandler(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if connectionStater, ok := w.(dns.ConnectionStater); ok {
+			negotiatedProtocols <- connectionStater.ConnectionState().NegotiatedProtocol
+		}
+		_ = w.WriteMsg(aHandler(r))
+	}))
+
+	msg := newTestQuestion("example.com")
+	msg.Id = 4711
+
+	got, err := Exchange(context.Background(), msg, server.address, server.tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Id != msg.Id {
+		t.Errorf("response ID = %d, want %d", got.Id, msg.Id)
+	}
+	if len(got.Answer) != 1 {
+		t.Errorf("len(Answer) = %d, want 1", len(got.Answer))
+	}
+
+	// The query was padded, so the response is.
+	if length := got.Len(); length%ResponsePaddingBlockSize != 0 {
+		t.Errorf("response length = %d, want a multiple of %d", length, ResponsePaddingBlockSize)
+	}
+
+	if protocol := <-negotiatedProtocols; protocol != Alpn {
+		t.Errorf("NegotiatedProtocol = %q, want %q", protocol, Alpn)
+	}
+}
+
+func TestServer_ProtocolErrors(t *testing.T) {
+	t.Parallel()
+
+	nonZeroId := newTestQuestion("example.com")
+	nonZeroId.Id = 1234
+
+	keepalive := newTestQuestion("example.com")
+	keepalive.Id = 0
+	keepalive.SetEdns0(dns.MaxMsgSize, false)
+	opt := keepalive.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Length: 2, Timeout: 100})
+
+	first := newTestQuestion("example.com")
+	first.Id = 0
+	second := newTestQuestion("example.org")
+	second.Id = 0
+
+	tests := []struct {
+		name     string
+		messages []*dns.Msg
+	}{
+		{name: "non-zero message id", messages: []*dns.Msg{nonZeroId}},
+		{name: "edns-tcp-keepalive", messages: []*dns.Msg{keepalive}},
+		{name: "more than one query", messages: []*dns.Msg{first, second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := startTestDoqServer(t, aHandler)
+			stream := writeTestFrames(t, server, tt.messages...)
+
+			_, err := io.ReadAll(stream)
+
+			applicationError, ok := errors.AsType[*quic.ApplicationError](err)
+			if !ok {
+				t.Fatalf("err type = %T (%v), want *quic.ApplicationError", err, err)
+			}
+			if applicationError.ErrorCode != dnsUtilsQuicErrors.DoqProtocolError {
+				t.Errorf("ErrorCode = %#x, want DOQ_PROTOCOL_ERROR", uint64(applicationError.ErrorCode))
+			}
+		})
+	}
+}
+
+func TestServer_FormatError(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	connection, err := quic.DialAddr(context.Background(), server.address, server.tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("dial addr: %v", err)
+	}
+	t.Cleanup(func() { _ = connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, "") })
+
+	stream, err := connection.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatalf("open stream sync: %v", err)
+	}
+	_, _ = stream.Write([]byte{0, 3, 1, 2, 3})
+	_ = stream.Close()
+
+	responseBytes, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read all: %v", err)
+	}
+
+	var response dns.Msg
+	if err := response.Unpack(responseBytes[2:]); err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+	if response.Rcode != dns.RcodeFormatError {
+		t.Errorf("Rcode = %d, want %d", response.Rcode, dns.RcodeFormatError)
+	}
+}
+
+func TestServer_ListenAndServe_UnsupportedAlpn(t *testing.T) {
+	t.Parallel()
+
+	server := &Server{Addr: "127.0.0.1:0", TlsConfig: &tls.Config{NextProtos: []string{"h3"}}}
+
+	if err := server.ListenAndServe(); !errors.Is(err, dnsUtilsQuicErrors.ErrUnsupportedAlpn) {
+		t.Errorf("err = %v, want ErrUnsupportedAlpn", err)
+	}
+}
+
+func TestServer_ServeAfterShutdown(t *testing.T) {
+	t.Parallel()
+
+	server := &Server{}
+	if err := server.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	certificate, _ := makeTestCertificate(t)
+	listener, err := quic.ListenAddr(
+		"127.0.0.1:0",
+		&tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: []string{Alpn}},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("listen addr: %v", err)
+	}
+
+	if err := server.Serve(listener); !errors.Is(err, dnsUtilsQuicErrors.ErrServerClosed) {
+		t.Errorf("err = %v, want ErrServerClosed", err)
+	}
+}
@@ -0,0 +1,270 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// Session exchanges messages over long-lived DNS-over-QUIC connections, one per
+// server, with each query on a stream of its own (RFC 9250 section 4.2), so
+// that concurrent exchanges share a connection. A connection that has been
+// closed, e.g. on idle timeout, is replaced on the next exchange. Resumed
+// connections send their queries as 0-RTT data.
+//
+// A Session satisfies the Exchanger of the client configuration. It is safe
+// for concurrent use.
+type Session struct {
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+
+	mutex       sync.Mutex
+	connections map[string]*quic.Conn
+	dials       map[string]*dial
+	closed      bool
+}
+
+// dial is a connection attempt that is in progress, whose result is shared by
+// the exchanges that wait for it.
+type dial struct {
+	done       chan struct{}
+	connection *quic.Conn
+	err        error
+	// cancelled tells that the attempt was given up by the exchange that made
+	// it, rather than failed.
+	cancelled bool
+}
+
+// NewSession returns a session using the configurations for its connections.
+// Unless the TLS configuration has a session cache, one is added, so that the
+// connections can be resumed.
+func NewSession(tlsConfig *tls.Config, quicConfig *quic.Config) (*Session, error) {
+	tlsConfig, err := doqTlsConfig(tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("doq tls config: %w", err)
+	}
+	tlsConfig = tlsConfig.Clone()
+
+	if tlsConfig.ClientSessionCache == nil {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	return &Session{
+		tlsConfig:   tlsConfig,
+		quicConfig:  quicConfig,
+		connections: make(map[string]*quic.Conn),
+		dials:       make(map[string]*dial),
+	}, nil
+}
+
+// connection returns the open connection to the server, dialing one if there
+// is none. It also reports whether the connection was already open. The
+// session is not locked while dialing; exchanges with the same server wait for
+// the dial in progress, and those with other servers are not held up by it.
+func (s *Session) connection(ctx context.Context, serverAddress string) (*quic.Conn, bool, error) {
+	for {
+		s.mutex.Lock()
+
+		if s.closed {
+			s.mutex.Unlock()
+			return nil, false, dnsUtilsQuicErrors.ErrSessionClosed
+		}
+
+		if connection, ok := s.connections[serverAddress]; ok {
+			if connection.Context().Err() == nil {
+				s.mutex.Unlock()
+				return connection, true, nil
+			}
+			delete(s.connections, serverAddress)
+		}
+
+		d, ok := s.dials[serverAddress]
+		if !ok {
+			d = &dial{done: make(chan struct{})}
+			s.dials[serverAddress] = d
+			s.mutex.Unlock()
+
+			return s.dial(ctx, serverAddress, d)
+		}
+
+		s.mutex.Unlock()
+
+		select {
+		case <-d.done:
+		case <-ctx.Done():
+			return nil, false, context.Cause(ctx)
+		}
+
+		// A dial given up by another exchange says nothing about the server;
+		// try again.
+		if !d.cancelled {
+			return d.connection, false, d.err
+		}
+	}
+}
+
+// dial makes the connection attempt d to the server and, if it succeeds,
+// stores the connection.
+func (s *Session) dial(ctx context.Context, serverAddress string, d *dial) (*quic.Conn, bool, error) {
+	connection, err := quic.DialAddrEarly(ctx, serverAddress, s.tlsConfig, s.quicConfig)
+	if err != nil {
+		err = fmt.Errorf("quic dial addr early: %w", err)
+	}
+
+	s.mutex.Lock()
+	if s.dials[serverAddress] == d {
+		delete(s.dials, serverAddress)
+	}
+	if err == nil {
+		if s.closed {
+			_ = connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, "")
+			connection, err = nil, dnsUtilsQuicErrors.ErrSessionClosed
+		} else {
+			s.connections[serverAddress] = connection
+		}
+	}
+	d.connection, d.err = connection, err
+	d.cancelled = err != nil && ctx.Err() != nil
+	s.mutex.Unlock()
+
+	close(d.done)
+
+	return connection, false, err
+}
+
+// replace swaps the server's connection for another, unless the connection has
+// been replaced already.
+func (s *Session) replace(serverAddress string, connection *quic.Conn, replacement *quic.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.connections[serverAddress] != connection {
+		return
+	}
+
+	if replacement == nil || s.closed {
+		delete(s.connections, serverAddress)
+	} else {
+		s.connections[serverAddress] = replacement
+	}
+}
+
+// isConnectionClosed reports whether the exchange failed because the
+// connection, rather than the stream, is gone.
+func isConnectionClosed(connection *quic.Conn, err error) bool {
+	if connection.Context().Err() != nil {
+		return true
+	}
+
+	if _, ok := errors.AsType[*quic.IdleTimeoutError](err); ok {
+		return true
+	}
+	if _, ok := errors.AsType[*quic.StatelessResetError](err); ok {
+		return true
+	}
+	if _, ok := errors.AsType[*quic.TransportError](err); ok {
+		return true
+	}
+
+	return false
+}
+
+func (s *Session) Exchange(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	dnsContext.QuestionMessage = message
+	if dnsContext.ServerAddress == "" {
+		dnsContext.ServerAddress = serverAddress
+	}
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	if s == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, dnsUtilsQuicErrors.ErrSessionClosed)
+	}
+
+	if serverAddress == "" {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	connection, reused, err := s.connection(ctx, serverAddress)
+	if err != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("connection: %w", err))
+	}
+
+	response, err := ExchangeWithConn(ctxWithDnsContext, message, connection)
+	switch {
+	case err == nil:
+		return response, nil
+	case errors.Is(err, quic.Err0RTTRejected):
+		// The data sent as 0-RTT was discarded; send it again once the
+		// handshake is complete.
+		nextConnection, nextErr := connection.NextConnection(ctx)
+		if nextErr != nil {
+			s.replace(serverAddress, connection, nil)
+			return nil, altshiftErrors.NewWithTraceCtx(
+				ctxWithDnsContext,
+				fmt.Errorf("connection next connection: %w", nextErr),
+			)
+		}
+		s.replace(serverAddress, connection, nextConnection)
+		connection = nextConnection
+	case reused && isConnectionClosed(connection, err):
+		// The connection went away while idle; dial a new one.
+		s.replace(serverAddress, connection, nil)
+		connection, _, err = s.connection(ctx, serverAddress)
+		if err != nil {
+			return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("connection: %w", err))
+		}
+	default:
+		return response, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("exchange with conn: %w", err))
+	}
+
+	response, err = ExchangeWithConn(ctxWithDnsContext, message, connection)
+	if err != nil {
+		return response, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, fmt.Errorf("exchange with conn: %w", err))
+	}
+
+	return response, nil
+}
+
+// Close closes the connections of the session; subsequent exchanges fail.
+func (s *Session) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+
+	var errs []error
+	for serverAddress, connection := range s.connections {
+		if err := connection.CloseWithError(dnsUtilsQuicErrors.DoqNoError, ""); err != nil {
+			errs = append(errs, fmt.Errorf("connection close with error (%s): %w", serverAddress, err))
+		}
+		delete(s.connections, serverAddress)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return altshiftErrors.NewWithTrace(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsQuicErrors "github.com/Motmedel/dns_utils/pkg/quic/errors"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+func newTestQuestion(domain string) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	return msg
+}
+
+func newTestSession(t *testing.T, tlsConfig *tls.Config, quicConfig *quic.Config) *Session {
+	t.Helper()
+
+	session, err := NewSession(tlsConfig, quicConfig)
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+
+	return session
+}
+
+func TestSession_ReusesTheConnection(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	session := newTestSession(t, server.tlsConfig, nil)
+	t.Cleanup(func() { _ = session.Close() })
+
+	const queries = 16
+
+	var waitGroup sync.WaitGroup
+	errs := make(chan error, queries)
+	for i := range queries {
+		waitGroup.Go(func() {
+			response, err := session.Exchange(
+				context.Background(),
+				newTestQuestion(fmt.Sprintf("host%d.example.com", i)),
+				server.address,
+			)
+			if err == nil && len(response.Answer) != 1 {
+				err = fmt.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+			}
+			errs <- err
+		})
+	}
+	waitGroup.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if got := server.connections.Load(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+}
+
+func TestSession_DialDoesNotBlockOtherServers(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	// A server that never completes the handshake.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen packet: %v", err)
+	}
+	t.Cleanup(func() { _ = silent.Close() })
+
+	session := newTestSession(t, server.tlsConfig, nil)
+	t.Cleanup(func() { _ = session.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	silentDone := make(chan error, 1)
+	go func() {
+		_, err := session.Exchange(ctx, newTestQuestion("example.com"), silent.LocalAddr().String())
+		silentDone <- err
+	}()
+
+	// Let the dial to the silent server start.
+	time.Sleep(50 * time.Millisecond)
+
+	exchangeCtx, exchangeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer exchangeCancel()
+
+	if _, err := session.Exchange(exchangeCtx, newTestQuestion("example.com"), server.address); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cancel()
+	if err := <-silentDone; err == nil {
+		t.Error("expected the exchange with the silent server to fail")
+	}
+}
+
+func TestSession_ReconnectsAfterIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	session := newTestSession(t, server.tlsConfig, &quic.Config{MaxIdleTimeout: 200 * time.Millisecond})
+	t.Cleanup(func() { _ = session.Close() })
+
+	if _, err := session.Exchange(context.Background(), newTestQuestion("example.com"), server.address); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if _, err := session.Exchange(context.Background(), newTestQuestion("example.com"), server.address); err != nil {
+		t.Fatalf("unexpected error after idle timeout: %v", err)
+	}
+
+	if got := server.connections.Load(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+}
+
+func TestSession_ResumesWith0Rtt(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	first := newTestSession(t, server.tlsConfig, nil)
+	if _, err := first.Exchange(context.Background(), newTestQuestion("example.com"), server.address); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The second session shares the session cache of the first.
+	second := newTestSession(t, first.tlsConfig, nil)
+	t.Cleanup(func() { _ = second.Close() })
+
+	// Allow the session ticket to arrive before the first connection goes.
+	time.Sleep(50 * time.Millisecond)
+	if err := first.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	response, err := second.Exchange(context.Background(), newTestQuestion("example.com"), server.address)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.Answer) != 1 {
+		t.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.resumed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := server.resumed.Load(); got != 1 {
+		t.Errorf("resumed = %d, want 1", got)
+	}
+}
+
+func TestSession_RcodeError(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	session := newTestSession(t, server.tlsConfig, nil)
+	t.Cleanup(func() { _ = session.Close() })
+
+	response, err := session.Exchange(context.Background(), newTestQuestion("host.missing"), server.address)
+
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok {
+		t.Fatalf("err type = %T (%v), want *dnsUtilsErrors.RcodeError", err, err)
+	}
+	if rcodeError.Rcode != dns.RcodeNameError {
+		t.Errorf("Rcode = %d, want %d", rcodeError.Rcode, dns.RcodeNameError)
+	}
+	if response == nil {
+		t.Error("response = nil, want the NXDOMAIN response")
+	}
+}
+
+func TestSession_Closed(t *testing.T) {
+	t.Parallel()
+
+	server := startTestDoqServer(t, aHandler)
+
+	session := newTestSession(t, server.tlsConfig, nil)
+	if err := session.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	_, err := session.Exchange(context.Background(), newTestQuestion("example.com"), server.address)
+	if !errors.Is(err, dnsUtilsQuicErrors.ErrSessionClosed) {
+		t.Errorf("err = %v, want ErrSessionClosed", err)
+	}
+}
+
+func TestNewSession_UnsupportedAlpn(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewSession(&tls.Config{NextProtos: []string{"h3"}}, nil)
+	if !errors.Is(err, dnsUtilsQuicErrors.ErrUnsupportedAlpn) {
+		t.Errorf("err = %v, want ErrUnsupportedAlpn", err)
+	}
+}
@@ -2,13 +2,26 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Motmedel/dns_utils/pkg/cache"
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
 	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	"github.com/Motmedel/dns_utils/pkg/dnssec"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
 	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	altshiftContext "github.com/altshiftab/utils_go/pkg/context"
 	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
 	"github.com/altshiftab/utils_go/pkg/errors/types/empty_error"
+	"github.com/altshiftab/utils_go/pkg/errors/types/nil_error"
 	"github.com/miekg/dns"
 )
 
@@ -16,65 +29,630 @@ var DefaultClient = New()
 
 type Client struct {
 	*config.Config
+
+	flights  flightGroup
+	cookies  cookieJar
+	rotation atomic.Uint64
+
+	validatorOnce sync.Once
+	validator     *dnssec.Validator
 }
 
-func (c *Client) resolve() (*dns.Client, string) {
+func (c *Client) resolve() (config.Exchanger, []string, *config.RetryPolicy) {
 	if c == nil || c.Config == nil {
-		return nil, ""
+		return nil, nil, nil
+	}
+
+	exchanger := c.Exchanger
+	if exchanger == nil && c.DnsClient != nil {
+		exchanger = &dns_utils.Exchanger{Client: c.DnsClient, CaseRandomization: c.CaseRandomization}
+	}
+
+	addresses := c.ServerAddresses()
+	if c.Rotate && len(addresses) > 1 {
+		start := int(c.rotation.Add(1)-1) % len(addresses)
+		addresses = append(addresses[start:len(addresses):len(addresses)], addresses[:start]...)
+	}
+
+	return exchanger, addresses, c.RetryPolicy
+}
+
+// udpSize returns the EDNS(0) buffer size to advertise, which only applies to
+// queries sent over UDP with the DNS client.
+func (c *Client) udpSize() uint16 {
+	if c == nil || c.Config == nil || c.Exchanger != nil || c.DnsClient == nil {
+		return 0
+	}
+	if strings.HasPrefix(c.DnsClient.Net, "tcp") {
+		return 0
 	}
-	return c.DnsClient, c.Address
+	return c.DnsClient.UDPSize
 }
 
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Exchange answers the message from the hosts file, then from the cache and
+// otherwise from the servers, which are tried per the retry policy. Each of
+// those steps is described with its field of config.Config.
 func (c *Client) Exchange(ctx context.Context, message *dns.Msg) (*dns.Msg, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.Exchange(ctx, message, dnsClient, address)
+	if message == nil {
+		return nil, nil
+	}
+
+	message = c.withOptions(message)
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+
+	responseMessage, err := c.lookup(ctx, dnsContext, message)
+
+	if c.validatesDnssec() && !dnsContext.HostsFile && responseMessage != nil && (err == nil || isNameError(err)) {
+		dnsContext.Dnssec = c.ValidateDnssec(ctx, responseMessage)
+		dnsContext.Denial = c.Validator().ValidateDenial(ctx, responseMessage)
+
+		// The query had the CD bit set, so it is up to the client to reject
+		// bogus data (RFC 4035 section 4.9.3).
+		if bogusError := newBogusError(dnsContext.Dnssec, dnsContext.Denial); bogusError != nil {
+			return nil, altshiftErrors.NewWithTraceCtx(
+				dnsUtilsContext.WithDnsContextValue(ctx, dnsContext),
+				bogusError,
+			)
+		}
+	}
+
+	return responseMessage, err
+}
+
+// newBogusError returns the error for the first of the results, or the denial,
+// that is bogus; nil when none is.
+func newBogusError(results []*dnsUtilsDnssecTypes.Result, denial *dnsUtilsDnssecTypes.Denial) error {
+	for _, result := range results {
+		if result != nil && result.Status == dnsUtilsDnssecTypes.StatusBogus {
+			return &dnsUtilsErrors.DnssecBogusError{Result: result}
+		}
+	}
+
+	if denial != nil && denial.Status == dnsUtilsDnssecTypes.StatusBogus {
+		recordType := dns.TypeNSEC
+		if denial.Nsec3 {
+			recordType = dns.TypeNSEC3
+		}
+		return &dnsUtilsErrors.DnssecBogusError{
+			Result: &dnsUtilsDnssecTypes.Result{
+				Name:   denial.Name,
+				Type:   recordType,
+				Status: denial.Status,
+				Reason: denial.Reason,
+			},
+		}
+	}
+
+	return nil
+}
+
+// lookup answers the message from the hosts file, the cache or the servers, as
+// described for Exchange.
+func (c *Client) lookup(
+	ctx context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	message *dns.Msg,
+) (*dns.Msg, error) {
+	dnsContext.QuestionMessage = message
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	if hostsMessage, ok := c.hostsResponse(ctxWithDnsContext, message); ok {
+		t := time.Now()
+		dnsContext.Time = &t
+		dnsContext.AnswerMessage = hostsMessage
+		dnsContext.HostsFile = true
+
+		return hostsMessage, nil
+	}
+
+	var responseCache *cache.Cache
+	if c != nil && c.Config != nil {
+		responseCache = c.Cache
+	}
+
+	key, cacheable := cache.KeyFromMessage(message)
+	cacheable = cacheable && responseCache != nil
+
+	if cacheable {
+		if cachedMessage, ok := responseCache.Get(key); ok {
+			if responseCache.Prefetch(key) {
+				dnsContext.Prefetch = true
+				go c.prefetch(context.WithoutCancel(ctx), key, message.Copy())
+			}
+
+			dnsContext.Cached = true
+			return cachedResponse(ctxWithDnsContext, dnsContext, message, cachedMessage)
+		}
+	}
+
+	responseMessage, err := c.exchange(ctx, ctxWithDnsContext, dnsContext, message)
+	dnsContext.ClientSubnet = dns_utils.GetClientSubnet(responseMessage)
+	dnsContext.Nsid, _ = dns_utils.GetNsid(responseMessage)
+	if !cacheable {
+		return responseMessage, err
+	}
+
+	if responseMessage != nil && (err == nil || errors.Is(err, dnsUtilsErrors.ErrUnsuccessfulRcode)) {
+		responseCache.Set(key, responseMessage)
+	}
+
+	if err != nil && ctx.Err() == nil && resolutionFailed(err) {
+		if staleMessage, ok := responseCache.GetStale(key); ok {
+			dnsContext.Cached = true
+			dnsContext.Stale = true
+			return cachedResponse(ctxWithDnsContext, dnsContext, message, staleMessage)
+		}
+	}
+
+	return responseMessage, err
+}
+
+// withOptions returns a copy of the message with the configured EDNS(0)
+// options that it does not have already, or the message itself if there are
+// none to add.
+func (c *Client) withOptions(message *dns.Msg) *dns.Msg {
+	if c == nil || c.Config == nil {
+		return message
+	}
+
+	clientSubnet := dns_utils.ClientSubnetFor(message, c.ClientSubnet4, c.ClientSubnet6)
+	addClientSubnet := clientSubnet.IsValid() && dns_utils.GetClientSubnet(message) == nil
+	if !addClientSubnet && !c.Nsid && !c.DnssecValidation {
+		return message
+	}
+
+	message = message.Copy()
+	if addClientSubnet {
+		dns_utils.SetClientSubnet(message, clientSubnet)
+	}
+	if c.Nsid {
+		dns_utils.RequestNsid(message)
+	}
+	if c.DnssecValidation {
+		// The signatures are needed, and bogus responses are not to be
+		// withheld by a validating server.
+		if opt := message.IsEdns0(); opt != nil {
+			opt.SetDo()
+		} else {
+			message.SetEdns0(dns.DefaultMsgSize, true)
+		}
+		message.CheckingDisabled = true
+	}
+
+	return message
+}
+
+// hostsResponse returns a response to the message with the records of the
+// hosts file that answer it, if there are any.
+func (c *Client) hostsResponse(ctx context.Context, message *dns.Msg) (*dns.Msg, bool) {
+	if c == nil || c.Config == nil || c.HostsFile == nil || len(message.Question) != 1 {
+		return nil, false
+	}
+
+	hostsFileHosts, err := c.HostsFile.Hosts(ctx)
+	if err != nil {
+		slog.WarnContext(
+			altshiftContext.WithError(ctx, fmt.Errorf("hosts file hosts: %w", err)),
+			"An error occurred when reading the hosts file.",
+		)
+		return nil, false
+	}
+
+	answers := hostsFileHosts.Answer(message.Question[0])
+	if len(answers) == 0 {
+		return nil, false
+	}
+
+	responseMessage := new(dns.Msg)
+	responseMessage.SetReply(message)
+	responseMessage.Authoritative = true
+	responseMessage.RecursionAvailable = true
+	responseMessage.Answer = answers
+
+	return responseMessage, true
+}
+
+// cachedResponse makes a cached response the answer to the message.
+func cachedResponse(
+	ctx context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	message *dns.Msg,
+	cachedMessage *dns.Msg,
+) (*dns.Msg, error) {
+	cachedMessage.Id = message.Id
+
+	t := time.Now()
+	dnsContext.Time = &t
+	dnsContext.AnswerMessage = cachedMessage
+	dnsContext.ClientSubnet = dns_utils.GetClientSubnet(cachedMessage)
+	dnsContext.Nsid, _ = dns_utils.GetNsid(cachedMessage)
+
+	if cachedMessage.Rcode != dns.RcodeSuccess {
+		return cachedMessage, altshiftErrors.NewWithTraceCtx(
+			ctx,
+			dnsUtilsErrors.NewRcodeError(cachedMessage),
+		)
+	}
+
+	return cachedMessage, nil
+}
+
+// resolutionFailed reports whether the error means that no answer could be
+// obtained, as opposed to an answer that the name or data does not exist.
+func resolutionFailed(err error) bool {
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok {
+		return true
+	}
+	return rcodeError.Rcode == dns.RcodeServerFailure || rcodeError.Rcode == dns.RcodeRefused
+}
+
+// prefetch refreshes the cached response to the message.
+func (c *Client) prefetch(ctx context.Context, key cache.Key, message *dns.Msg) {
+	dnsContext := &dnsUtilsTypes.DnsContext{QuestionMessage: message, Prefetch: true}
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	// Whatever the outcome, a response that was not replaced may be prefetched
+	// again.
+	defer c.Cache.EndPrefetch(key)
+
+	responseMessage, err := c.exchange(ctx, ctxWithDnsContext, dnsContext, message)
+	if responseMessage != nil && (err == nil || errors.Is(err, dnsUtilsErrors.ErrUnsuccessfulRcode)) {
+		c.Cache.Set(key, responseMessage)
+		return
+	}
+
+	if err != nil {
+		slog.WarnContext(
+			altshiftContext.WithError(ctxWithDnsContext, fmt.Errorf("exchange: %w", err)),
+			"An error occurred when prefetching a response.",
+		)
+	}
+}
+
+func (c *Client) exchange(
+	ctx context.Context,
+	ctxWithDnsContext context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	message *dns.Msg,
+) (*dns.Msg, error) {
+	exchanger, addresses, retryPolicy := c.resolve()
+	if exchanger == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("dns client"))
+	}
+
+	if len(addresses) == 0 {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	var responseMessage *dns.Msg
+	var err error
+	for range retryPolicy.NumRounds() {
+		for _, address := range addresses {
+			var done bool
+			responseMessage, done, err = c.serverExchange(
+				ctx,
+				ctxWithDnsContext,
+				dnsContext,
+				exchanger,
+				retryPolicy,
+				message,
+				address,
+			)
+			if done {
+				return responseMessage, err
+			}
+		}
+	}
+
+	return responseMessage, err
+}
+
+// serverExchange exchanges the message with the server, as many times as the
+// retry policy allows. It reports whether the exchange is done, which it is
+// unless the last failure is one to move on to the next server after.
+func (c *Client) serverExchange(
+	ctx context.Context,
+	ctxWithDnsContext context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	exchanger config.Exchanger,
+	retryPolicy *config.RetryPolicy,
+	message *dns.Msg,
+	address string,
+) (*dns.Msg, bool, error) {
+	var responseMessage *dns.Msg
+	var err error
+	for attempt := range retryPolicy.NumAttempts() {
+		if backoff := retryPolicy.BackoffDuration(attempt); backoff > 0 {
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, true, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, err)
+			}
+		}
+
+		// A previous attempt may have recorded another server.
+		dnsContext.ServerAddress = address
+
+		responseMessage, err = c.cookieExchange(ctx, dnsContext, exchanger, message, address)
+		if err == nil {
+			return responseMessage, true, nil
+		}
+
+		if ctx.Err() != nil || !retryPolicy.Retryable(err) {
+			return responseMessage, true, err
+		}
+	}
+
+	return responseMessage, false, err
+}
+
+func isNameError(err error) bool {
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	return ok && rcodeError.Rcode == dns.RcodeNameError
+}
+
+// searchAnswers gets the answers for each name to query for the domain in
+// turn, until one is not NXDOMAIN, recording the name in the DNS context. The
+// error of the last name is returned when all of them are.
+func (c *Client) searchAnswers(
+	ctx context.Context,
+	domain string,
+	getAnswers func(name string) ([]dns.RR, error),
+) ([]dns.RR, error) {
+	names := []string{dns.Fqdn(domain)}
+	if c != nil {
+		names = c.SearchNames(domain)
+	}
+
+	dnsContext, _ := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+
+	var answers []dns.RR
+	var err error
+	for _, name := range names {
+		if dnsContext != nil {
+			dnsContext.QueriedName = name
+		}
+
+		answers, err = getAnswers(name)
+		if !isNameError(err) {
+			break
+		}
+	}
+
+	return answers, err
 }
 
 func (c *Client) GetDnsAnswersWithMessage(ctx context.Context, message *dns.Msg) ([]dns.RR, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.GetDnsAnswersWithMessage(ctx, message, dnsClient, address)
+	if message == nil {
+		return nil, nil
+	}
+
+	responseMessage, err := c.Exchange(ctx, message)
+	if err != nil {
+		return nil, fmt.Errorf("exchange: %w", err)
+	}
+	if responseMessage == nil {
+		return nil, altshiftErrors.NewWithTrace(nil_error.New("response message"))
+	}
+
+	return responseMessage.Answer, nil
+}
+
+// GetServerDnsAnswersWithMessage returns the answers to the message from the
+// server, rather than from the configured ones, such as an authoritative
+// server. The message is sent with the transport, cookies and retry policy of
+// the client, but without the hosts file, the cache or DNSSEC validation.
+func (c *Client) GetServerDnsAnswersWithMessage(
+	ctx context.Context,
+	message *dns.Msg,
+	serverAddress string,
+) ([]dns.RR, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+	}
+	dnsContext.QuestionMessage = message
+	dnsContext.ServerAddress = serverAddress
+	ctxWithDnsContext := dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+
+	exchanger, _, retryPolicy := c.resolve()
+	if exchanger == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("dns client"))
+	}
+
+	if serverAddress == "" {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, empty_error.New("dns server"))
+	}
+
+	responseMessage, _, err := c.serverExchange(
+		ctx,
+		ctxWithDnsContext,
+		dnsContext,
+		exchanger,
+		retryPolicy,
+		message,
+		serverAddress,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("server exchange: %w", err)
+	}
+	if responseMessage == nil {
+		return nil, altshiftErrors.NewWithTraceCtx(ctxWithDnsContext, nil_error.New("response message"))
+	}
+
+	return responseMessage.Answer, nil
 }
 
 func (c *Client) GetDnsAnswers(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.GetDnsAnswers(ctx, domain, recordType, dnsClient, address)
+	if domain == "" {
+		return nil, nil
+	}
+
+	if recordType == 0 {
+		return nil, altshiftErrors.NewWithTrace(dnsUtilsErrors.ErrUnsetRecordType)
+	}
+
+	answers, err := c.searchAnswers(ctx, domain, func(name string) ([]dns.RR, error) {
+		return c.GetDnsAnswersWithMessage(ctx, dns_utils.NewQuestionMessage(name, recordType, c.udpSize()))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get dns answers with message: %w", err)
+	}
+
+	return answers, nil
 }
 
 func (c *Client) GetDnsAnswerStrings(ctx context.Context, domain string, recordType uint16) ([]string, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.GetDnsAnswerStrings(ctx, domain, recordType, dnsClient, address)
+	answers, err := c.GetDnsAnswers(ctx, domain, recordType)
+	if err != nil {
+		return nil, fmt.Errorf("get dns answers: %w", err)
+	}
+
+	var answerStrings []string
+	for _, answer := range answers {
+		if answerString := dns_utils.GetAnswerString(answer); answerString != "" {
+			answerStrings = append(answerStrings, answerString)
+		}
+	}
+
+	return answerStrings, nil
 }
 
 func (c *Client) GetPrefixedTxtRecordStrings(ctx context.Context, domain string, prefix string) ([]string, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.GetPrefixedTxtRecordStrings(ctx, domain, prefix, dnsClient, address)
+	answerStrings, err := c.GetDnsAnswerStrings(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, fmt.Errorf("get dns answer strings: %w", err)
+	}
+
+	var prefixedAnswerStrings []string
+	for _, answerString := range answerStrings {
+		if strings.HasPrefix(answerString, prefix) {
+			prefixedAnswerStrings = append(prefixedAnswerStrings, answerString)
+		}
+	}
+
+	return prefixedAnswerStrings, nil
 }
 
+// DomainExists reports whether the domain exists, which it does unless the
+// response is NXDOMAIN. See DomainExistsWithDenial for whether that is proven.
 func (c *Client) DomainExists(ctx context.Context, domain string) (bool, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.DomainExists(ctx, domain, dnsClient, address)
+	exists, _, err := c.DomainExistsWithDenial(ctx, domain)
+	return exists, err
+}
+
+// DomainExistsWithDenial reports whether the domain exists, as DomainExists.
+// When it does not and the client validates DNSSEC, it also returns the
+// verification of the NSEC or NSEC3 records that prove it; a nil denial, or
+// one that is not proven, means that the non-existence is only claimed.
+func (c *Client) DomainExistsWithDenial(ctx context.Context, domain string) (bool, *dnsUtilsDnssecTypes.Denial, error) {
+	if domain == "" {
+		return false, nil, nil
+	}
+
+	dnsContext, ok := ctx.Value(dnsUtilsContext.DnsContextKey).(*dnsUtilsTypes.DnsContext)
+	if !ok || dnsContext == nil {
+		dnsContext = &dnsUtilsTypes.DnsContext{}
+		ctx = dnsUtilsContext.WithDnsContextValue(ctx, dnsContext)
+	}
+
+	// NOTE: The question type should not matter?
+	_, err := c.GetDnsAnswers(ctx, domain, dns.TypeSOA)
+	if err != nil {
+		if isNameError(err) {
+			return false, dnsContext.Denial, nil
+		}
+		return false, nil, fmt.Errorf("get dns answers: %w", err)
+	}
+
+	return true, nil, nil
 }
 
 func (c *Client) SupportsDnssec(ctx context.Context, domain string) (bool, error) {
-	dnsClient, address := c.resolve()
-	return dns_utils.SupportsDnssec(ctx, domain, dnsClient, address)
+	if domain == "" {
+		return false, nil
+	}
+
+	answers, err := c.searchAnswers(ctx, domain, func(name string) ([]dns.RR, error) {
+		return c.GetDnsAnswersWithMessage(ctx, dns_utils.NewDnssecQuestionMessage(name, dns.TypeDNSKEY))
+	})
+	if err != nil {
+		return false, fmt.Errorf("get dns answers with message: %w", err)
+	}
+
+	return dns_utils.ContainsDnskey(answers), nil
 }
 
 func New(options ...config.Option) *Client {
 	return &Client{Config: config.New(options...)}
 }
 
+// NewFromResolvConf returns a client for the servers in /etc/resolv.conf, per
+// NewFromResolverConfig.
 func NewFromResolvConf(ctx context.Context, options ...config.Option) (*Client, error) {
-	dnsServerAddresses, err := dns_utils.GetDnsServers(ctx)
+	resolverConfig, err := dns_utils.ReadResolvConf(ctx, dns_utils.DefaultResolvConfPath)
 	if err != nil {
-		return nil, fmt.Errorf("get dns servers: %w", err)
+		return nil, fmt.Errorf("read resolv conf: %w", err)
 	}
 
-	if len(dnsServerAddresses) == 0 {
+	client, err := NewFromResolverConfig(resolverConfig, options...)
+	if err != nil {
+		return nil, fmt.Errorf("new from resolver config: %w", err)
+	}
+
+	return client, nil
+}
+
+// NewFromResolverConfig returns a client for the servers of the resolver
+// configuration that honors its timeout, attempts, rotate and use-vc settings:
+// the list of servers is gone through Attempts times, and use-vc makes the
+// queries go over TCP. EDNS0 is used regardless, as it is by default. The
+// search list is only used with config.WithSearch. The options are applied
+// afterwards, and can override those settings.
+func NewFromResolverConfig(resolverConfig *dns_utils.ResolverConfig, options ...config.Option) (*Client, error) {
+	if resolverConfig == nil {
+		return nil, altshiftErrors.NewWithTrace(nil_error.New("resolver config"))
+	}
+
+	if len(resolverConfig.Nameservers) == 0 {
 		return nil, altshiftErrors.NewWithTrace(empty_error.New("dns server"))
 	}
 
-	address := net.JoinHostPort(dnsServerAddresses[0], "53")
-	options = append([]config.Option{config.WithAddress(address)}, options...)
+	dnsClient := &dns.Client{Timeout: resolverConfig.Timeout, UDPSize: config.DefaultUDPSize}
+	if resolverConfig.UseVc {
+		dnsClient.Net = "tcp"
+	}
+
+	retryPolicy := config.NewRetryPolicy()
+	retryPolicy.Rounds = resolverConfig.Attempts
+
+	options = append(
+		[]config.Option{
+			config.WithAddresses(resolverConfig.Nameservers...),
+			config.WithDnsClient(dnsClient),
+			config.WithRetryPolicy(retryPolicy),
+			config.WithRotate(resolverConfig.Rotate),
+		},
+		options...,
+	)
 	return New(options...), nil
 }
@@ -1,9 +1,26 @@
 package client
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Motmedel/dns_utils/pkg/cache"
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
 	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	"github.com/miekg/dns"
 )
 
 func TestNew_Defaults(t *testing.T) {
@@ -53,3 +70,747 @@ func TestDefaultClient(t *testing.T) {
 		t.Fatal("DefaultClient.DnsClient is nil")
 	}
 }
+
+func TestNew_WithAddresses(t *testing.T) {
+	t.Parallel()
+
+	addresses := []string{"192.0.2.1:53", "192.0.2.2:53"}
+	c := New(config.WithAddresses(addresses...))
+	if got := c.ServerAddresses(); !slices.Equal(got, addresses) {
+		t.Errorf("ServerAddresses() = %v, want %v", got, addresses)
+	}
+}
+
+// countingHandler wraps a handler and counts the queries it receives.
+func countingHandler(count *atomic.Int32, handler dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		count.Add(1)
+		handler(w, r)
+	}
+}
+
+func TestFailover_MovesToTheNextServer(t *testing.T) {
+	t.Parallel()
+
+	var failingCount, workingCount atomic.Int32
+
+	failingClient, teardownFailing := startTestDnsServer(t, countingHandler(&failingCount, servfailHandler()))
+	defer teardownFailing()
+	workingClient, teardownWorking := startTestDnsServer(t, countingHandler(&workingCount, txtHandler([][]string{{"hello"}})))
+	defer teardownWorking()
+
+	c := New(
+		config.WithDnsClient(workingClient.DnsClient),
+		config.WithAddresses(failingClient.Address, workingClient.Address),
+		config.WithRetryPolicy(&config.RetryPolicy{Attempts: 2, Rcodes: []int{dns.RcodeServerFailure}}),
+	)
+
+	dnsContext := &dnsUtilsTypes.DnsContext{}
+	ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	got, err := c.GetDnsAnswerStrings(ctx, "example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"hello"}) {
+		t.Errorf("got = %v, want [hello]", got)
+	}
+	if n := failingCount.Load(); n != 2 {
+		t.Errorf("failing server queried %d times, want 2", n)
+	}
+	if n := workingCount.Load(); n != 1 {
+		t.Errorf("working server queried %d times, want 1", n)
+	}
+	if dnsContext.ServerAddress != workingClient.Address {
+		t.Errorf("DnsContext.ServerAddress = %q, want %q", dnsContext.ServerAddress, workingClient.Address)
+	}
+}
+
+func TestFailover_AnswersAreNotRetried(t *testing.T) {
+	t.Parallel()
+
+	var firstCount, secondCount atomic.Int32
+
+	firstClient, teardownFirst := startTestDnsServer(t, countingHandler(&firstCount, nxdomainHandler()))
+	defer teardownFirst()
+	secondClient, teardownSecond := startTestDnsServer(t, countingHandler(&secondCount, txtHandler(nil)))
+	defer teardownSecond()
+
+	c := New(
+		config.WithDnsClient(firstClient.DnsClient),
+		config.WithAddresses(firstClient.Address, secondClient.Address),
+	)
+
+	exists, err := c.DomainExists(context.Background(), "missing.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("exists = true, want false")
+	}
+	if n := secondCount.Load(); n != 0 {
+		t.Errorf("second server queried %d times, want 0", n)
+	}
+}
+
+func TestFailover_LastErrorIsReturned(t *testing.T) {
+	t.Parallel()
+
+	firstClient, teardownFirst := startTestDnsServer(t, servfailHandler())
+	defer teardownFirst()
+	secondClient, teardownSecond := startTestDnsServer(t, servfailHandler())
+	defer teardownSecond()
+
+	c := New(
+		config.WithDnsClient(firstClient.DnsClient),
+		config.WithAddresses(firstClient.Address, secondClient.Address),
+	)
+
+	_, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeA)
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok {
+		t.Fatalf("err type = %T (%v), want *dnsUtilsErrors.RcodeError", err, err)
+	}
+	if rcodeError.Rcode != dns.RcodeServerFailure {
+		t.Errorf("rcode = %d, want %d", rcodeError.Rcode, dns.RcodeServerFailure)
+	}
+}
+
+func TestFailover_RoundsGoThroughAllServers(t *testing.T) {
+	t.Parallel()
+
+	var firstCount, secondCount atomic.Int32
+
+	firstClient, teardownFirst := startTestDnsServer(t, countingHandler(&firstCount, servfailHandler()))
+	defer teardownFirst()
+	// The second server only answers in the second round.
+	answering := txtHandler([][]string{{"hello"}})
+	failing := servfailHandler()
+	secondClient, teardownSecond := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if secondCount.Add(1) == 1 {
+			failing(w, r)
+			return
+		}
+		answering(w, r)
+	})
+	defer teardownSecond()
+
+	c := New(
+		config.WithDnsClient(firstClient.DnsClient),
+		config.WithAddresses(firstClient.Address, secondClient.Address),
+		config.WithRetryPolicy(&config.RetryPolicy{Rounds: 2, Rcodes: []int{dns.RcodeServerFailure}}),
+	)
+
+	got, err := c.GetDnsAnswerStrings(context.Background(), "example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"hello"}) {
+		t.Errorf("got = %v, want [hello]", got)
+	}
+	if n := firstCount.Load(); n != 2 {
+		t.Errorf("first server queried %d times, want 2", n)
+	}
+	if n := secondCount.Load(); n != 2 {
+		t.Errorf("second server queried %d times, want 2", n)
+	}
+}
+
+func TestCache_AnswersRepeatedQueries(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	testClient, teardown := startTestDnsServer(t, countingHandler(&count, txtHandler([][]string{{"hello"}})))
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithCache(cache.New()),
+	)
+
+	for range 3 {
+		got, err := c.GetDnsAnswerStrings(context.Background(), "example.com", dns.TypeTXT)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(got, []string{"hello"}) {
+			t.Errorf("got = %v, want [hello]", got)
+		}
+	}
+
+	if got := count.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+}
+
+func TestCache_AnswersRepeatedNegativeQueries(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	testClient, teardown := startTestDnsServer(t, countingHandler(&count, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		soa, _ := dns.NewRR("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 60")
+		m.Ns = append(m.Ns, soa)
+		_ = w.WriteMsg(m)
+	}))
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithCache(cache.New()),
+	)
+
+	for range 2 {
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		exists, err := c.DomainExists(ctx, "missing.example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if exists {
+			t.Error("exists = true, want false")
+		}
+		if dnsContext.AnswerMessage == nil || dnsContext.AnswerMessage.Rcode != dns.RcodeNameError {
+			t.Error("DnsContext.AnswerMessage is not the NXDOMAIN response")
+		}
+	}
+
+	if got := count.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+}
+
+func TestCache_ServesStale(t *testing.T) {
+	t.Parallel()
+
+	var failing atomic.Bool
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		if failing.Load() {
+			m.SetRcode(r, dns.RcodeServerFailure)
+		} else {
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 1},
+				Txt: []string{"hello"},
+			})
+		}
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	newClient := func(options ...cache.Option) *Client {
+		return New(
+			config.WithDnsClient(testClient.DnsClient),
+			config.WithAddress(testClient.Address),
+			config.WithCache(cache.New(options...)),
+		)
+	}
+
+	withStale := newClient(cache.WithServeStale(time.Hour))
+	withoutStale := newClient()
+
+	for _, c := range []*Client{withStale, withoutStale} {
+		if _, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	dnsContext := &dnsUtilsTypes.DnsContext{}
+	ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	if _, err := withStale.GetDnsAnswers(ctx, "example.com", dns.TypeTXT); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dnsContext.Cached || dnsContext.Stale {
+		t.Errorf("Cached, Stale = %v, %v, want true, false", dnsContext.Cached, dnsContext.Stale)
+	}
+
+	failing.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+
+	dnsContext = &dnsUtilsTypes.DnsContext{}
+	ctx = dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	answers, err := withStale.GetDnsAnswers(ctx, "example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(answers) != 1 || answers[0].Header().Ttl != uint32(cache.StaleTtl/time.Second) {
+		t.Errorf("answers = %v, want the stale answer", answers)
+	}
+	if !dnsContext.Cached || !dnsContext.Stale {
+		t.Errorf("Cached, Stale = %v, %v, want true, true", dnsContext.Cached, dnsContext.Stale)
+	}
+
+	if _, err := withoutStale.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT); !errors.Is(err, dnsUtilsErrors.ErrUnsuccessfulRcode) {
+		t.Errorf("err = %v, want ErrUnsuccessfulRcode", err)
+	}
+}
+
+func TestNewFromResolverConfig(t *testing.T) {
+	t.Parallel()
+
+	resolverConfig := &dns_utils.ResolverConfig{
+		Nameservers: []string{"192.0.2.1:53", "[2001:db8::1]:5353"},
+		Timeout:     3 * time.Second,
+		Attempts:    4,
+		Rotate:      true,
+	}
+
+	c, err := NewFromResolverConfig(resolverConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(c.ServerAddresses(), resolverConfig.Nameservers) {
+		t.Errorf("ServerAddresses() = %v, want %v", c.ServerAddresses(), resolverConfig.Nameservers)
+	}
+	if c.DnsClient.Timeout != resolverConfig.Timeout {
+		t.Errorf("Timeout = %v, want %v", c.DnsClient.Timeout, resolverConfig.Timeout)
+	}
+	// The attempts of the resolver configuration go through all the servers.
+	if got := c.RetryPolicy.NumRounds(); got != resolverConfig.Attempts {
+		t.Errorf("NumRounds() = %d, want %d", got, resolverConfig.Attempts)
+	}
+	if got := c.RetryPolicy.NumAttempts(); got != 1 {
+		t.Errorf("NumAttempts() = %d, want 1", got)
+	}
+	if !c.Rotate {
+		t.Error("Rotate = false, want true")
+	}
+	// Without edns0 the default UDP size is kept.
+	if c.DnsClient.UDPSize != config.DefaultUDPSize {
+		t.Errorf("UDPSize = %d, want %d", c.DnsClient.UDPSize, config.DefaultUDPSize)
+	}
+	if c.DnsClient.Net != "" {
+		t.Errorf("Net = %q, want udp", c.DnsClient.Net)
+	}
+
+	resolverConfig.Edns0 = true
+	resolverConfig.UseVc = true
+	c, err = NewFromResolverConfig(resolverConfig, config.WithRotate(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.DnsClient.UDPSize != config.DefaultUDPSize {
+		t.Errorf("UDPSize = %d, want %d", c.DnsClient.UDPSize, config.DefaultUDPSize)
+	}
+	if c.DnsClient.Net != "tcp" {
+		t.Errorf("Net = %q, want tcp", c.DnsClient.Net)
+	}
+	if c.Rotate {
+		t.Error("Rotate = true, want the option to override it")
+	}
+
+	if _, err := NewFromResolverConfig(&dns_utils.ResolverConfig{}); err == nil {
+		t.Error("expected an error without nameservers")
+	}
+}
+
+func TestRotate_SpreadsQueriesOverTheServers(t *testing.T) {
+	t.Parallel()
+
+	var firstCount, secondCount atomic.Int32
+	first, teardownFirst := startTestDnsServer(t, countingHandler(&firstCount, txtHandler([][]string{{"first"}})))
+	defer teardownFirst()
+	second, teardownSecond := startTestDnsServer(t, countingHandler(&secondCount, txtHandler([][]string{{"second"}})))
+	defer teardownSecond()
+
+	c := New(
+		config.WithDnsClient(first.DnsClient),
+		config.WithAddresses(first.Address, second.Address),
+		config.WithRotate(true),
+	)
+
+	for range 4 {
+		if _, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if firstCount.Load() != 2 || secondCount.Load() != 2 {
+		t.Errorf("queries = %d, %d, want 2, 2", firstCount.Load(), secondCount.Load())
+	}
+
+	// Rotating does not change the configured order.
+	if got := c.ServerAddresses(); !slices.Equal(got, []string{first.Address, second.Address}) {
+		t.Errorf("ServerAddresses() = %v", got)
+	}
+}
+
+// zoneHandler answers TXT queries for the names in the zone and NXDOMAIN for
+// all others, except those in servfail.
+func zoneHandler(zone map[string]string, servfail ...string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		name := r.Question[0].Name
+
+		switch text, ok := zone[name]; {
+		case slices.Contains(servfail, name):
+			m.SetRcode(r, dns.RcodeServerFailure)
+		case ok:
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{text},
+			})
+		default:
+			m.SetRcode(r, dns.RcodeNameError)
+		}
+
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestSearch_ExpandsRelativeNames(t *testing.T) {
+	t.Parallel()
+
+	testClient, teardown := startTestDnsServer(t, zoneHandler(
+		map[string]string{
+			"host.b.example.":    "b",
+			"host.c.example.":    "c",
+			"other.a.example.":   "a",
+			"other.sub.example.": "as is",
+		},
+		"broken.a.example.",
+	))
+	t.Cleanup(teardown)
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithSearch([]string{"a.example", "b.example", "c.example"}, 1),
+	)
+
+	tests := []struct {
+		name            string
+		domain          string
+		want            []string
+		wantErr         bool
+		wantQueriedName string
+	}{
+		{name: "the first answer wins", domain: "host", want: []string{"b"}, wantQueriedName: "host.b.example."},
+		{name: "as is first", domain: "other.sub.example", want: []string{"as is"}, wantQueriedName: "other.sub.example."},
+		{name: "an error that is not nxdomain stops the search", domain: "broken", wantErr: true, wantQueriedName: "broken.a.example."},
+		{name: "all nxdomain", domain: "missing", wantErr: true, wantQueriedName: "missing."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dnsContext := &dnsUtilsTypes.DnsContext{}
+			ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+			got, err := c.GetDnsAnswerStrings(ctx, tt.domain, dns.TypeTXT)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got = %v, want %v", got, tt.want)
+			}
+			if dnsContext.QueriedName != tt.wantQueriedName {
+				t.Errorf("QueriedName = %q, want %q", dnsContext.QueriedName, tt.wantQueriedName)
+			}
+		})
+	}
+
+	exists, err := c.DomainExists(context.Background(), "missing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("DomainExists(missing) = true, want false")
+	}
+}
+
+func TestHostsFile_AnswersBeforeTheNetwork(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("192.0.2.1 override.example.com\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	var count atomic.Int32
+	testClient, teardown := startTestDnsServer(t, countingHandler(&count, nxdomainHandler()))
+	t.Cleanup(teardown)
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithHostsFile(path),
+	)
+
+	tests := []struct {
+		name          string
+		domain        string
+		recordType    uint16
+		want          []string
+		wantErr       bool
+		wantHostsFile bool
+	}{
+		{
+			name:          "a",
+			domain:        "Override.example.com",
+			recordType:    dns.TypeA,
+			want:          []string{"192.0.2.1"},
+			wantHostsFile: true,
+		},
+		{
+			name:          "ptr",
+			domain:        "1.2.0.192.in-addr.arpa",
+			recordType:    dns.TypePTR,
+			want:          []string{"override.example.com."},
+			wantHostsFile: true,
+		},
+		{name: "no aaaa address", domain: "override.example.com", recordType: dns.TypeAAAA, wantErr: true},
+		{name: "not listed", domain: "other.example.com", recordType: dns.TypeA, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsContext := &dnsUtilsTypes.DnsContext{}
+			ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+			before := count.Load()
+
+			got, err := c.GetDnsAnswerStrings(ctx, tt.domain, tt.recordType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got = %v, want %v", got, tt.want)
+			}
+			if dnsContext.HostsFile != tt.wantHostsFile {
+				t.Errorf("HostsFile = %v, want %v", dnsContext.HostsFile, tt.wantHostsFile)
+			}
+
+			if queried := count.Load() != before; queried == tt.wantHostsFile {
+				t.Errorf("queried the server = %v", queried)
+			}
+		})
+	}
+}
+
+func TestCaseRandomization_DetectsAChangedCase(t *testing.T) {
+	t.Parallel()
+
+	var names []string
+	var mutex sync.Mutex
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mutex.Lock()
+		names = append(names, r.Question[0].Name)
+		mutex.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Question[0].Name = strings.ToLower(m.Question[0].Name)
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithCaseRandomization(dns_utils.CaseRandomizationFail),
+	)
+
+	// A name with enough letters that its randomized case is never all lower.
+	const domain = "abcdefghijklmnopqrstuvwxyz.example.com"
+
+	_, err := c.GetDnsAnswers(context.Background(), domain, dns.TypeA)
+	if !errors.Is(err, dnsUtilsErrors.ErrPossibleSpoofing) {
+		t.Errorf("err = %v, want ErrPossibleSpoofing", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(names) != 1 || names[0] == dns.Fqdn(domain) {
+		t.Errorf("queried names = %v, want one with a randomized case", names)
+	}
+}
+
+func TestClientSubnet_IsSentAndTheScopeRecorded(t *testing.T) {
+	t.Parallel()
+
+	var subnets []string
+	var mutex sync.Mutex
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		if subnet := dns_utils.GetClientSubnet(r); subnet != nil {
+			mutex.Lock()
+			subnets = append(subnets, subnet.String())
+			mutex.Unlock()
+
+			m.SetEdns0(dns.DefaultMsgSize, false)
+			scope := *subnet
+			scope.SourceScope = 16
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &scope)
+		}
+
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+			Txt: []string{"hello"},
+		})
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	responseCache := cache.New()
+	for _, prefix := range []string{"198.51.100.0/24", "2001:db8::/56"} {
+		c := New(
+			config.WithDnsClient(testClient.DnsClient),
+			config.WithAddress(testClient.Address),
+			config.WithCache(responseCache),
+			config.WithClientSubnet(netip.MustParsePrefix(prefix)),
+		)
+
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		if _, err := c.GetDnsAnswers(ctx, "example.com", dns.TypeTXT); err != nil {
+			t.Fatalf("%s: unexpected error: %v", prefix, err)
+		}
+		if dnsContext.Cached {
+			t.Errorf("%s: the response for another subnet was served from the cache", prefix)
+		}
+		if dnsContext.ClientSubnet == nil || dnsContext.ClientSubnet.SourceScope != 16 {
+			t.Errorf("%s: ClientSubnet = %v, want a scope of 16", prefix, dnsContext.ClientSubnet)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := []string{"198.51.100.0/24/0", "[2001:db8::]/56/0"}
+	if !slices.Equal(subnets, want) {
+		t.Errorf("subnets = %v, want %v", subnets, want)
+	}
+}
+
+func TestClientSubnet_OnePerAddressFamily(t *testing.T) {
+	t.Parallel()
+
+	var mutex sync.Mutex
+	subnets := make(map[uint16]string)
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if subnet := dns_utils.GetClientSubnet(r); subnet != nil {
+			mutex.Lock()
+			subnets[r.Question[0].Qtype] = subnet.String()
+			mutex.Unlock()
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithClientSubnet(
+			netip.MustParsePrefix("198.51.100.0/24"),
+			netip.MustParsePrefix("2001:db8::/56"),
+		),
+	)
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		if _, err := c.GetDnsAnswers(context.Background(), "example.com", recordType); err != nil {
+			t.Fatalf("%s: unexpected error: %v", dns.TypeToString[recordType], err)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if got, want := subnets[dns.TypeA], "198.51.100.0/24/0"; got != want {
+		t.Errorf("A subnet = %q, want %q", got, want)
+	}
+	if got, want := subnets[dns.TypeAAAA], "[2001:db8::]/56/0"; got != want {
+		t.Errorf("AAAA subnet = %q, want %q", got, want)
+	}
+}
+
+func TestExtendedErrors_AreFoundWithErrorsAs(t *testing.T) {
+	t.Parallel()
+
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		m.IsEdns0().Option = append(
+			m.IsEdns0().Option,
+			&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked, ExtraText: "malware"},
+		)
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(config.WithDnsClient(testClient.DnsClient), config.WithAddress(testClient.Address))
+
+	_, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeA)
+
+	extendedError, ok := errors.AsType[*dnsUtilsErrors.ExtendedDnsError](err)
+	if !ok {
+		t.Fatalf("err = %v, want an *ExtendedDnsError", err)
+	}
+	if extendedError.Rcode != dns.RcodeRefused || extendedError.InfoCode != dns.ExtendedErrorCodeBlocked {
+		t.Errorf("got = %+v, want a REFUSED Blocked error", extendedError)
+	}
+	if extendedError.ExtraText != "malware" {
+		t.Errorf("ExtraText = %q, want %q", extendedError.ExtraText, "malware")
+	}
+}
+
+func TestNsid_IsRequestedAndRecorded(t *testing.T) {
+	t.Parallel()
+
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		if opt := r.IsEdns0(); opt != nil {
+			for _, option := range opt.Option {
+				if option.Option() == dns.EDNS0NSID {
+					m.SetEdns0(dns.DefaultMsgSize, false)
+					m.IsEdns0().Option = append(
+						m.IsEdns0().Option,
+						&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte("ams01"))},
+					)
+				}
+			}
+		}
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	for _, nsid := range []bool{false, true} {
+		c := New(
+			config.WithDnsClient(testClient.DnsClient),
+			config.WithAddress(testClient.Address),
+			config.WithNsid(nsid),
+		)
+
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		if _, err := c.GetDnsAnswers(ctx, "example.com", dns.TypeA); err != nil {
+			t.Fatalf("nsid %v: unexpected error: %v", nsid, err)
+		}
+
+		want := ""
+		if nsid {
+			want = "ams01"
+		}
+		if dnsContext.Nsid != want {
+			t.Errorf("nsid %v: Nsid = %q, want %q", nsid, dnsContext.Nsid, want)
+		}
+	}
+}
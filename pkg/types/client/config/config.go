@@ -1,25 +1,171 @@
 package config
 
 import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/Motmedel/dns_utils/pkg/cache"
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	"github.com/Motmedel/dns_utils/pkg/hosts"
 	"github.com/miekg/dns"
 )
 
 type Option func(*Config)
 
+// Exchanger sends a message to a server and returns the response. The format
+// of the server address is up to the transport; a response with an
+// unsuccessful rcode is returned together with an *errors.RcodeError.
+//
+// dns_utils.Exchanger exchanges over UDP, TCP and DNS-over-TLS, doh.Exchanger
+// over DNS-over-HTTPS and, in its own module, quic.Exchanger over
+// DNS-over-QUIC.
+type Exchanger interface {
+	Exchange(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error)
+}
+
 const (
 	DefaultAddress = "8.8.8.8:53"
+	DefaultPort    = "53"
 	DefaultUDPSize = 4096
 )
 
 type Config struct {
-	Address   string
+	Address string
+	// Addresses is the ordered list of upstream servers. When set, it takes
+	// precedence over Address; the servers are tried in order, moving on
+	// according to RetryPolicy.
+	Addresses []string
 	DnsClient *dns.Client
+	// Exchanger is the transport used for exchanges. When nil, messages are
+	// exchanged with DnsClient. Identical queries to a server that are in
+	// flight at the same time are sent only once.
+	Exchanger   Exchanger
+	RetryPolicy *RetryPolicy
+	// Cache holds the responses to earlier exchanges. When nil, nothing is
+	// cached. If the servers fail and the cache serves stale responses, an
+	// expired response is returned instead.
+	Cache *cache.Cache
+	// Rotate spreads the exchanges over the servers: each one starts with the
+	// server after the one the previous exchange started with.
+	Rotate bool
+	// Search is the list of domains with which names that do not end with a
+	// dot are expanded. When empty, every name is queried as is.
+	Search []string
+	// Ndots is the number of dots a name must have to be queried as is before
+	// the search list is tried.
+	Ndots int
+	// CaseRandomization randomizes the letter case of the names of queries
+	// sent over UDP with DnsClient, to detect spoofed responses (DNS 0x20).
+	CaseRandomization dns_utils.CaseRandomization
+	// HostsFile answers A, AAAA and PTR queries for the names and addresses it
+	// lists, before going to the network. When nil, it is not consulted.
+	HostsFile *hosts.File
+	// ClientSubnet4 and ClientSubnet6 are sent as the EDNS Client Subnet option
+	// of queries that do not have one already (RFC 7871), as chosen by
+	// dns_utils.ClientSubnetFor.
+	ClientSubnet4 netip.Prefix
+	ClientSubnet6 netip.Prefix
+	// Cookies enables DNS Cookies (RFC 7873): a client cookie is sent to each
+	// server, together with the last server cookie it returned.
+	Cookies bool
+	// Nsid asks the servers to identify themselves in their responses (RFC
+	// 5001), which is recorded in the DNS context.
+	Nsid bool
+	// DnssecValidation makes the client validate the responses it obtains,
+	// from the network or the cache, following the chain of trust from
+	// TrustAnchors, as well as the proof of non-existence of NXDOMAIN
+	// responses, and record the results in the DNS context. A response with
+	// bogus data is not returned, but an *errors.DnssecBogusError.
+	DnssecValidation bool
+	// TrustAnchors are the DS records of the root zone that are trusted. When
+	// empty, the root key-signing keys are.
+	TrustAnchors []*dns.DS
+}
+
+func (c *Config) defaultPort() string {
+	if c.Exchanger != nil {
+		// The address format is the exchanger's business.
+		return ""
+	}
+	if c.DnsClient != nil && isDotNet(c.DnsClient.Net) {
+		return DefaultDotPort
+	}
+	return DefaultPort
+}
+
+// ServerAddresses returns the upstream servers in the order they are to be
+// tried. When messages are exchanged with DnsClient, an address without a port
+// gets the default port of its transport, as does DefaultAddress over
+// DNS-over-TLS.
+func (c *Config) ServerAddresses() []string {
+	if c == nil {
+		return nil
+	}
+
+	addresses := c.Addresses
+	if len(addresses) == 0 {
+		if c.Address == "" {
+			return nil
+		}
+		addresses = []string{c.Address}
+	}
+
+	port := c.defaultPort()
+	if port == "" {
+		return addresses
+	}
+
+	serverAddresses := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if address == DefaultAddress && port == DefaultDotPort {
+			host, _, _ := net.SplitHostPort(DefaultAddress)
+			address = net.JoinHostPort(host, port)
+		} else if _, _, err := net.SplitHostPort(address); err != nil && address != "" {
+			address = net.JoinHostPort(strings.Trim(address, "[]"), port)
+		}
+		serverAddresses = append(serverAddresses, address)
+	}
+
+	return serverAddresses
+}
+
+// SearchNames returns the fully qualified names to query for the domain, in
+// the order they are to be tried, expanding it with the search list the way
+// the glibc resolver does: a name with at least Ndots dots is tried as is
+// first, otherwise last, and a name that ends with a dot only as is.
+func (c *Config) SearchNames(domain string) []string {
+	if c == nil || len(c.Search) == 0 || strings.HasSuffix(domain, ".") {
+		return []string{dns.Fqdn(domain)}
+	}
+
+	var names []string
+	asIs := strings.Count(domain, ".") >= c.Ndots
+	if asIs {
+		names = append(names, dns.Fqdn(domain))
+	}
+
+	for _, searchDomain := range c.Search {
+		searchDomain = strings.Trim(searchDomain, ".")
+		if searchDomain == "" {
+			continue
+		}
+		names = append(names, dns.Fqdn(domain+"."+searchDomain))
+	}
+
+	if !asIs {
+		names = append(names, dns.Fqdn(domain))
+	}
+
+	return names
 }
 
 func New(options ...Option) *Config {
 	config := &Config{
-		Address:   DefaultAddress,
-		DnsClient: &dns.Client{UDPSize: DefaultUDPSize},
+		Address:     DefaultAddress,
+		DnsClient:   &dns.Client{UDPSize: DefaultUDPSize},
+		RetryPolicy: NewRetryPolicy(),
 	}
 
 	for _, option := range options {
@@ -34,6 +180,70 @@ func New(options ...Option) *Config {
 func WithAddress(address string) Option {
 	return func(configuration *Config) {
 		configuration.Address = address
+		configuration.Addresses = nil
+	}
+}
+
+// WithAddresses sets the ordered list of upstream servers. The first server
+// also becomes the Address.
+func WithAddresses(addresses ...string) Option {
+	return func(configuration *Config) {
+		if len(addresses) == 0 {
+			return
+		}
+		configuration.Address = addresses[0]
+		configuration.Addresses = addresses
+	}
+}
+
+func WithCache(responseCache *cache.Cache) Option {
+	return func(configuration *Config) {
+		configuration.Cache = responseCache
+	}
+}
+
+// WithHostsFile consults the hosts file at the path, or /etc/hosts if the path
+// is empty, before going to the network.
+func WithHostsFile(path string) Option {
+	return func(configuration *Config) {
+		configuration.HostsFile = hosts.NewFile(path)
+	}
+}
+
+func WithCaseRandomization(caseRandomization dns_utils.CaseRandomization) Option {
+	return func(configuration *Config) {
+		configuration.CaseRandomization = caseRandomization
+	}
+}
+
+// WithClientSubnet sends the prefixes as the EDNS Client Subnet option, so
+// that servers answer as if for a client in them, for example 198.51.100.0/24
+// and 2001:db8::/56; at most one of each address family, the last one given.
+func WithClientSubnet(prefixes ...netip.Prefix) Option {
+	return func(configuration *Config) {
+		for _, prefix := range prefixes {
+			if prefix.Addr().Is4() {
+				configuration.ClientSubnet4 = prefix
+			} else if prefix.IsValid() {
+				configuration.ClientSubnet6 = prefix
+			}
+		}
+	}
+}
+
+func WithCookies(cookies bool) Option {
+	return func(configuration *Config) {
+		configuration.Cookies = cookies
+	}
+}
+
+// WithDnssecValidation enables DNSSEC validation, from the trust anchors if
+// any are given and from the root key-signing keys otherwise. Responses with
+// bogus data are then rejected.
+func WithDnssecValidation(trustAnchors ...*dns.DS) Option {
+	return func(configuration *Config) {
+		configuration.DnssecValidation = true
+		configuration.TrustAnchors = trustAnchors
 	}
 }
 
@@ -42,3 +252,36 @@ func WithDnsClient(dnsClient *dns.Client) Option {
 		configuration.DnsClient = dnsClient
 	}
 }
+
+func WithExchanger(exchanger Exchanger) Option {
+	return func(configuration *Config) {
+		configuration.Exchanger = exchanger
+	}
+}
+
+func WithNsid(nsid bool) Option {
+	return func(configuration *Config) {
+		configuration.Nsid = nsid
+	}
+}
+
+func WithRotate(rotate bool) Option {
+	return func(configuration *Config) {
+		configuration.Rotate = rotate
+	}
+}
+
+// WithSearch enables the expansion of names with the search list, as with the
+// "search" and "options ndots" lines of resolv.conf.
+func WithSearch(search []string, ndots int) Option {
+	return func(configuration *Config) {
+		configuration.Search = search
+		configuration.Ndots = ndots
+	}
+}
+
+func WithRetryPolicy(retryPolicy *RetryPolicy) Option {
+	return func(configuration *Config) {
+		configuration.RetryPolicy = retryPolicy
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"context"
+	"slices"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -90,3 +92,153 @@ func TestWithDnsClientReplacesTheDefault(t *testing.T) {
 		t.Error("expected the supplied client to be used")
 	}
 }
+
+// exchangerFunc is an Exchanger that calls the function.
+type exchangerFunc func(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error)
+
+func (f exchangerFunc) Exchange(ctx context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error) {
+	return f(ctx, message, serverAddress)
+}
+
+func TestServerAddresses(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		options  []Option
+		expected []string
+	}{
+		{
+			name:     "the default address is the only server",
+			options:  nil,
+			expected: []string{DefaultAddress},
+		},
+		{
+			name:     "the servers are kept in order",
+			options:  []Option{WithAddresses("192.0.2.1:53", "192.0.2.2:53")},
+			expected: []string{"192.0.2.1:53", "192.0.2.2:53"},
+		},
+		{
+			name:     "a later address replaces the servers",
+			options:  []Option{WithAddresses("192.0.2.1:53", "192.0.2.2:53"), WithAddress("192.0.2.3:53")},
+			expected: []string{"192.0.2.3:53"},
+		},
+		{
+			name:     "no servers leaves the defaults",
+			options:  []Option{WithAddresses()},
+			expected: []string{DefaultAddress},
+		},
+		{
+			name:     "a missing port gets the default port",
+			options:  []Option{WithAddresses("192.0.2.1", "2001:db8::1", "[2001:db8::2]")},
+			expected: []string{"192.0.2.1:53", "[2001:db8::1]:53", "[2001:db8::2]:53"},
+		},
+		{
+			name:     "a missing port gets the dns-over-tls port",
+			options:  []Option{WithAddress("192.0.2.1"), WithDnsOverTls(nil)},
+			expected: []string{"192.0.2.1:853"},
+		},
+		{
+			name:     "the default address gets the dns-over-tls port",
+			options:  []Option{WithDnsOverTls(&DotConfig{ServerName: "dns.google"})},
+			expected: []string{"8.8.8.8:853"},
+		},
+		{
+			name:     "an exchanger gets the default address as is",
+			options:  []Option{WithExchanger(exchangerFunc(nil))},
+			expected: []string{DefaultAddress},
+		},
+		{
+			name:     "an explicit port is kept",
+			options:  []Option{WithAddress("192.0.2.1:5353"), WithDnsOverTls(nil)},
+			expected: []string{"192.0.2.1:5353"},
+		},
+		{
+			name:     "an empty address means no servers",
+			options:  []Option{WithAddress("")},
+			expected: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := New(testCase.options...).ServerAddresses()
+			if !slices.Equal(got, testCase.expected) {
+				t.Errorf("expected servers %v, got %v", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestWithAddressesSetsThePrimaryAddress(t *testing.T) {
+	t.Parallel()
+
+	config := New(WithAddresses("192.0.2.1:53", "192.0.2.2:53"))
+
+	if config.Address != "192.0.2.1:53" {
+		t.Errorf("expected address %q, got %q", "192.0.2.1:53", config.Address)
+	}
+}
+
+func TestSearchNames(t *testing.T) {
+	t.Parallel()
+
+	search := []string{"corp.example.com", "example.com."}
+
+	testCases := []struct {
+		name     string
+		options  []Option
+		domain   string
+		expected []string
+	}{
+		{
+			name:     "without a search list the name is queried as is",
+			options:  nil,
+			domain:   "host",
+			expected: []string{"host."},
+		},
+		{
+			name:     "a name with fewer dots than ndots is tried as is last",
+			options:  []Option{WithSearch(search, 1)},
+			domain:   "host",
+			expected: []string{"host.corp.example.com.", "host.example.com.", "host."},
+		},
+		{
+			name:     "a name with at least ndots dots is tried as is first",
+			options:  []Option{WithSearch(search, 1)},
+			domain:   "host.sub",
+			expected: []string{"host.sub.", "host.sub.corp.example.com.", "host.sub.example.com."},
+		},
+		{
+			name:     "ndots is honored",
+			options:  []Option{WithSearch(search, 2)},
+			domain:   "host.sub",
+			expected: []string{"host.sub.corp.example.com.", "host.sub.example.com.", "host.sub."},
+		},
+		{
+			name:     "a name ending with a dot is only queried as is",
+			options:  []Option{WithSearch(search, 1)},
+			domain:   "host.",
+			expected: []string{"host."},
+		},
+		{
+			name:     "the root is skipped",
+			options:  []Option{WithSearch([]string{"."}, 1)},
+			domain:   "host",
+			expected: []string{"host."},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := New(testCase.options...).SearchNames(testCase.domain)
+			if !slices.Equal(got, testCase.expected) {
+				t.Errorf("expected names %v, got %v", testCase.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"slices"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+const (
+	DefaultDotPort = "853"
+	DotNet         = "tcp-tls"
+)
+
+// DotConfig describes a DNS-over-TLS (RFC 7858) upstream.
+type DotConfig struct {
+	// ServerName is the name sent in the SNI extension and verified against
+	// the server certificate. When empty, the host of the server address is
+	// used.
+	ServerName string
+	// RootCAs replaces the system roots when verifying the server certificate.
+	RootCAs *x509.CertPool
+	// SpkiPins are base64-encoded SHA-256 digests of a SubjectPublicKeyInfo
+	// (RFC 7858 section 4.2). When set, one of the certificates presented by
+	// the server must match one of them, in addition to the usual
+	// verification.
+	SpkiPins []string
+	// Certificates are presented to servers that request client
+	// authentication.
+	Certificates []tls.Certificate
+}
+
+// SpkiPin returns the pin of the certificate's SubjectPublicKeyInfo in the
+// form expected by DotConfig.SpkiPins.
+func SpkiPin(certificate *x509.Certificate) string {
+	if certificate == nil {
+		return ""
+	}
+
+	digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func (d *DotConfig) verifySpkiPins(connectionState tls.ConnectionState) error {
+	for _, certificate := range connectionState.PeerCertificates {
+		if slices.Contains(d.SpkiPins, SpkiPin(certificate)) {
+			return nil
+		}
+	}
+
+	var serverPin string
+	if len(connectionState.PeerCertificates) != 0 {
+		serverPin = SpkiPin(connectionState.PeerCertificates[0])
+	}
+
+	return fmt.Errorf("%w (%s)", dnsUtilsErrors.ErrSpkiPinMismatch, serverPin)
+}
+
+// TlsConfig returns the TLS configuration for connecting to the upstream.
+func (d *DotConfig) TlsConfig() *tls.Config {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if d == nil {
+		return tlsConfig
+	}
+
+	tlsConfig.ServerName = d.ServerName
+	tlsConfig.RootCAs = d.RootCAs
+	tlsConfig.Certificates = d.Certificates
+
+	if len(d.SpkiPins) != 0 {
+		tlsConfig.VerifyConnection = d.verifySpkiPins
+	}
+
+	return tlsConfig
+}
+
+func isDotNet(network string) bool {
+	return network == DotNet || network == "tcp4-tls" || network == "tcp6-tls"
+}
+
+// WithDnsOverTls makes the client exchange messages over TLS. The settings of
+// the current DNS client, such as its timeouts, are kept.
+func WithDnsOverTls(dotConfig *DotConfig) Option {
+	return func(configuration *Config) {
+		dnsClient := &dns.Client{}
+		if configuration.DnsClient != nil {
+			dnsClientCopy := *configuration.DnsClient
+			dnsClient = &dnsClientCopy
+		}
+
+		dnsClient.Net = DotNet
+		dnsClient.TLSConfig = dotConfig.TlsConfig()
+
+		configuration.DnsClient = dnsClient
+	}
+}
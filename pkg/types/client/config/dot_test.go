@@ -0,0 +1,150 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+func makeCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dns.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return certificate
+}
+
+func TestSpkiPin(t *testing.T) {
+	t.Parallel()
+
+	certificate := makeCertificate(t)
+	digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	if got, want := SpkiPin(certificate), base64.StdEncoding.EncodeToString(digest[:]); got != want {
+		t.Errorf("expected pin %q, got %q", want, got)
+	}
+
+	if got := SpkiPin(nil); got != "" {
+		t.Errorf("expected no pin for a nil certificate, got %q", got)
+	}
+}
+
+func TestDotConfigTlsConfig(t *testing.T) {
+	t.Parallel()
+
+	rootCAs := x509.NewCertPool()
+	certificates := []tls.Certificate{{}}
+
+	tlsConfig := (&DotConfig{
+		ServerName:   "dns.example",
+		RootCAs:      rootCAs,
+		Certificates: certificates,
+	}).TlsConfig()
+
+	if tlsConfig.ServerName != "dns.example" {
+		t.Errorf("expected server name %q, got %q", "dns.example", tlsConfig.ServerName)
+	}
+	if tlsConfig.RootCAs != rootCAs {
+		t.Error("expected the supplied roots to be used")
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Errorf("expected one client certificate, got %d", len(tlsConfig.Certificates))
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 as the minimum version, got %x", tlsConfig.MinVersion)
+	}
+	if tlsConfig.VerifyConnection != nil {
+		t.Error("expected no connection verification without pins")
+	}
+
+	if (*DotConfig)(nil).TlsConfig() == nil {
+		t.Error("expected a configuration for a nil dns-over-tls configuration")
+	}
+}
+
+func TestDotConfigSpkiPinVerification(t *testing.T) {
+	t.Parallel()
+
+	certificate := makeCertificate(t)
+	otherCertificate := makeCertificate(t)
+
+	testCases := []struct {
+		name      string
+		pins      []string
+		expectErr bool
+	}{
+		{name: "a matching pin is accepted", pins: []string{"other", SpkiPin(certificate)}},
+		{name: "no matching pin is rejected", pins: []string{SpkiPin(otherCertificate)}, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			tlsConfig := (&DotConfig{SpkiPins: testCase.pins}).TlsConfig()
+			if tlsConfig.VerifyConnection == nil {
+				t.Fatal("expected connection verification with pins")
+			}
+
+			err := tlsConfig.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}})
+			if testCase.expectErr {
+				if !errors.Is(err, dnsUtilsErrors.ErrSpkiPinMismatch) {
+					t.Errorf("expected a pin mismatch, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDnsOverTlsKeepsTheClientSettings(t *testing.T) {
+	t.Parallel()
+
+	config := New(
+		WithDnsClient(&dns.Client{UDPSize: 1232, Timeout: 3 * time.Second}),
+		WithDnsOverTls(&DotConfig{ServerName: "dns.example"}),
+	)
+
+	if config.DnsClient.Net != DotNet {
+		t.Errorf("expected network %q, got %q", DotNet, config.DnsClient.Net)
+	}
+	if config.DnsClient.TLSConfig == nil || config.DnsClient.TLSConfig.ServerName != "dns.example" {
+		t.Error("expected the tls configuration to be set")
+	}
+	if config.DnsClient.Timeout != 3*time.Second {
+		t.Errorf("expected the timeout to be kept, got %v", config.DnsClient.Timeout)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+const DefaultAttempts = 1
+
+// RetryPolicy decides how often a server is tried and which failures move the
+// exchange on to the next server.
+type RetryPolicy struct {
+	// Attempts is the number of attempts made against each server before moving
+	// on to the next one. Values below one are treated as one.
+	Attempts int
+	// Rounds is the number of times the whole list of servers is gone
+	// through. Values below one are treated as one.
+	Rounds int
+	// Backoff is the wait before the second attempt against a server; it
+	// doubles for every further attempt.
+	Backoff time.Duration
+	// MaxBackoff caps the wait between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Rcodes lists the response codes that are treated as a failure of the
+	// server rather than an answer.
+	Rcodes []int
+	// Timeouts makes timed out exchanges retryable.
+	Timeouts bool
+	// NetworkErrors makes other network errors, such as a refused connection,
+	// retryable.
+	NetworkErrors bool
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Attempts:      DefaultAttempts,
+		Rcodes:        []int{dns.RcodeServerFailure, dns.RcodeRefused},
+		Timeouts:      true,
+		NetworkErrors: true,
+	}
+}
+
+// NumAttempts returns the number of attempts to make against each server.
+func (p *RetryPolicy) NumAttempts() int {
+	if p == nil || p.Attempts < 1 {
+		return 1
+	}
+	return p.Attempts
+}
+
+// NumRounds returns the number of times to go through the list of servers.
+func (p *RetryPolicy) NumRounds() int {
+	if p == nil || p.Rounds < 1 {
+		return 1
+	}
+	return p.Rounds
+}
+
+// BackoffDuration returns the wait before the attempt with the supplied
+// index, where the first attempt has index zero.
+func (p *RetryPolicy) BackoffDuration(attempt int) time.Duration {
+	if p == nil || attempt <= 0 || p.Backoff <= 0 {
+		return 0
+	}
+
+	backoff := p.Backoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			break
+		}
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	return backoff
+}
+
+// Retryable reports whether the error is one the policy retries, either
+// against the same server or the next.
+func (p *RetryPolicy) Retryable(err error) bool {
+	if p == nil || err == nil {
+		return false
+	}
+
+	if rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err); ok {
+		return slices.Contains(p.Rcodes, rcodeError.Rcode)
+	}
+
+	if netError, ok := errors.AsType[net.Error](err); ok && netError.Timeout() {
+		return p.Timeouts
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return p.Timeouts
+	}
+
+	if _, ok := errors.AsType[*net.OpError](err); ok {
+		return p.NetworkErrors
+	}
+
+	return false
+}
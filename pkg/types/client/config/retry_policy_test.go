@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+func TestRetryPolicyNumAttempts(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		policy   *RetryPolicy
+		expected int
+	}{
+		{name: "a nil policy makes one attempt", policy: nil, expected: 1},
+		{name: "zero attempts is one attempt", policy: &RetryPolicy{}, expected: 1},
+		{name: "the attempts are honoured", policy: &RetryPolicy{Attempts: 3}, expected: 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := testCase.policy.NumAttempts(); got != testCase.expected {
+				t.Errorf("expected %d attempts, got %d", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffDuration(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	testCases := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 0, expected: 0},
+		{attempt: 1, expected: 100 * time.Millisecond},
+		{attempt: 2, expected: 200 * time.Millisecond},
+		{attempt: 3, expected: 300 * time.Millisecond},
+		{attempt: 40, expected: 300 * time.Millisecond},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("attempt %d", testCase.attempt), func(t *testing.T) {
+			t.Parallel()
+
+			if got := policy.BackoffDuration(testCase.attempt); got != testCase.expected {
+				t.Errorf("expected a backoff of %v, got %v", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	t.Parallel()
+
+	timeoutError := &net.OpError{Op: "read", Net: "udp", Err: os.ErrDeadlineExceeded}
+	refusedError := &net.OpError{Op: "read", Net: "udp", Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		name     string
+		policy   *RetryPolicy
+		err      error
+		expected bool
+	}{
+		{
+			name:     "servfail is retried by default",
+			policy:   NewRetryPolicy(),
+			err:      fmt.Errorf("exchange: %w", &dnsUtilsErrors.RcodeError{Rcode: dns.RcodeServerFailure}),
+			expected: true,
+		},
+		{
+			name:     "refused is retried by default",
+			policy:   NewRetryPolicy(),
+			err:      &dnsUtilsErrors.RcodeError{Rcode: dns.RcodeRefused},
+			expected: true,
+		},
+		{
+			name:     "nxdomain is an answer",
+			policy:   NewRetryPolicy(),
+			err:      &dnsUtilsErrors.RcodeError{Rcode: dns.RcodeNameError},
+			expected: false,
+		},
+		{
+			name:     "a timeout is retried by default",
+			policy:   NewRetryPolicy(),
+			err:      fmt.Errorf("exchange: %w", timeoutError),
+			expected: true,
+		},
+		{
+			name:     "timeouts can be excluded",
+			policy:   &RetryPolicy{NetworkErrors: true},
+			err:      timeoutError,
+			expected: false,
+		},
+		{
+			name:     "a network error is retried by default",
+			policy:   NewRetryPolicy(),
+			err:      refusedError,
+			expected: true,
+		},
+		{
+			name:     "network errors can be excluded",
+			policy:   &RetryPolicy{Timeouts: true},
+			err:      refusedError,
+			expected: false,
+		},
+		{
+			name:     "a cancelled context is not retried",
+			policy:   NewRetryPolicy(),
+			err:      context.Canceled,
+			expected: false,
+		},
+		{
+			name:     "a nil policy retries nothing",
+			policy:   nil,
+			err:      &dnsUtilsErrors.RcodeError{Rcode: dns.RcodeServerFailure},
+			expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := testCase.policy.Retryable(testCase.err); got != testCase.expected {
+				t.Errorf("expected retryable %t, got %t", testCase.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	"github.com/miekg/dns"
+)
+
+// serverCookies are the cookies of the exchanges with a server.
+type serverCookies struct {
+	client []byte
+	server []byte
+}
+
+// cookieJar holds the DNS Cookies of each server (RFC 7873): a random client
+// cookie, and the last server cookie the server returned. The zero value is
+// ready to use.
+type cookieJar struct {
+	mutex   sync.Mutex
+	cookies map[string]*serverCookies
+}
+
+// apply returns a copy of the message with the cookies of the server.
+func (j *cookieJar) apply(message *dns.Msg, address string) (*dns.Msg, *dnsUtilsTypes.DnsCookie) {
+	j.mutex.Lock()
+	if j.cookies == nil {
+		j.cookies = make(map[string]*serverCookies)
+	}
+	cookies, ok := j.cookies[address]
+	if !ok {
+		clientCookie := make([]byte, dns_utils.ClientCookieLength)
+		_, _ = rand.Read(clientCookie)
+		cookies = &serverCookies{client: clientCookie}
+		j.cookies[address] = cookies
+	}
+	clientCookie, serverCookie := cookies.client, cookies.server
+	j.mutex.Unlock()
+
+	query := message.Copy()
+	dns_utils.SetCookie(query, clientCookie, serverCookie)
+
+	return query, &dnsUtilsTypes.DnsCookie{
+		Client: hex.EncodeToString(clientCookie),
+		Server: hex.EncodeToString(serverCookie),
+	}
+}
+
+// update stores the server cookie of the response, if it echoes the client
+// cookie of the server; one that does not is ignored (RFC 7873 section 5.3).
+// It reports whether the response is a BADCOOKIE with which the query can be
+// retried.
+func (j *cookieJar) update(address string, cookie *dnsUtilsTypes.DnsCookie, response *dns.Msg) bool {
+	clientCookie, serverCookie, ok := dns_utils.GetCookie(response)
+	if !ok || len(serverCookie) == 0 {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	cookies, ok := j.cookies[address]
+	if !ok || !bytes.Equal(cookies.client, clientCookie) {
+		return false
+	}
+	cookies.server = bytes.Clone(serverCookie)
+	cookie.ResponseServer = hex.EncodeToString(serverCookie)
+
+	return response.Rcode == dns.RcodeBadCookie
+}
+
+// cookieExchange exchanges the message with the server by way of the flight
+// group, with the cookies of the server if cookies are enabled and the message
+// does not have its own. A BADCOOKIE response is retried once, with the server
+// cookie it returned.
+func (c *Client) cookieExchange(
+	ctx context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	exchanger config.Exchanger,
+	message *dns.Msg,
+	address string,
+) (*dns.Msg, error) {
+	if c == nil || c.Config == nil || !c.Cookies {
+		return c.flights.exchange(ctx, dnsContext, exchanger, message, address)
+	}
+	if _, _, ok := dns_utils.GetCookie(message); ok {
+		return c.flights.exchange(ctx, dnsContext, exchanger, message, address)
+	}
+
+	for retried := false; ; retried = true {
+		query, cookie := c.cookies.apply(message, address)
+		cookie.Retried = retried
+		dnsContext.Cookie = cookie
+
+		responseMessage, err := c.flights.exchange(ctx, dnsContext, exchanger, query, address)
+		if !c.cookies.update(address, cookie, responseMessage) || retried {
+			return responseMessage, err
+		}
+	}
+}
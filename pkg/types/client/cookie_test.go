@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	"github.com/miekg/dns"
+)
+
+// cookieHandler answers queries that have the server cookie and returns
+// BADCOOKIE, with the server cookie, to those that do not. It records the
+// cookies of the queries.
+func cookieHandler(serverCookie []byte, queries *[][]byte, mutex *sync.Mutex) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		clientCookie, gotServerCookie, ok := dns_utils.GetCookie(r)
+
+		mutex.Lock()
+		*queries = append(*queries, gotServerCookie)
+		mutex.Unlock()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		if ok {
+			dns_utils.SetCookie(m, clientCookie, serverCookie)
+		}
+
+		if !bytes.Equal(gotServerCookie, serverCookie) {
+			m.Rcode = dns.RcodeBadCookie
+		} else {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"hello"},
+			})
+		}
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestCookies_RetryAfterBadCookie(t *testing.T) {
+	t.Parallel()
+
+	serverCookie := bytes.Repeat([]byte{0xab}, 16)
+
+	var queries [][]byte
+	var mutex sync.Mutex
+	testClient, teardown := startTestDnsServer(t, cookieHandler(serverCookie, &queries, &mutex))
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithCookies(true),
+	)
+
+	var clientCookies []string
+	for i, wantRetried := range []bool{true, false} {
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		if _, err := c.GetDnsAnswers(ctx, "example.com", dns.TypeTXT); err != nil {
+			t.Fatalf("query %d: unexpected error: %v", i, err)
+		}
+
+		cookie := dnsContext.Cookie
+		if cookie == nil {
+			t.Fatalf("query %d: DnsContext.Cookie = nil", i)
+		}
+		if cookie.Retried != wantRetried {
+			t.Errorf("query %d: Retried = %v, want %v", i, cookie.Retried, wantRetried)
+		}
+		if cookie.Server != hex.EncodeToString(serverCookie) {
+			t.Errorf("query %d: Server = %q, want the server cookie", i, cookie.Server)
+		}
+		if cookie.ResponseServer != hex.EncodeToString(serverCookie) {
+			t.Errorf("query %d: ResponseServer = %q, want the server cookie", i, cookie.ResponseServer)
+		}
+		clientCookies = append(clientCookies, cookie.Client)
+	}
+
+	if clientCookies[0] != clientCookies[1] || len(clientCookies[0]) != 2*dns_utils.ClientCookieLength {
+		t.Errorf("client cookies = %v, want the same one twice", clientCookies)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// The first query has no server cookie; the retry and the next query do.
+	if len(queries) != 3 || len(queries[0]) != 0 {
+		t.Errorf("server cookies of the queries = %x, want none, then the server cookie twice", queries)
+	}
+}
+
+func TestCookies_RetriedOnlyOnce(t *testing.T) {
+	t.Parallel()
+
+	var queries [][]byte
+	var mutex sync.Mutex
+	// No server cookie that the client is given is ever accepted.
+	handler := cookieHandler(bytes.Repeat([]byte{0xab}, 16), &queries, &mutex)
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if clientCookie, _, ok := dns_utils.GetCookie(r); ok {
+			dns_utils.SetCookie(r, clientCookie, nil)
+		}
+		handler(w, r)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithCookies(true),
+	)
+
+	_, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT)
+	rcodeError, ok := errors.AsType[*dnsUtilsErrors.RcodeError](err)
+	if !ok || rcodeError.Rcode != dns.RcodeBadCookie {
+		t.Errorf("err = %v, want a BADCOOKIE RcodeError", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(queries) != 2 {
+		t.Errorf("queries = %d, want 2", len(queries))
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	"github.com/Motmedel/dns_utils/pkg/dnssec"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/miekg/dns"
+)
+
+// validatorExchanger makes the queries of the DNSSEC validator and reports,
+// which are not validated themselves and do not touch the DNS context of the
+// caller.
+type validatorExchanger struct {
+	client *Client
+}
+
+func (e validatorExchanger) Exchange(ctx context.Context, message *dns.Msg) (*dns.Msg, error) {
+	return e.client.lookup(ctx, &dnsUtilsTypes.DnsContext{}, message)
+}
+
+func (c *Client) validatesDnssec() bool {
+	return c != nil && c.Config != nil && c.DnssecValidation
+}
+
+// Validator returns the DNSSEC validator of the client, which fetches the
+// records of the chain of trust with the client, starting from the configured
+// trust anchors.
+func (c *Client) Validator() *dnssec.Validator {
+	if c == nil {
+		return nil
+	}
+
+	c.validatorOnce.Do(func() {
+		var trustAnchors []*dns.DS
+		if c.Config != nil {
+			trustAnchors = c.TrustAnchors
+		}
+		c.validator = dnssec.New(validatorExchanger{client: c}, dnssec.WithTrustAnchors(trustAnchors...))
+	})
+
+	return c.validator
+}
+
+// ValidateDnssec returns the DNSSEC status of each RRset in the answer and
+// authority sections of the response, which should have been obtained with
+// the DO bit set.
+func (c *Client) ValidateDnssec(ctx context.Context, message *dns.Msg) []*dnsUtilsDnssecTypes.Result {
+	return c.Validator().ValidateMessage(ctx, message)
+}
+
+// GetDnssecReport reports how the zone of the domain is signed: its DNSKEYs,
+// the DS records at the parent and whether they match, the validity periods of
+// the signatures and how non-existence is proven, with warnings about
+// deprecated algorithms and signatures that expire soon.
+func (c *Client) GetDnssecReport(ctx context.Context, domain string) (*dnssec.Report, error) {
+	if domain == "" {
+		return nil, nil
+	}
+
+	report, err := dnssec.GetReport(ctx, validatorExchanger{client: c}, domain)
+	if err != nil {
+		return nil, fmt.Errorf("get report: %w", err)
+	}
+
+	return report, nil
+}
+
+// GetDnssecSignatures returns the signatures over the RRsets of the domain with
+// the types.
+func (c *Client) GetDnssecSignatures(
+	ctx context.Context,
+	domain string,
+	recordTypes ...uint16,
+) ([]*dnssec.Signature, error) {
+	if domain == "" {
+		return nil, nil
+	}
+
+	signatures, err := dnssec.GetSignatures(ctx, validatorExchanger{client: c}, domain, recordTypes...)
+	if err != nil {
+		return nil, fmt.Errorf("get signatures: %w", err)
+	}
+
+	return signatures, nil
+}
+
+// CheckDsMaintenance checks the automated maintenance of the DS records of the
+// domain with CDS and CDNSKEY records, per
+// dns_utils.CheckDsMaintenanceWithServers. The records and the addresses of
+// the name servers are looked up with the client, and the name servers are
+// then asked with its transport, on port 53.
+func (c *Client) CheckDsMaintenance(ctx context.Context, domain string) (*dns_utils.DsMaintenance, error) {
+	if domain == "" {
+		return nil, nil
+	}
+
+	maintenance, err := dns_utils.CheckDsMaintenanceWithLookup(ctx, domain, c)
+	if err != nil {
+		return nil, fmt.Errorf("check ds maintenance with lookup: %w", err)
+	}
+
+	return maintenance, nil
+}
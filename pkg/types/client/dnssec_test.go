@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
+	"github.com/miekg/dns"
+)
+
+// signedZone is a zone signed with a single key.
+type signedZone struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newSignedZone(t *testing.T, name string) *signedZone {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	privateKey, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	return &signedZone{key: key, signer: privateKey.(crypto.Signer)}
+}
+
+// sign returns the RRset followed by its signature.
+func (z *signedZone) sign(t *testing.T, set ...dns.RR) []dns.RR {
+	t.Helper()
+
+	header := set[0].Header()
+	signature := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: header.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: header.Ttl},
+		TypeCovered: header.Rrtype,
+		Algorithm:   z.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(header.Name)),
+		OrigTtl:     header.Ttl,
+		Expiration:  uint32(time.Now().Add(time.Hour).Unix()),
+		Inception:   uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag:      z.key.KeyTag(),
+		SignerName:  z.key.Hdr.Name,
+	}
+	if err := signature.Sign(z.signer, set); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	return append(set, signature)
+}
+
+func TestDnssecValidation_RecordsTheStatus(t *testing.T) {
+	t.Parallel()
+
+	root := newSignedZone(t, ".")
+	example := newSignedZone(t, "example.")
+
+	answers := map[string][]dns.RR{
+		". DNSKEY":        root.sign(t, root.key),
+		"example. DS":     root.sign(t, example.key.ToDS(dns.SHA256)),
+		"example. DNSKEY": example.sign(t, example.key),
+		"example. A": example.sign(t, &dns.A{
+			Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("192.0.2.1"),
+		}),
+	}
+
+	var sawDoAndCd atomic.Bool
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		question := r.Question[0]
+		if question.Qtype == dns.TypeA {
+			opt := r.IsEdns0()
+			sawDoAndCd.Store(opt != nil && opt.Do() && r.CheckingDisabled)
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = answers[strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype]]
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithDnssecValidation(root.key.ToDS(dns.SHA256)),
+	)
+
+	dnsContext := &dnsUtilsTypes.DnsContext{}
+	ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	if _, err := c.GetDnsAnswers(ctx, "example", dns.TypeA); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !sawDoAndCd.Load() {
+		t.Error("the query did not have the DO and CD bits set")
+	}
+	if len(dnsContext.Dnssec) != 1 {
+		t.Fatalf("len(Dnssec) = %d, want 1", len(dnsContext.Dnssec))
+	}
+	if result := dnsContext.Dnssec[0]; result.Status != dnsUtilsDnssecTypes.StatusSecure || result.Type != dns.TypeA {
+		t.Errorf("Dnssec[0] = %+v, want a secure A RRset", result)
+	}
+	if dnsContext.QuestionMessage.Question[0].Qtype != dns.TypeA {
+		t.Errorf("the DNS context records the question %v, want the A query", dnsContext.QuestionMessage.Question[0])
+	}
+}
+
+func TestDnssecValidation_RejectsBogusData(t *testing.T) {
+	t.Parallel()
+
+	root := newSignedZone(t, ".")
+	example := newSignedZone(t, "example.")
+	impostor := newSignedZone(t, "example.")
+
+	answers := map[string][]dns.RR{
+		". DNSKEY":        root.sign(t, root.key),
+		"example. DS":     root.sign(t, example.key.ToDS(dns.SHA256)),
+		"example. DNSKEY": example.sign(t, example.key),
+		// Signed with a key that the DS records do not vouch for.
+		"example. A": impostor.sign(t, &dns.A{
+			Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("192.0.2.1"),
+		}),
+	}
+
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		question := r.Question[0]
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = answers[strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype]]
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithDnssecValidation(root.key.ToDS(dns.SHA256)),
+	)
+
+	dnsContext := &dnsUtilsTypes.DnsContext{}
+	ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+	message := new(dns.Msg)
+	message.SetQuestion("example.", dns.TypeA)
+
+	response, err := c.Exchange(ctx, message)
+	if !errors.Is(err, dnsUtilsErrors.ErrDnssecBogus) {
+		t.Fatalf("err = %v, want ErrDnssecBogus", err)
+	}
+	if response != nil {
+		t.Error("the bogus response was returned")
+	}
+
+	bogusError, ok := errors.AsType[*dnsUtilsErrors.DnssecBogusError](err)
+	if !ok || bogusError.Result == nil || bogusError.Result.Type != dns.TypeA {
+		t.Errorf("err = %v, want a DnssecBogusError for the A RRset", err)
+	}
+	if len(dnsContext.Dnssec) != 1 || dnsContext.Dnssec[0].Status != dnsUtilsDnssecTypes.StatusBogus {
+		t.Errorf("Dnssec = %+v, want one bogus result", dnsContext.Dnssec)
+	}
+}
+
+func TestDomainExistsWithDenial_IsProven(t *testing.T) {
+	t.Parallel()
+
+	root := newSignedZone(t, ".")
+	example := newSignedZone(t, "example.")
+
+	nsec := func(name string, next string, types ...uint16) *dns.NSEC {
+		return &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: next,
+			TypeBitMap: types,
+		}
+	}
+
+	answers := map[string][]dns.RR{
+		". DNSKEY":        root.sign(t, root.key),
+		"example. DS":     root.sign(t, example.key.ToDS(dns.SHA256)),
+		"example. DNSKEY": example.sign(t, example.key),
+	}
+	proof := example.sign(t, nsec("example.", "www.example.", dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY))
+
+	testClient, teardown := startTestDnsServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		question := r.Question[0]
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if answer, ok := answers[strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype]]; ok {
+			m.Answer = answer
+		} else {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = proof
+		}
+		_ = w.WriteMsg(m)
+	})
+	defer teardown()
+
+	c := New(
+		config.WithDnsClient(testClient.DnsClient),
+		config.WithAddress(testClient.Address),
+		config.WithDnssecValidation(root.key.ToDS(dns.SHA256)),
+	)
+
+	exists, denial, err := c.DomainExistsWithDenial(context.Background(), "nothere.example.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("exists = true, want false")
+	}
+	if denial == nil {
+		t.Fatal("denial = nil")
+	}
+	if !denial.Proven || denial.Status != dnsUtilsDnssecTypes.StatusSecure {
+		t.Errorf("denial = %+v, want a proven, secure denial", denial)
+	}
+}
+
+// recordingExchanger answers with its records of the question name and type,
+// and records the servers that it is asked.
+type recordingExchanger struct {
+	records []dns.RR
+
+	mutex     sync.Mutex
+	addresses []string
+}
+
+func (e *recordingExchanger) Exchange(_ context.Context, message *dns.Msg, serverAddress string) (*dns.Msg, error) {
+	e.mutex.Lock()
+	e.addresses = append(e.addresses, serverAddress)
+	e.mutex.Unlock()
+
+	question := message.Question[0]
+
+	m := new(dns.Msg)
+	m.SetReply(message)
+	for _, record := range e.records {
+		if header := record.Header(); header.Rrtype == question.Qtype && strings.EqualFold(header.Name, question.Name) {
+			m.Answer = append(m.Answer, record)
+		}
+	}
+	return m, nil
+}
+
+func TestCheckDsMaintenance_UsesTheTransportOfTheClient(t *testing.T) {
+	t.Parallel()
+
+	example := newSignedZone(t, "example.")
+	ds := example.key.ToDS(dns.SHA256)
+	cds := ds.ToCDS()
+
+	exchanger := &recordingExchanger{
+		records: []dns.RR{
+			&dns.NS{
+				Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1.example.",
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{Name: "ns1.example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP("192.0.2.53"),
+			},
+			ds,
+			example.key,
+			cds,
+		},
+	}
+
+	c := New(config.WithExchanger(exchanger), config.WithAddress("192.0.2.1:53"))
+
+	maintenance, err := c.CheckDsMaintenance(context.Background(), "example.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(maintenance.Servers) != 1 || maintenance.Servers[0].Address != "192.0.2.53:53" {
+		t.Fatalf("Servers = %+v, want the name server of example.", maintenance.Servers)
+	}
+	if len(maintenance.Ds) != 1 || len(maintenance.Dnskeys) != 1 || len(maintenance.Cds) != 1 {
+		t.Errorf("maintenance = %+v, want the DS, DNSKEY and CDS records", maintenance)
+	}
+	if !maintenance.Consistent || maintenance.Rollover || len(maintenance.Problems) != 0 {
+		t.Errorf("maintenance = %+v, want consistent records without a rollover", maintenance)
+	}
+
+	// The resolver and the name server are both asked with the exchanger.
+	exchanger.mutex.Lock()
+	defer exchanger.mutex.Unlock()
+	if !slices.Contains(exchanger.addresses, "192.0.2.1:53") || !slices.Contains(exchanger.addresses, "192.0.2.53:53") {
+		t.Errorf("addresses = %v, want the resolver and the name server", exchanger.addresses)
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Motmedel/dns_utils/pkg/doh"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	"github.com/miekg/dns"
+)
+
+// dohResponseWriter collects the message a dns.Handler writes.
+type dohResponseWriter struct {
+	dns.ResponseWriter
+	message *dns.Msg
+}
+
+func (w *dohResponseWriter) WriteMsg(message *dns.Msg) error {
+	w.message = message
+	return nil
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return &net.TCPAddr{} }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+
+// startTestDohServer starts a local DoH endpoint that dispatches POSTed
+// queries to the supplied handler. It returns a client using the endpoint.
+func startTestDohServer(t *testing.T, handler dns.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var request dns.Msg
+		if err := request.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		responseWriter := &dohResponseWriter{}
+		handler(responseWriter, &request)
+
+		responseBytes, err := responseWriter.message.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", doh.MediaType)
+		_, _ = w.Write(responseBytes)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(
+		config.WithAddress(server.URL+"/dns-query"),
+		config.WithExchanger(&doh.Exchanger{HttpClient: server.Client()}),
+	)
+}
+
+func TestDnsOverHttps(t *testing.T) {
+	t.Parallel()
+
+	t.Run("txt records", func(t *testing.T) {
+		t.Parallel()
+
+		c := startTestDohServer(t, spfTxtHandler(map[string][]string{
+			"example.com.": {"v=spf1 -all"},
+		}))
+
+		got, err := c.GetSpfRecordString(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != "v=spf1 -all" {
+			t.Errorf("got = %q, want %q", got, "v=spf1 -all")
+		}
+	})
+
+	t.Run("nxdomain", func(t *testing.T) {
+		t.Parallel()
+
+		c := startTestDohServer(t, nxdomainHandler())
+
+		exists, err := c.DomainExists(context.Background(), "missing.example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if exists {
+			t.Error("exists = true, want false")
+		}
+	})
+
+	t.Run("the url is not given a port", func(t *testing.T) {
+		t.Parallel()
+
+		c := New(
+			config.WithAddress("https://dns.example/dns-query"),
+			config.WithExchanger(&doh.Exchanger{}),
+		)
+
+		if got := c.ServerAddresses(); len(got) != 1 || got[0] != "https://dns.example/dns-query" {
+			t.Errorf("ServerAddresses() = %v, want the url", got)
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsErrors "github.com/Motmedel/dns_utils/pkg/errors"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	"github.com/miekg/dns"
+)
+
+// makeTestCertificate creates a self-signed certificate for dns.example and
+// 127.0.0.1, usable both as a server and a client certificate.
+func makeTestCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dns.example"},
+		DNSNames:              []string{"dns.example"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}, certificate
+}
+
+// startTestDotServer starts a local DNS-over-TLS server that dispatches
+// queries to the supplied handler and returns its address.
+func startTestDotServer(t *testing.T, handler dns.HandlerFunc, tlsConfig *tls.Config) string {
+	t.Helper()
+
+	var listenConfig net.ListenConfig
+	listener, err := listenConfig.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	server := &dns.Server{
+		Net:      "tcp-tls",
+		Listener: tls.NewListener(listener, tlsConfig),
+		Handler:  handler,
+	}
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.ActivateAndServe() }()
+
+	select {
+	case <-started:
+	case err := <-errCh:
+		t.Fatalf("server start: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("dns server did not start in time")
+	}
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+		<-errCh
+	})
+
+	return listener.Addr().String()
+}
+
+func TestDnsOverTls(t *testing.T) {
+	t.Parallel()
+
+	serverCertificate, serverLeaf := makeTestCertificate(t)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(serverLeaf)
+
+	address := startTestDotServer(
+		t,
+		txtHandler([][]string{{"hello"}}),
+		&tls.Config{Certificates: []tls.Certificate{serverCertificate}},
+	)
+
+	t.Run("answers over tls", func(t *testing.T) {
+		t.Parallel()
+
+		c := New(
+			config.WithAddress(address),
+			config.WithDnsOverTls(&config.DotConfig{ServerName: "dns.example", RootCAs: rootCAs}),
+		)
+
+		dnsContext := &dnsUtilsTypes.DnsContext{}
+		ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContext)
+
+		got, err := c.GetDnsAnswerStrings(ctx, "example.com", dns.TypeTXT)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(got, []string{"hello"}) {
+			t.Errorf("got = %v, want [hello]", got)
+		}
+		if dnsContext.Transport != "tcp" {
+			t.Errorf("DnsContext.Transport = %q, want tcp", dnsContext.Transport)
+		}
+		if dnsContext.TlsContext == nil || dnsContext.TlsContext.ConnectionState == nil {
+			t.Fatal("DnsContext.TlsContext = nil, want the connection state")
+		}
+		if serverName := dnsContext.TlsContext.ConnectionState.ServerName; serverName != "dns.example" {
+			t.Errorf("ServerName = %q, want dns.example", serverName)
+		}
+	})
+
+	t.Run("a matching pin is accepted", func(t *testing.T) {
+		t.Parallel()
+
+		c := New(
+			config.WithAddress(address),
+			config.WithDnsOverTls(&config.DotConfig{
+				ServerName: "dns.example",
+				RootCAs:    rootCAs,
+				SpkiPins:   []string{config.SpkiPin(serverLeaf)},
+			}),
+		)
+
+		if _, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("a mismatching pin is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		_, otherLeaf := makeTestCertificate(t)
+
+		c := New(
+			config.WithAddress(address),
+			config.WithDnsOverTls(&config.DotConfig{
+				ServerName: "dns.example",
+				RootCAs:    rootCAs,
+				SpkiPins:   []string{config.SpkiPin(otherLeaf)},
+			}),
+		)
+
+		_, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT)
+		if !errors.Is(err, dnsUtilsErrors.ErrSpkiPinMismatch) {
+			t.Errorf("err = %v, want ErrSpkiPinMismatch", err)
+		}
+	})
+
+	t.Run("an unknown root is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		c := New(
+			config.WithAddress(address),
+			config.WithDnsOverTls(&config.DotConfig{ServerName: "dns.example", RootCAs: x509.NewCertPool()}),
+		)
+
+		if _, err := c.GetDnsAnswers(context.Background(), "example.com", dns.TypeTXT); err == nil {
+			t.Fatal("expected an error for an untrusted server")
+		}
+	})
+}
+
+func TestDnsOverTls_ClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	serverCertificate, serverLeaf := makeTestCertificate(t)
+	clientCertificate, clientLeaf := makeTestCertificate(t)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(serverLeaf)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientLeaf)
+
+	address := startTestDotServer(
+		t,
+		txtHandler([][]string{{"hello"}}),
+		&tls.Config{
+			Certificates: []tls.Certificate{serverCertificate},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		},
+	)
+
+	c := New(
+		config.WithAddress(address),
+		config.WithDnsOverTls(&config.DotConfig{
+			ServerName:   "dns.example",
+			RootCAs:      rootCAs,
+			Certificates: []tls.Certificate{clientCertificate},
+		}),
+	)
+
+	got, err := c.GetDnsAnswerStrings(context.Background(), "example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"hello"}) {
+		t.Errorf("got = %v, want [hello]", got)
+	}
+}
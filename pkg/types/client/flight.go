@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/Motmedel/dns_utils/pkg/types/client/config"
+	altshiftErrors "github.com/altshiftab/utils_go/pkg/errors"
+	"github.com/miekg/dns"
+)
+
+// flightKey identifies identical queries to a server: the same name, type,
+// class, flags and EDNS(0) options, whatever their IDs.
+type flightKey struct {
+	address string
+	query   string
+}
+
+// flight is an exchange that is in progress, whose result is shared by the
+// callers that wait for it.
+type flight struct {
+	done       chan struct{}
+	cancel     context.CancelFunc
+	waiters    int
+	dnsContext dnsUtilsTypes.DnsContext
+	response   *dns.Msg
+	err        error
+}
+
+// flightGroup coalesces identical concurrent queries, so that one of them goes
+// out at a time. The zero value is ready to use.
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[flightKey]*flight
+}
+
+// exchange sends the message to the server with the exchanger, unless an
+// identical query is already in flight, in which case it waits for the result
+// of that. The exchange is cancelled when every caller waiting for it has
+// given up. Each caller gets its own copy of the response, with the ID of its
+// message, and its DNS context populated as if it had made the exchange.
+func (g *flightGroup) exchange(
+	ctx context.Context,
+	dnsContext *dnsUtilsTypes.DnsContext,
+	exchanger config.Exchanger,
+	message *dns.Msg,
+	address string,
+) (*dns.Msg, error) {
+	if ctx.Err() != nil {
+		return nil, altshiftErrors.NewWithTraceCtx(
+			dnsUtilsContext.WithDnsContextValue(ctx, dnsContext),
+			context.Cause(ctx),
+		)
+	}
+
+	query := message.Copy()
+	query.Id = 0
+	queryBytes, err := query.Pack()
+	if err != nil {
+		// Let the exchanger report the problem.
+		return exchanger.Exchange(dnsUtilsContext.WithDnsContextValue(ctx, dnsContext), message, address)
+	}
+	key := flightKey{address: address, query: string(queryBytes)}
+
+	g.mutex.Lock()
+	if g.flights == nil {
+		g.flights = make(map[flightKey]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+
+		go func() {
+			defer cancel()
+
+			f.dnsContext.QuestionMessage = message
+			f.response, f.err = exchanger.Exchange(
+				dnsUtilsContext.WithDnsContextValue(flightCtx, &f.dnsContext),
+				message,
+				address,
+			)
+
+			g.mutex.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mutex.Unlock()
+
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mutex.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		g.mutex.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// A later caller must not join the cancelled exchange.
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			f.cancel()
+		}
+		g.mutex.Unlock()
+
+		return nil, altshiftErrors.NewWithTraceCtx(
+			dnsUtilsContext.WithDnsContextValue(ctx, dnsContext),
+			context.Cause(ctx),
+		)
+	}
+
+	var response *dns.Msg
+	if f.response != nil {
+		response = f.response.Copy()
+		response.Id = message.Id
+	}
+
+	dnsContext.ClientAddress = f.dnsContext.ClientAddress
+	dnsContext.ServerAddress = f.dnsContext.ServerAddress
+	dnsContext.Transport = f.dnsContext.Transport
+	dnsContext.Time = f.dnsContext.Time
+	dnsContext.TlsContext = f.dnsContext.TlsContext
+	if f.dnsContext.AnswerMessage == f.response {
+		dnsContext.AnswerMessage = response
+	} else if f.dnsContext.AnswerMessage != nil {
+		dnsContext.AnswerMessage = f.dnsContext.AnswerMessage.Copy()
+		dnsContext.AnswerMessage.Id = message.Id
+	}
+
+	return response, f.err
+}
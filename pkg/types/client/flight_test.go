@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dnsUtilsContext "github.com/Motmedel/dns_utils/pkg/context"
+	"github.com/Motmedel/dns_utils/pkg/dns_utils"
+	dnsUtilsTypes "github.com/Motmedel/dns_utils/pkg/types"
+	"github.com/miekg/dns"
+)
+
+// slowHandler answers after a delay, so that queries overlap.
+func slowHandler(delay time.Duration, handler dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(delay)
+		handler(w, r)
+	}
+}
+
+func TestFlights_CoalesceIdenticalQueries(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	c, teardown := startTestDnsServer(
+		t,
+		countingHandler(&count, slowHandler(200*time.Millisecond, txtHandler([][]string{{"hello"}}))),
+	)
+	defer teardown()
+
+	const numCallers = 10
+
+	messages := make([]*dns.Msg, numCallers)
+	dnsContexts := make([]*dnsUtilsTypes.DnsContext, numCallers)
+	responses := make([]*dns.Msg, numCallers)
+	errs := make([]error, numCallers)
+
+	var waitGroup sync.WaitGroup
+	for i := range numCallers {
+		messages[i] = dns_utils.NewQuestionMessage("example.com", dns.TypeTXT, 0)
+		dnsContexts[i] = &dnsUtilsTypes.DnsContext{}
+
+		waitGroup.Go(func() {
+			ctx := dnsUtilsContext.WithDnsContextValue(context.Background(), dnsContexts[i])
+			responses[i], errs[i] = c.Exchange(ctx, messages[i])
+		})
+	}
+	waitGroup.Wait()
+
+	if got := count.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+
+	for i := range numCallers {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: unexpected error: %v", i, errs[i])
+		}
+		if responses[i].Id != messages[i].Id {
+			t.Errorf("caller %d: response ID = %d, want %d", i, responses[i].Id, messages[i].Id)
+		}
+
+		dnsContext := dnsContexts[i]
+		if dnsContext.QuestionMessage != messages[i] {
+			t.Errorf("caller %d: QuestionMessage is not the caller's message", i)
+		}
+		if dnsContext.AnswerMessage != responses[i] {
+			t.Errorf("caller %d: AnswerMessage is not the caller's response", i)
+		}
+		if dnsContext.ServerAddress == "" || dnsContext.Transport == "" || dnsContext.Time == nil {
+			t.Errorf("caller %d: DnsContext not populated: %+v", i, dnsContext)
+		}
+		for j := range i {
+			if responses[i] == responses[j] {
+				t.Errorf("callers %d and %d share a response", i, j)
+			}
+		}
+	}
+}
+
+func TestFlights_DistinctQueriesAreNotCoalesced(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	c, teardown := startTestDnsServer(
+		t,
+		countingHandler(&count, slowHandler(100*time.Millisecond, txtHandler([][]string{{"hello"}}))),
+	)
+	defer teardown()
+
+	withoutRecursion := dns_utils.NewQuestionMessage("example.com", dns.TypeTXT, 0)
+	withoutRecursion.RecursionDesired = false
+
+	messages := []*dns.Msg{
+		dns_utils.NewQuestionMessage("example.com", dns.TypeTXT, 0),
+		dns_utils.NewQuestionMessage("example.org", dns.TypeTXT, 0),
+		dns_utils.NewQuestionMessage("example.com", dns.TypeA, 0),
+		dns_utils.NewDnssecQuestionMessage("example.com", dns.TypeTXT),
+		withoutRecursion,
+	}
+
+	var waitGroup sync.WaitGroup
+	for _, message := range messages {
+		waitGroup.Go(func() {
+			_, _ = c.Exchange(context.Background(), message)
+		})
+	}
+	waitGroup.Wait()
+
+	if got, want := count.Load(), int32(len(messages)); got != want {
+		t.Errorf("queries = %d, want %d", got, want)
+	}
+}
+
+func TestFlights_CallersCancelIndependently(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	c, teardown := startTestDnsServer(
+		t,
+		countingHandler(&count, slowHandler(300*time.Millisecond, txtHandler([][]string{{"hello"}}))),
+	)
+	defer teardown()
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	defer cancelFirst()
+
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.Exchange(first, dns_utils.NewQuestionMessage("example.com", dns.TypeTXT, 0))
+		firstErr <- err
+	}()
+
+	// Let the first caller start the exchange, join it, then cancel the first.
+	time.Sleep(50 * time.Millisecond)
+	secondResult := make(chan error, 1)
+	go func() {
+		_, err := c.Exchange(context.Background(), dns_utils.NewQuestionMessage("example.com", dns.TypeTXT, 0))
+		secondResult <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancelFirst()
+
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller: err = %v, want context.Canceled", err)
+	}
+	if err := <-secondResult; err != nil {
+		t.Errorf("second caller: unexpected error: %v", err)
+	}
+	if got := count.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+}
@@ -0,0 +1,62 @@
+package dnssec
+
+// Status is the DNSSEC status of an RRset (RFC 4035 section 4.3).
+type Status int
+
+const (
+	// StatusIndeterminate means that the chain of trust could not be followed,
+	// for example because a query failed.
+	StatusIndeterminate Status = iota
+	// StatusSecure means that the RRset is signed by a key that chains up to a
+	// trust anchor.
+	StatusSecure
+	// StatusInsecure means that there is a proven absence of DS records above
+	// the RRset, which is therefore not signed.
+	StatusInsecure
+	// StatusBogus means that the RRset should be signed but that its signatures
+	// do not validate, or are missing.
+	StatusBogus
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSecure:
+		return "secure"
+	case StatusInsecure:
+		return "insecure"
+	case StatusBogus:
+		return "bogus"
+	default:
+		return "indeterminate"
+	}
+}
+
+// Result is the DNSSEC status of an RRset, and why it has it.
+type Result struct {
+	Name   string
+	Type   uint16
+	Status Status
+	// Reason tells why the RRset is not secure; it is empty when it is.
+	Reason string
+	// Zone is the zone whose keys signed the RRset when it is secure, and the
+	// insecure delegation when it is insecure.
+	Zone string
+}
+
+// Denial is the outcome of verifying the proof that a name does not exist, in
+// the authority section of an NXDOMAIN response.
+type Denial struct {
+	Name string
+	// Proven is set when the NSEC or NSEC3 records are secure and prove that
+	// neither the name nor a wildcard that would match it exists. Otherwise,
+	// the non-existence is only claimed by the rcode.
+	Proven bool
+	// Status is the DNSSEC status of the proof.
+	Status Status
+	// Reason tells why the non-existence is not proven; it is empty when it is.
+	Reason string
+	// Nsec3 is set when the proof consists of NSEC3 records.
+	Nsec3 bool
+	// ClosestEncloser is the longest existing ancestor of the name.
+	ClosestEncloser string
+}
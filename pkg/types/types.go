@@ -1,6 +1,7 @@
 package types
 
 import (
+	dnsUtilsDnssecTypes "github.com/Motmedel/dns_utils/pkg/types/dnssec"
 	altshiftTlsTypes "github.com/altshiftab/utils_go/pkg/tls/types"
 	"github.com/miekg/dns"
 	"time"
@@ -13,6 +14,21 @@ type ActiveResult struct {
 	MxHosts   []string
 }
 
+// DnsCookie is the DNS Cookie state of an exchange (RFC 7873), with the
+// cookies in hex.
+type DnsCookie struct {
+	// Client is the client cookie that was sent.
+	Client string
+	// Server is the server cookie that was sent; it is empty until the server
+	// has returned one.
+	Server string
+	// ResponseServer is the server cookie of the response, if it echoed the
+	// client cookie.
+	ResponseServer string
+	// Retried is set when the query was sent again after a BADCOOKIE response.
+	Retried bool
+}
+
 type DnsContext struct {
 	QuestionMessage *dns.Msg
 	AnswerMessage   *dns.Msg
@@ -21,4 +37,33 @@ type DnsContext struct {
 	Transport       string
 	Time            *time.Time
 	TlsContext      *altshiftTlsTypes.TlsContext
+	// QueriedName is the fully qualified name that was queried for a domain,
+	// after any expansion with the search list.
+	QueriedName string
+	// HostsFile is set when the answer came from the hosts file.
+	HostsFile bool
+	// Cached is set when the answer came from the response cache.
+	Cached bool
+	// Stale is set when the answer is an expired cached response, served
+	// because no fresh one could be obtained (RFC 8767).
+	Stale bool
+	// Prefetch is set when the exchange refreshes a cached response in the
+	// background, and on the cache hit that started such a refresh.
+	Prefetch bool
+	// ClientSubnet is the EDNS Client Subnet option of the response, whose
+	// SourceScope is the length of the prefix that the answer is valid for
+	// (RFC 7871).
+	ClientSubnet *dns.EDNS0_SUBNET
+	// Cookie is the DNS Cookie state of the exchange, when cookies are
+	// enabled.
+	Cookie *DnsCookie
+	// Nsid identifies the server instance that answered, such as one of an
+	// anycast set, when it returned an NSID (RFC 5001).
+	Nsid string
+	// Dnssec is the DNSSEC status of each RRset of the response, when the
+	// client validates them.
+	Dnssec []*dnsUtilsDnssecTypes.Result
+	// Denial is the verification of the proof that the name does not exist,
+	// when the client validates an NXDOMAIN response.
+	Denial *dnsUtilsDnssecTypes.Denial
 }